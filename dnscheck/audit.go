@@ -0,0 +1,347 @@
+package dnscheck
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// AuditStatus describes the health of a single nameserver address in a
+// delegation audit.
+type AuditStatus int
+
+const (
+	// AuditOK means the server answered authoritatively with the zone's SOA.
+	AuditOK AuditStatus = iota
+	// AuditUnreachable means the nameserver could not be resolved or did
+	// not respond.
+	AuditUnreachable
+	// AuditLame means the server responded but is not authoritative for the
+	// zone, e.g. it returned REFUSED or an answer without the AA bit.
+	AuditLame
+)
+
+func (s AuditStatus) String() string {
+	switch s {
+	case AuditOK:
+		return "ok"
+	case AuditUnreachable:
+		return "unreachable"
+	case AuditLame:
+		return "lame"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", int(s))
+	}
+}
+
+// AuditServer holds the audit result for a single nameserver address.
+type AuditServer struct {
+	Nameserver string
+	Address    string
+	Status     AuditStatus
+	Serial     uint32   // SOA serial, set when Status is AuditOK
+	MName      string   // SOA MNAME (primary nameserver), set when Status is AuditOK
+	NS         []string // zone's NS set as served by this server, sorted
+	Error      error
+}
+
+// DelegationAudit holds the result of auditing a domain's delegation.
+type DelegationAudit struct {
+	Domain      string
+	Zone        string
+	Nameservers []string
+	Servers     []AuditServer
+}
+
+// Consistent reports whether every reachable, authoritative server returned
+// the same SOA serial.
+func (a *DelegationAudit) Consistent() bool {
+	var serial uint32
+	var seen bool
+	for _, s := range a.Servers {
+		if s.Status != AuditOK {
+			continue
+		}
+		if seen && s.Serial != serial {
+			return false
+		}
+		serial, seen = s.Serial, true
+	}
+	return true
+}
+
+// MajorityNS returns the NS set served by the most servers. Ties are broken
+// in favor of the set seen first.
+func (a *DelegationAudit) MajorityNS() []string {
+	return majority(a.Servers, func(s AuditServer) []string { return s.NS })
+}
+
+// majority returns the value of key served by the most servers, skipping
+// servers for which key returns nil. Ties are broken in favor of the value
+// seen first.
+func majority(servers []AuditServer, key func(AuditServer) []string) []string {
+	counts := make(map[string]int)
+	for _, s := range servers {
+		if v := key(s); v != nil {
+			counts[strings.Join(v, " ")]++
+		}
+	}
+	var most []string
+	var best int
+	for _, s := range servers {
+		v := key(s)
+		if v == nil {
+			continue
+		}
+		if n := counts[strings.Join(v, " ")]; n > best {
+			best = n
+			most = v
+		}
+	}
+	return most
+}
+
+// DivergentNS returns the servers whose NS set differs from the majority,
+// which typically indicates a secondary serving a stale copy of the zone.
+func (a *DelegationAudit) DivergentNS() []AuditServer {
+	majority := a.MajorityNS()
+	var divergent []AuditServer
+	for _, s := range a.Servers {
+		if s.NS != nil && !slices.Equal(s.NS, majority) {
+			divergent = append(divergent, s)
+		}
+	}
+	return divergent
+}
+
+// Healthy reports whether every server is reachable, authoritative, and
+// serving the same SOA serial and NS set. On failure it returns false with a
+// short description of what went wrong.
+func (a *DelegationAudit) Healthy() (bool, string) {
+	if len(a.Servers) == 0 {
+		return false, fmt.Sprintf("%s: no servers found", a.Domain)
+	}
+
+	var unreachable, lame int
+	for _, s := range a.Servers {
+		switch s.Status {
+		case AuditUnreachable:
+			unreachable++
+		case AuditLame:
+			lame++
+		}
+	}
+
+	var problems []string
+	if unreachable > 0 {
+		problems = append(problems, fmt.Sprintf("%d unreachable", unreachable))
+	}
+	if lame > 0 {
+		problems = append(problems, fmt.Sprintf("%d lame", lame))
+	}
+	if !a.Consistent() {
+		problems = append(problems, "inconsistent SOA serials")
+	}
+	if divergent := a.DivergentNS(); len(divergent) > 0 {
+		problems = append(problems, fmt.Sprintf("%d with divergent NS sets", len(divergent)))
+	}
+	if len(problems) == 0 {
+		return true, ""
+	}
+	return false, fmt.Sprintf("%s: %d servers, %s", a.Domain, len(a.Servers), strings.Join(problems, ", "))
+}
+
+// AuditDelegation finds the nameservers for domain, resolves each one, and
+// queries every address for the zone's SOA and NS records. It reports which
+// servers are reachable, which are lame, and whether they agree on the SOA
+// serial and on the zone's own NS set. No expected values are needed.
+func AuditDelegation(ctx context.Context, domain string) (*DelegationAudit, error) {
+	return defaultChecker.AuditDelegation(ctx, domain)
+}
+
+// AuditDelegation is like the package-level AuditDelegation but uses c.
+func (c *Checker) AuditDelegation(ctx context.Context, domain string) (*DelegationAudit, error) {
+	resolver := c.defaultResolver()
+	ex := c.resolverExchanger()
+	if len(c.fallbacks) > 0 {
+		ex = fallbackExchanger{ex, append([]string{resolver}, c.fallbacks...)}
+	}
+	d, err := findZone(ctx, ex, domain, resolver)
+	if err != nil {
+		return nil, err
+	}
+	zone, nameservers := d.zone, d.nameservers
+
+	audit := &DelegationAudit{
+		Domain:      domain,
+		Zone:        zone,
+		Nameservers: nameservers,
+	}
+	for _, ns := range nameservers {
+		addresses, err := resolveNameserver(ctx, c.hostResolver(), ns, c.family)
+		if err != nil {
+			audit.Servers = append(audit.Servers, AuditServer{
+				Nameserver: ns,
+				Status:     AuditUnreachable,
+				Error:      err,
+			})
+			continue
+		}
+
+		for _, addr := range addresses {
+			audit.Servers = append(audit.Servers, auditAddress(ctx, c.exchanger(), ns, addr, zone))
+		}
+	}
+	return audit, nil
+}
+
+// auditAddress queries one nameserver address for the zone's SOA and, if it
+// answers authoritatively, for the zone's NS set.
+func auditAddress(ctx context.Context, ex Exchanger, ns, addr, zone string) AuditServer {
+	server := AuditServer{Nameserver: ns, Address: addr}
+	response, err := queryServer(ctx, ex, addr, "53", zone, TypeSOA, false)
+	if err != nil {
+		server.Status = AuditUnreachable
+		server.Error = &QueryError{Nameserver: ns, Address: addr, Err: err}
+		return server
+	}
+	server.Status, server.Serial, server.Error = classifySOAResponse(response, zone)
+	if server.Status == AuditOK {
+		server.MName = strings.ToLower(dns.Fqdn(findSOA(response, zone).Ns))
+		server.NS = queryNSSet(ctx, ex, addr, zone)
+	}
+	return server
+}
+
+// queryNSSet asks addr for the zone's NS records and returns the normalized,
+// sorted hostnames, or nil if the query fails.
+func queryNSSet(ctx context.Context, ex Exchanger, addr, zone string) []string {
+	response, err := queryServer(ctx, ex, addr, "53", zone, TypeNS, false)
+	if err != nil {
+		return nil
+	}
+	ns := []string{}
+	for _, record := range response.Answer {
+		if r, ok := record.(*dns.NS); ok {
+			ns = append(ns, strings.ToLower(dns.Fqdn(r.Ns)))
+		}
+	}
+	slices.Sort(ns)
+	return ns
+}
+
+// classifySOAResponse inspects a response to an SOA query for zone and
+// returns the server's status and, if authoritative, the SOA serial.
+func classifySOAResponse(response *dns.Msg, zone string) (AuditStatus, uint32, error) {
+	if response.Rcode != dns.RcodeSuccess {
+		return AuditLame, 0, fmt.Errorf("server returned %s", dns.RcodeToString[response.Rcode])
+	}
+	if !response.Authoritative {
+		return AuditLame, 0, fmt.Errorf("server is not authoritative for %s", zone)
+	}
+	if soa := findSOA(response, zone); soa != nil {
+		return AuditOK, soa.Serial, nil
+	}
+	return AuditLame, 0, fmt.Errorf("no SOA record for %s in answer", zone)
+}
+
+// findSOA returns the zone's SOA record from the response's answer section,
+// or nil if there isn't one.
+func findSOA(response *dns.Msg, zone string) *dns.SOA {
+	for _, record := range response.Answer {
+		if soa, ok := record.(*dns.SOA); ok && strings.EqualFold(soa.Hdr.Name, zone) {
+			return soa
+		}
+	}
+	return nil
+}
+
+// PrimaryAudit holds the result of checking a zone's primary nameserver, the
+// MNAME of its SOA record.
+type PrimaryAudit struct {
+	MName string
+	// Servers holds one entry per address of MName, or a single
+	// AuditUnreachable entry if it could not be resolved.
+	Servers []AuditServer
+	// SecondarySerial is the highest SOA serial served by the delegated
+	// nameservers.
+	SecondarySerial uint32
+}
+
+// Healthy reports whether every address of the primary answered
+// authoritatively with a serial at least as high as any secondary's. A
+// primary that lags its own secondaries is a serious inversion: updates
+// were made somewhere other than the source of truth. On failure it returns
+// false with a short description of what went wrong.
+func (p *PrimaryAudit) Healthy() (bool, string) {
+	var problems []string
+	for _, s := range p.Servers {
+		label := s.Nameserver
+		if s.Address != "" {
+			label += " (" + s.Address + ")"
+		}
+		switch {
+		case s.Status != AuditOK:
+			problems = append(problems, fmt.Sprintf("%s is %s", label, s.Status))
+		case serialLess(s.Serial, p.SecondarySerial):
+			problems = append(problems, fmt.Sprintf("%s serial %d is behind secondaries (%d)", label, s.Serial, p.SecondarySerial))
+		}
+	}
+	if len(problems) == 0 {
+		return true, ""
+	}
+	return false, "primary " + strings.Join(problems, ", ")
+}
+
+// AuditPrimary takes the MNAME named by the SOA records in audit, resolves
+// it, and queries each address for the zone's SOA. When the servers
+// disagree on the MNAME, the one named by the most servers is used. It fails
+// if no server in audit answered with an SOA record. A primary that can't be
+// resolved or queried is recorded as AuditUnreachable, which Healthy reports
+// as a failure.
+func AuditPrimary(ctx context.Context, audit *DelegationAudit) (*PrimaryAudit, error) {
+	return defaultChecker.AuditPrimary(ctx, audit)
+}
+
+// AuditPrimary is like the package-level AuditPrimary but uses c.
+func (c *Checker) AuditPrimary(ctx context.Context, audit *DelegationAudit) (*PrimaryAudit, error) {
+	primary := &PrimaryAudit{}
+	var seen bool
+	for _, s := range audit.Servers {
+		if s.Status != AuditOK {
+			continue
+		}
+		if !seen || serialLess(primary.SecondarySerial, s.Serial) {
+			primary.SecondarySerial = s.Serial
+			seen = true
+		}
+	}
+	if !seen {
+		return nil, fmt.Errorf("%s: no authoritative SOA to take the MNAME from", audit.Domain)
+	}
+	primary.MName = majority(audit.Servers, func(s AuditServer) []string {
+		if s.Status != AuditOK {
+			return nil
+		}
+		return []string{s.MName}
+	})[0]
+
+	addresses, err := resolveNameserver(ctx, c.hostResolver(), primary.MName, c.family)
+	if err != nil {
+		primary.Servers = []AuditServer{{Nameserver: primary.MName, Status: AuditUnreachable, Error: err}}
+		return primary, nil
+	}
+	for _, addr := range addresses {
+		primary.Servers = append(primary.Servers, auditAddress(ctx, c.exchanger(), primary.MName, addr, audit.Zone))
+	}
+	return primary, nil
+}
+
+// serialLess reports whether SOA serial a is older than b, using the serial
+// number arithmetic of RFC 1982 so that wrapped serials compare correctly.
+func serialLess(a, b uint32) bool {
+	return a != b && int32(b-a) > 0
+}
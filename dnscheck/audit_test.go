@@ -0,0 +1,153 @@
+package dnscheck
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestClassifySOAResponse(t *testing.T) {
+	soa := "example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 2024010101 7200 3600 1209600 300"
+
+	authoritative := new(dns.Msg)
+	authoritative.Authoritative = true
+	authoritative.Answer = []dns.RR{mustRR(t, soa)}
+
+	notAuthoritative := new(dns.Msg)
+	notAuthoritative.Answer = []dns.RR{mustRR(t, soa)}
+
+	refused := new(dns.Msg)
+	refused.Rcode = dns.RcodeRefused
+
+	empty := new(dns.Msg)
+	empty.Authoritative = true
+
+	tests := []struct {
+		name       string
+		response   *dns.Msg
+		wantStatus AuditStatus
+		wantSerial uint32
+	}{
+		{"authoritative", authoritative, AuditOK, 2024010101},
+		{"missing AA bit", notAuthoritative, AuditLame, 0},
+		{"refused", refused, AuditLame, 0},
+		{"no SOA in answer", empty, AuditLame, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, serial, err := classifySOAResponse(tt.response, "example.com.")
+			if status != tt.wantStatus || serial != tt.wantSerial {
+				t.Errorf("classifySOAResponse() = %v, %d, want %v, %d", status, serial, tt.wantStatus, tt.wantSerial)
+			}
+			if (err != nil) != (tt.wantStatus != AuditOK) {
+				t.Errorf("classifySOAResponse() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestDelegationAuditHealthy(t *testing.T) {
+	audit := &DelegationAudit{
+		Domain: "example.com",
+		Servers: []AuditServer{
+			{Nameserver: "ns1.example.com.", Status: AuditOK, Serial: 2},
+			{Nameserver: "ns2.example.com.", Status: AuditOK, Serial: 2},
+		},
+	}
+	if ok, reason := audit.Healthy(); !ok {
+		t.Errorf("Healthy() = false, %q, want true", reason)
+	}
+
+	audit.Servers = append(audit.Servers,
+		AuditServer{Nameserver: "ns3.example.com.", Status: AuditOK, Serial: 1},
+		AuditServer{Nameserver: "ns4.example.com.", Status: AuditLame},
+		AuditServer{Nameserver: "ns5.example.com.", Status: AuditUnreachable},
+	)
+	ok, reason := audit.Healthy()
+	want := "example.com: 5 servers, 1 unreachable, 1 lame, inconsistent SOA serials"
+	if ok || reason != want {
+		t.Errorf("Healthy() = %v, %q, want false, %q", ok, reason, want)
+	}
+}
+
+func TestDelegationAuditDivergentNS(t *testing.T) {
+	current := []string{"ns1.example.com.", "ns2.example.com."}
+	stale := []string{"ns1.example.com.", "old.example.net."}
+	audit := &DelegationAudit{
+		Domain: "example.com",
+		Servers: []AuditServer{
+			{Nameserver: "ns1.example.com.", Status: AuditOK, NS: current},
+			{Nameserver: "ns2.example.com.", Status: AuditOK, NS: stale},
+			{Nameserver: "ns3.example.com.", Status: AuditOK, NS: current},
+			{Nameserver: "ns4.example.com.", Status: AuditUnreachable},
+		},
+	}
+
+	if got := audit.MajorityNS(); !slices.Equal(got, current) {
+		t.Errorf("MajorityNS() = %v, want %v", got, current)
+	}
+	divergent := audit.DivergentNS()
+	if len(divergent) != 1 || divergent[0].Nameserver != "ns2.example.com." {
+		t.Errorf("DivergentNS() = %v, want only ns2.example.com.", divergent)
+	}
+}
+
+func TestDelegationAuditMajorityNSTie(t *testing.T) {
+	a := []string{"ns1.example.com."}
+	b := []string{"ns2.example.com."}
+	audit := &DelegationAudit{
+		Domain: "example.com",
+		Servers: []AuditServer{
+			{Nameserver: "ns1.example.com.", Status: AuditOK, NS: a},
+			{Nameserver: "ns2.example.com.", Status: AuditOK, NS: b},
+			{Nameserver: "ns3.example.com.", Status: AuditOK, NS: b},
+			{Nameserver: "ns4.example.com.", Status: AuditOK, NS: a},
+		},
+	}
+	if got := audit.MajorityNS(); !slices.Equal(got, a) {
+		t.Errorf("MajorityNS() = %v, want the set seen first, %v", got, a)
+	}
+}
+
+func TestSerialLess(t *testing.T) {
+	tests := []struct {
+		a, b uint32
+		want bool
+	}{
+		{1, 2, true},
+		{2, 1, false},
+		{2, 2, false},
+		{4294967295, 1, true}, // wrapped
+		{1, 4294967295, false},
+	}
+	for _, tt := range tests {
+		if got := serialLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("serialLess(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestPrimaryAuditHealthy(t *testing.T) {
+	primary := &PrimaryAudit{
+		MName:           "ns0.example.com.",
+		SecondarySerial: 5,
+		Servers: []AuditServer{
+			{Nameserver: "ns0.example.com.", Address: "192.0.2.1", Status: AuditOK, Serial: 5},
+		},
+	}
+	if ok, reason := primary.Healthy(); !ok {
+		t.Errorf("Healthy() = false, %q, want true", reason)
+	}
+
+	primary.Servers = append(primary.Servers,
+		AuditServer{Nameserver: "ns0.example.com.", Address: "192.0.2.2", Status: AuditOK, Serial: 4},
+		AuditServer{Nameserver: "ns0.example.com.", Address: "192.0.2.3", Status: AuditUnreachable},
+	)
+	ok, reason := primary.Healthy()
+	want := "primary ns0.example.com. (192.0.2.2) serial 4 is behind secondaries (5), ns0.example.com. (192.0.2.3) is unreachable"
+	if ok || reason != want {
+		t.Errorf("Healthy() = %v, %q, want false, %q", ok, reason, want)
+	}
+}
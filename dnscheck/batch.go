@@ -0,0 +1,165 @@
+package dnscheck
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ParseBatch reads a batch file describing the expected state of several
+// names and returns one CheckArgs per domain and record type, in the order
+// they first appear.
+//
+// Each domain starts an unindented line, followed by indented lines of the
+// form "TYPE VALUE". The value is the rest of the line, so it may contain
+// spaces. Repeating a type adds another expected value. Blank lines and
+// lines starting with "#" are ignored:
+//
+//	example.com
+//	    A   192.0.2.1
+//	    A   192.0.2.2
+//	    MX  mail.example.com.
+//	www.example.com
+//	    CNAME example.com.
+func ParseBatch(r io.Reader) ([]CheckArgs, error) {
+	var checks []CheckArgs
+	index := make(map[string]int) // "domain TYPE" -> position in checks
+	var domain string
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if text[0] != ' ' && text[0] != '\t' {
+			if strings.ContainsAny(trimmed, " \t") {
+				return nil, fmt.Errorf("line %d: expected a domain name, got %q", line, trimmed)
+			}
+			domain = trimmed
+			continue
+		}
+		if domain == "" {
+			return nil, fmt.Errorf("line %d: expectation before any domain", line)
+		}
+
+		// The type ends at the first space or tab; the value may contain
+		// either.
+		typ, value := trimmed, ""
+		if i := strings.IndexFunc(trimmed, unicode.IsSpace); i >= 0 {
+			typ, value = trimmed[:i], strings.TrimSpace(trimmed[i:])
+		}
+		if value == "" {
+			return nil, fmt.Errorf("line %d: expected TYPE VALUE, got %q", line, trimmed)
+		}
+		rt, err := ParseRecordType(typ)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		key := domain + " " + rt.String()
+		i, seen := index[key]
+		if !seen {
+			i = len(checks)
+			index[key] = i
+			checks = append(checks, CheckArgs{Domain: domain, RecordType: rt})
+		}
+		checks[i].Expected = append(checks[i].Expected, value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return checks, nil
+}
+
+// BatchStatus describes the outcome of one check in a batch.
+type BatchStatus int
+
+const (
+	// BatchPassed means the check ran and every server matched.
+	BatchPassed BatchStatus = iota
+	// BatchFailed means the check ran and failed or returned an error.
+	BatchFailed
+	// BatchNotRun means the batch deadline passed before the check started.
+	BatchNotRun
+)
+
+func (s BatchStatus) String() string {
+	switch s {
+	case BatchPassed:
+		return "passed"
+	case BatchFailed:
+		return "failed"
+	case BatchNotRun:
+		return "not run"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", int(s))
+	}
+}
+
+// BatchResult holds the outcome of one check in a batch.
+type BatchResult struct {
+	Args   CheckArgs
+	Status BatchStatus
+	Result *CheckResult // set if Check returned a result
+	Error  error        // set if Check returned an error
+}
+
+// CheckBatch runs each check in order, giving each one timeout (if positive)
+// within ctx. Once ctx is done, the remaining checks are not started and are
+// reported as BatchNotRun, so ctx's deadline bounds the whole batch.
+func CheckBatch(ctx context.Context, checks []CheckArgs, timeout time.Duration) []BatchResult {
+	return CheckBatchConcurrent(ctx, checks, timeout, 1)
+}
+
+// CheckBatchConcurrent is like CheckBatch but runs up to concurrency checks
+// at once. Checks are still started in order, and results are in the order
+// of checks. A concurrency of zero or less runs them one at a time.
+func CheckBatchConcurrent(ctx context.Context, checks []CheckArgs, timeout time.Duration, concurrency int) []BatchResult {
+	results := make([]BatchResult, len(checks))
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, args := range checks {
+		results[i].Args = args
+		select {
+		case sem <- struct{}{}:
+			if ctx.Err() == nil {
+				wg.Go(func() {
+					defer func() { <-sem }()
+					result, err := checkWithTimeout(ctx, args, timeout)
+
+					results[i].Result, results[i].Error = result, err
+					results[i].Status = BatchFailed
+					if err == nil {
+						if ok, _ := result.Match(); ok {
+							results[i].Status = BatchPassed
+						}
+					}
+				})
+				continue
+			}
+			<-sem
+		case <-ctx.Done():
+		}
+		results[i].Status = BatchNotRun
+	}
+	wg.Wait()
+	return results
+}
+
+// checkWithTimeout runs Check with timeout applied to ctx, if positive.
+func checkWithTimeout(ctx context.Context, args CheckArgs, timeout time.Duration) (*CheckResult, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return Check(ctx, args)
+}
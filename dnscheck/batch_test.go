@@ -0,0 +1,146 @@
+package dnscheck
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseBatch(t *testing.T) {
+	input := `# expected state of example.com
+example.com
+    A   192.0.2.1
+    MX  mail.example.com.
+	A   192.0.2.2
+
+www.example.com
+    CNAME example.com.
+    TXT v=spf1 -all
+	TXT	v=spf1 include:example.net -all
+`
+	checks, err := ParseBatch(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseBatch() error: %v", err)
+	}
+
+	want := []struct {
+		domain   string
+		rt       RecordType
+		expected []string
+	}{
+		{"example.com", TypeA, []string{"192.0.2.1", "192.0.2.2"}},
+		{"example.com", TypeMX, []string{"mail.example.com."}},
+		{"www.example.com", TypeCNAME, []string{"example.com."}},
+		{"www.example.com", TypeTXT, []string{"v=spf1 -all", "v=spf1 include:example.net -all"}},
+	}
+	if len(checks) != len(want) {
+		t.Fatalf("got %d checks, want %d: %+v", len(checks), len(want), checks)
+	}
+	for i, w := range want {
+		c := checks[i]
+		if c.Domain != w.domain || c.RecordType != w.rt || !slices.Equal(c.Expected, w.expected) {
+			t.Errorf("check %d = %s %s %v, want %s %s %v", i, c.Domain, c.RecordType, c.Expected, w.domain, w.rt, w.expected)
+		}
+	}
+}
+
+func TestParseBatchErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"no domain", "  A 192.0.2.1\n"},
+		{"missing value", "example.com\n  A\n"},
+		{"unknown type", "example.com\n  BOGUS 1\n"},
+		{"domain with spaces", "example.com A 192.0.2.1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseBatch(strings.NewReader(tt.input)); err == nil {
+				t.Error("ParseBatch() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestCheckBatchDeadline(t *testing.T) {
+	// Every check takes about 30ms, so only the first few fit in the
+	// batch deadline.
+	slow := func(msg *dns.Msg) *dns.Msg {
+		time.Sleep(30 * time.Millisecond)
+		return reply(t, "example.com. 300 IN A 192.0.2.100")(msg)
+	}
+	exchanger := fakeExchanger{
+		"resolver:53":  reply(t, "example.com. 300 IN NS ns1.example.com."),
+		"192.0.2.1:53": slow,
+	}
+	var checks []CheckArgs
+	for range 10 {
+		checks = append(checks, CheckArgs{
+			Domain:       "example.com",
+			RecordType:   TypeA,
+			Expected:     []string{"192.0.2.100"},
+			Resolver:     "resolver:53",
+			Exchanger:    exchanger,
+			HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.1"}},
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	results := CheckBatch(ctx, checks, time.Second)
+
+	if len(results) != len(checks) {
+		t.Fatalf("CheckBatch() returned %d results, want %d", len(results), len(checks))
+	}
+	if results[0].Status != BatchPassed {
+		t.Errorf("first check status = %v, want passed", results[0].Status)
+	}
+	if last := results[len(results)-1]; last.Status != BatchNotRun || last.Result != nil {
+		t.Errorf("last check = %+v, want not run", last)
+	}
+	// Once one check is skipped, all later ones must be too.
+	var skipped bool
+	for i, r := range results {
+		if skipped && r.Status != BatchNotRun {
+			t.Errorf("check %d status = %v after a skipped check", i, r.Status)
+		}
+		skipped = skipped || r.Status == BatchNotRun
+	}
+}
+
+func TestCheckBatchConcurrency(t *testing.T) {
+	// Each check takes about 50ms, so five of them only fit in the 150ms
+	// deadline if they run at once.
+	slow := func(msg *dns.Msg) *dns.Msg {
+		time.Sleep(50 * time.Millisecond)
+		return reply(t, "example.com. 300 IN A 192.0.2.100")(msg)
+	}
+	exchanger := fakeExchanger{
+		"resolver:53":  reply(t, "example.com. 300 IN NS ns1.example.com."),
+		"192.0.2.1:53": slow,
+	}
+	var checks []CheckArgs
+	for range 5 {
+		checks = append(checks, CheckArgs{
+			Domain:       "example.com",
+			RecordType:   TypeA,
+			Expected:     []string{"192.0.2.100"},
+			Resolver:     "resolver:53",
+			Exchanger:    exchanger,
+			HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.1"}},
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	for i, r := range CheckBatchConcurrent(ctx, checks, time.Second, len(checks)) {
+		if r.Status != BatchPassed {
+			t.Errorf("check %d status = %v (error %v), want passed", i, r.Status, r.Error)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package dnscheck
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// caaRecord is a parsed CAA record.
+type caaRecord struct {
+	flag  uint8
+	tag   string
+	value string
+}
+
+// formatCAA renders a CAA record as `flag tag "value"`.
+func formatCAA(flag uint8, tag, value string) string {
+	return fmt.Sprintf("%d %s %q", flag, tag, value)
+}
+
+// parseCAA parses a CAA value of the form `flag tag value`, where value may
+// be quoted. The tag is lowercased since tags are case-insensitive; the
+// value is kept as is.
+func parseCAA(s string) (caaRecord, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 3 {
+		return caaRecord{}, fmt.Errorf("invalid CAA record %q: want flag tag value", s)
+	}
+	flag, err := strconv.ParseUint(fields[0], 10, 8)
+	if err != nil {
+		return caaRecord{}, fmt.Errorf("invalid CAA flag in %q: %w", s, err)
+	}
+	rest := strings.TrimSpace(s)
+	rest = strings.TrimSpace(rest[len(fields[0]):])
+	rest = strings.TrimSpace(rest[len(fields[1]):])
+	return caaRecord{
+		flag:  uint8(flag),
+		tag:   strings.ToLower(fields[1]),
+		value: unquote(rest),
+	}, nil
+}
+
+// unquote strips one level of surrounding double quotes from s, if present.
+func unquote(s string) string {
+	if v, err := strconv.Unquote(s); err == nil && strings.HasPrefix(s, `"`) {
+		return v
+	}
+	return strings.Trim(s, `"`)
+}
+
+// normalizeCAA renders a CAA value in a canonical form so that differences
+// in quoting, spacing or tag case don't cause mismatches. Values that can't
+// be parsed fall back to the default normalization.
+func normalizeCAA(s string) string {
+	r, err := parseCAA(s)
+	if err != nil {
+		return normalizeValue(s)
+	}
+	return formatCAA(r.flag, r.tag, r.value)
+}
+
+// missingCAA returns the required "tag value" properties that aren't present
+// in any of the CAA values, ignoring flags.
+func missingCAA(values, required []string) []string {
+	var records []caaRecord
+	for _, v := range values {
+		if r, err := parseCAA(v); err == nil {
+			records = append(records, r)
+		}
+	}
+
+	var missing []string
+	for _, req := range required {
+		tag, value, _ := strings.Cut(strings.TrimSpace(req), " ")
+		tag, value = strings.ToLower(tag), unquote(strings.TrimSpace(value))
+		found := false
+		for _, r := range records {
+			if r.tag == tag && r.value == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, req)
+		}
+	}
+	return missing
+}
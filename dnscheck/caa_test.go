@@ -0,0 +1,78 @@
+package dnscheck
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestNormalizeCAA(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`0 issue "letsencrypt.org"`, `0 issue "letsencrypt.org"`},
+		{`0 ISSUE "letsencrypt.org"`, `0 issue "letsencrypt.org"`},
+		{`0  issue   letsencrypt.org`, `0 issue "letsencrypt.org"`},
+		{`128 iodef "mailto:Security@Example.com"`, `128 iodef "mailto:Security@Example.com"`},
+		{`0 issue "ca.example; account=123"`, `0 issue "ca.example; account=123"`},
+		{`not a caa record`, `not a caa record`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := normalizeCAA(tt.input); got != tt.want {
+				t.Errorf("normalizeCAA(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValuesMatchTypeCAA(t *testing.T) {
+	got := []string{`0 issue "letsencrypt.org"`, `0 iodef "mailto:Security@Example.com"`}
+
+	if !valuesMatchType(TypeCAA, got, []string{`0 ISSUE letsencrypt.org`, `0 iodef "mailto:Security@Example.com"`}) {
+		t.Error("valuesMatchType(CAA) = false for serialization differences, want true")
+	}
+	if valuesMatchType(TypeCAA, got, []string{`0 issue "letsencrypt.org"`, `0 iodef "mailto:security@example.com"`}) {
+		t.Error("valuesMatchType(CAA) = true for differing value case, want false")
+	}
+	if valuesMatchType(TypeCAA, got, []string{`128 issue "letsencrypt.org"`, `0 iodef "mailto:Security@Example.com"`}) {
+		t.Error("valuesMatchType(CAA) = true for differing flags, want false")
+	}
+}
+
+func TestMissingCAA(t *testing.T) {
+	values := []string{`0 issue "letsencrypt.org"`, `128 issuewild "pki.goog"`}
+
+	tests := []struct {
+		name     string
+		required []string
+		want     []string
+	}{
+		{"present", []string{"issue letsencrypt.org"}, nil},
+		{"present regardless of flags and tag case", []string{`ISSUEWILD "pki.goog"`}, nil},
+		{"missing", []string{"issue letsencrypt.org", "issue digicert.com"}, []string{"issue digicert.com"}},
+		{"wrong tag", []string{"issuewild letsencrypt.org"}, []string{"issuewild letsencrypt.org"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingCAA(values, tt.required); !slices.Equal(got, tt.want) {
+				t.Errorf("missingCAA() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCAAValues(t *testing.T) {
+	answer := []dns.RR{
+		mustRR(t, `example.com. 300 IN CAA 0 issue "letsencrypt.org"`),
+		mustRR(t, `example.com. 300 IN CAA 128 iodef "mailto:Security@Example.com"`),
+	}
+	want := []string{`0 issue "letsencrypt.org"`, `128 iodef "mailto:Security@Example.com"`}
+	if got := answerValues(answer); !slices.Equal(got, want) {
+		t.Errorf("answerValues() = %q, want %q", got, want)
+	}
+}
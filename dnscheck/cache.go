@@ -0,0 +1,126 @@
+package dnscheck
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Cache holds responses from recursive resolvers, such as the NS lookups
+// that find a domain's nameservers, for as long as their TTLs allow, so that
+// repeated checks of the same names don't repeat them. Queries to the
+// authoritative servers being checked never use it. The zero value is an
+// empty cache ready to use, and a Cache may be shared by concurrent checks.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+	now     func() time.Time // time.Now if nil; replaced in tests
+}
+
+// cacheKey identifies a query: the resolver it was sent to, its name and
+// type, and whether it asked for DNSSEC records.
+type cacheKey struct {
+	address string
+	name    string
+	qtype   uint16
+	dnssec  bool
+}
+
+type cacheEntry struct {
+	response *dns.Msg
+	expires  time.Time
+}
+
+// Clear removes every cached response.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
+
+func (c *Cache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// get returns a copy of the unexpired response cached for key, or nil.
+func (c *Cache) get(key cacheKey) *dns.Msg {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || !c.clock().Before(entry.expires) {
+		return nil
+	}
+	return entry.response.Copy()
+}
+
+// put caches response for key for its lowest TTL. Responses that aren't
+// successful or have no records to take a TTL from aren't cached.
+func (c *Cache) put(key cacheKey, response *dns.Msg) {
+	ttl, ok := responseTTL(response)
+	if !ok || response.Rcode != dns.RcodeSuccess {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[cacheKey]cacheEntry)
+	}
+	c.entries[key] = cacheEntry{
+		response: response.Copy(),
+		expires:  c.clock().Add(time.Duration(ttl) * time.Second),
+	}
+}
+
+// responseTTL returns the lowest TTL of the records in the answer and
+// authority sections of response, and false if there are none or it is 0.
+func responseTTL(response *dns.Msg) (uint32, bool) {
+	var ttl uint32
+	var found bool
+	for _, section := range [][]dns.RR{response.Answer, response.Ns} {
+		for _, record := range section {
+			if t := record.Header().Ttl; !found || t < ttl {
+				ttl, found = t, true
+			}
+		}
+	}
+	return ttl, found && ttl > 0
+}
+
+// exchanger returns ex wrapped to answer from c where it can, or ex itself
+// if c is nil.
+func (c *Cache) exchanger(ex Exchanger) Exchanger {
+	if c == nil {
+		return ex
+	}
+	return cachingExchanger{ex, c}
+}
+
+// cachingExchanger answers queries from its cache, and caches the responses
+// to the queries it forwards.
+type cachingExchanger struct {
+	Exchanger
+	cache *Cache
+}
+
+func (e cachingExchanger) Exchange(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+	if len(msg.Question) != 1 {
+		return e.Exchanger.Exchange(ctx, msg, address)
+	}
+	q := msg.Question[0]
+	key := cacheKey{address, strings.ToLower(q.Name), q.Qtype, msg.IsEdns0() != nil && msg.IsEdns0().Do()}
+	if response := e.cache.get(key); response != nil {
+		response.Id = msg.Id
+		return response, nil
+	}
+	response, err := e.Exchanger.Exchange(ctx, msg, address)
+	if err == nil {
+		e.cache.put(key, response)
+	}
+	return response, err
+}
@@ -0,0 +1,120 @@
+package dnscheck
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// countingExchanger counts the queries sent to each address before passing
+// them on.
+type countingExchanger struct {
+	Exchanger
+	counts map[string]int
+}
+
+func (e countingExchanger) Exchange(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+	e.counts[address]++
+	return e.Exchanger.Exchange(ctx, msg, address)
+}
+
+func TestCacheExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cache := &Cache{now: func() time.Time { return now }}
+	counts := make(map[string]int)
+	ex := cache.exchanger(countingExchanger{
+		fakeExchanger{"resolver:53": reply(t, "example.com. 300 IN NS ns1.example.com.")},
+		counts,
+	})
+
+	query := func() {
+		t.Helper()
+		msg := new(dns.Msg)
+		msg.SetQuestion("Example.com.", dns.TypeNS)
+		response, err := ex.Exchange(context.Background(), msg, "resolver:53")
+		if err != nil {
+			t.Fatalf("Exchange() error: %v", err)
+		}
+		if response.Id != msg.Id || len(response.Answer) != 1 {
+			t.Fatalf("Exchange() = %v, want the NS answer with ID %d", response, msg.Id)
+		}
+	}
+
+	query()
+	now = now.Add(299 * time.Second)
+	query()
+	if counts["resolver:53"] != 1 {
+		t.Errorf("queries before the TTL expired = %d, want 1", counts["resolver:53"])
+	}
+
+	now = now.Add(time.Second)
+	query()
+	if counts["resolver:53"] != 2 {
+		t.Errorf("queries after the TTL expired = %d, want 2", counts["resolver:53"])
+	}
+
+	cache.Clear()
+	query()
+	if counts["resolver:53"] != 3 {
+		t.Errorf("queries after Clear = %d, want 3", counts["resolver:53"])
+	}
+}
+
+func TestCacheSkipsFailures(t *testing.T) {
+	cache := new(Cache)
+	counts := make(map[string]int)
+	ex := cache.exchanger(countingExchanger{
+		fakeExchanger{"resolver:53": func(msg *dns.Msg) *dns.Msg {
+			return new(dns.Msg).SetRcode(msg, dns.RcodeServerFailure)
+		}},
+		counts,
+	})
+	for range 2 {
+		msg := new(dns.Msg)
+		msg.SetQuestion("example.com.", dns.TypeNS)
+		if _, err := ex.Exchange(context.Background(), msg, "resolver:53"); err != nil {
+			t.Fatalf("Exchange() error: %v", err)
+		}
+	}
+	if counts["resolver:53"] != 2 {
+		t.Errorf("queries = %d, want 2, since SERVFAIL isn't cached", counts["resolver:53"])
+	}
+}
+
+func TestCheckerCacheBypassesAuthoritativeQueries(t *testing.T) {
+	counts := make(map[string]int)
+	c := NewChecker(
+		WithCache(new(Cache)),
+		WithExchanger(countingExchanger{
+			fakeExchanger{
+				"resolver:53":   reply(t, "example.com. 300 IN NS ns1.example.com."),
+				"192.0.2.53:53": reply(t, "example.com. 300 IN A 192.0.2.1"),
+			},
+			counts,
+		}),
+		WithHostResolver(fakeHosts{"ns1.example.com.": {"192.0.2.53"}}),
+	)
+
+	for range 3 {
+		result, err := c.Check(context.Background(), CheckArgs{
+			Domain:     "example.com",
+			RecordType: TypeA,
+			Expected:   []string{"192.0.2.1"},
+			Resolver:   "resolver:53",
+		})
+		if err != nil {
+			t.Fatalf("Check() error: %v", err)
+		}
+		if ok, reason := result.Match(); !ok {
+			t.Fatalf("Check() didn't match: %s", reason)
+		}
+	}
+	if counts["resolver:53"] != 1 {
+		t.Errorf("resolver queries = %d, want 1", counts["resolver:53"])
+	}
+	if counts["192.0.2.53:53"] != 3 {
+		t.Errorf("authoritative queries = %d, want 3", counts["192.0.2.53:53"])
+	}
+}
@@ -0,0 +1,198 @@
+package dnscheck
+
+import (
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Checker runs lookups and checks through its Exchanger and HostResolver, so
+// that code built on this package can be tested with canned responses
+// instead of live DNS. Checkers made by NewChecker also carry defaults for
+// the checks they run, so several independently configured Checkers can be
+// used in the same process. The zero value uses the network and the
+// package's defaults; the package-level functions such as Check and
+// QueryServer are shorthands for a zero Checker's methods.
+type Checker struct {
+	// Exchanger, if set, sends every DNS query in place of the built-in
+	// UDP/TCP client.
+	Exchanger Exchanger
+
+	// HostResolver, if set, resolves nameserver hostnames to addresses in
+	// place of net.DefaultResolver.
+	HostResolver HostResolver
+
+	// Cache, if set, holds the responses to queries sent to recursive
+	// resolvers, e.g. to find nameservers, so that repeated checks don't
+	// repeat them. Set it to nil to stop caching, or call its Clear method.
+	Cache *Cache
+
+	// RateLimiter, if set, throttles every query sent by c and by the
+	// checks it runs that don't set CheckArgs.RateLimiter.
+	RateLimiter *RateLimiter
+
+	resolver     string
+	fallbacks    []string
+	queryTimeout time.Duration
+	concurrency  int
+	family       AddressFamily
+}
+
+// Option configures a Checker made by NewChecker.
+type Option func(*Checker)
+
+// NewChecker returns a Checker configured by opts.
+func NewChecker(opts ...Option) *Checker {
+	c := new(Checker)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithResolver sets the recursive resolver, and any fallbacks, used by
+// checks that don't set CheckArgs.Resolver and by AuditDelegation, in place
+// of DefaultResolver.
+func WithResolver(resolver string, fallbacks ...string) Option {
+	return func(c *Checker) {
+		c.resolver = resolver
+		c.fallbacks = fallbacks
+	}
+}
+
+// WithQueryTimeout sets the timeout for each query of checks that don't set
+// CheckArgs.PerQueryTimeout.
+func WithQueryTimeout(timeout time.Duration) Option {
+	return func(c *Checker) {
+		c.queryTimeout = timeout
+	}
+}
+
+// WithConcurrency sets the number of server addresses queried at once by
+// checks that don't set CheckArgs.Concurrency, in place of
+// DefaultConcurrency.
+func WithConcurrency(n int) Option {
+	return func(c *Checker) {
+		c.concurrency = n
+	}
+}
+
+// WithAddressFamily sets the address family queried by checks whose
+// CheckArgs.AddressFamily is left at FamilyDefault, and by audits.
+func WithAddressFamily(family AddressFamily) Option {
+	return func(c *Checker) {
+		c.family = family
+	}
+}
+
+// WithClient sends queries with client, and falls back to TCP with a copy of
+// it, in place of the built-in clients. Like a custom Exchanger, it means
+// CheckArgs.LocalPort, ForceTCP and DetectSpoofing have no effect.
+func WithClient(client *dns.Client) Option {
+	return func(c *Checker) {
+		tcp := *client
+		tcp.Net = "tcp"
+		c.Exchanger = &transport{udp: client, tcp: &tcp}
+	}
+}
+
+// WithExchanger sets the Checker's Exchanger.
+func WithExchanger(ex Exchanger) Option {
+	return func(c *Checker) {
+		c.Exchanger = ex
+	}
+}
+
+// WithCache sets the Checker's Cache.
+func WithCache(cache *Cache) Option {
+	return func(c *Checker) {
+		c.Cache = cache
+	}
+}
+
+// WithRateLimit limits the Checker to qps queries per second across all of
+// its checks and lookups, however many run at once. A qps of zero or less
+// doesn't limit.
+func WithRateLimit(qps float64) Option {
+	return func(c *Checker) {
+		c.RateLimiter = NewRateLimiter(qps)
+	}
+}
+
+// WithHostResolver sets the Checker's HostResolver.
+func WithHostResolver(hosts HostResolver) Option {
+	return func(c *Checker) {
+		c.HostResolver = hosts
+	}
+}
+
+// defaultChecker is the Checker used by the package-level functions.
+var defaultChecker = new(Checker)
+
+// exchanger returns the Exchanger to use for c.
+func (c *Checker) exchanger() Exchanger {
+	var ex Exchanger = defaultTransport
+	if c.Exchanger != nil {
+		ex = c.Exchanger
+	}
+	if c.RateLimiter != nil {
+		return rateLimitExchanger{ex, c.RateLimiter}
+	}
+	return ex
+}
+
+// resolverExchanger returns the Exchanger to use for c's queries to
+// recursive resolvers, which may be answered from c.Cache.
+func (c *Checker) resolverExchanger() Exchanger {
+	return c.Cache.exchanger(c.exchanger())
+}
+
+// defaultResolver returns the recursive resolver to use for c.
+func (c *Checker) defaultResolver() string {
+	if c.resolver != "" {
+		return c.resolver
+	}
+	return DefaultResolver
+}
+
+// withDefaults returns args with the fields it leaves unset filled in from
+// c's configuration.
+func (c *Checker) withDefaults(args CheckArgs) CheckArgs {
+	if args.Exchanger == nil {
+		args.Exchanger = c.Exchanger
+	}
+	if args.HostResolver == nil {
+		args.HostResolver = c.HostResolver
+	}
+	if args.Cache == nil {
+		args.Cache = c.Cache
+	}
+	if args.RateLimiter == nil {
+		args.RateLimiter = c.RateLimiter
+	}
+	if args.Resolver == "" && c.resolver != "" {
+		args.Resolver = c.resolver
+		if len(args.FallbackResolvers) == 0 {
+			args.FallbackResolvers = c.fallbacks
+		}
+	}
+	if args.PerQueryTimeout == 0 {
+		args.PerQueryTimeout = c.queryTimeout
+	}
+	if args.Concurrency == 0 {
+		args.Concurrency = c.concurrency
+	}
+	if args.AddressFamily == FamilyDefault {
+		args.AddressFamily = c.family
+	}
+	return args
+}
+
+// hostResolver returns the HostResolver to use for c.
+func (c *Checker) hostResolver() HostResolver {
+	if c.HostResolver != nil {
+		return c.HostResolver
+	}
+	return net.DefaultResolver
+}
@@ -0,0 +1,190 @@
+package dnscheck
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestCheckerQueryServer(t *testing.T) {
+	c := &Checker{
+		Exchanger: fakeExchanger{
+			"resolver:53":   reply(t, "example.com. 300 IN NS ns1.example.com."),
+			"192.0.2.53:53": reply(t, "example.com. 300 IN A 192.0.2.1"),
+		},
+	}
+
+	zone, nameservers, err := c.FindZone(context.Background(), "example.com", "resolver:53")
+	if err != nil {
+		t.Fatalf("FindZone() error: %v", err)
+	}
+	if zone != "example.com." || !slices.Equal(nameservers, []string{"ns1.example.com."}) {
+		t.Errorf("FindZone() = %q, %v; want example.com., [ns1.example.com.]", zone, nameservers)
+	}
+
+	values, _, err := c.QueryServer(context.Background(), "192.0.2.53", "53", "example.com", TypeA, nil, 0)
+	if err != nil {
+		t.Fatalf("QueryServer() error: %v", err)
+	}
+	if !slices.Equal(values, []string{"192.0.2.1"}) {
+		t.Errorf("QueryServer() = %v, want [192.0.2.1]", values)
+	}
+}
+
+func TestCheckerAuditDelegation(t *testing.T) {
+	soa := reply(t,
+		"example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 2024010101 7200 3600 1209600 300",
+	)
+	ns := reply(t, "example.com. 300 IN NS ns1.example.com.", "example.com. 300 IN NS ns2.example.com.")
+	authoritative := func(msg *dns.Msg) *dns.Msg {
+		if msg.Question[0].Qtype == dns.TypeSOA {
+			return soa(msg)
+		}
+		return ns(msg)
+	}
+	c := &Checker{
+		Exchanger: fakeExchanger{
+			DefaultResolver: ns,
+			"192.0.2.1:53":  authoritative,
+			"192.0.2.2:53": func(msg *dns.Msg) *dns.Msg {
+				return new(dns.Msg).SetRcode(msg, dns.RcodeRefused)
+			},
+		},
+		HostResolver: fakeHosts{
+			"ns1.example.com.": {"192.0.2.1"},
+			"ns2.example.com.": {"192.0.2.2"},
+		},
+	}
+
+	audit, err := c.AuditDelegation(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("AuditDelegation() error: %v", err)
+	}
+	var statuses []AuditStatus
+	for _, s := range audit.Servers {
+		statuses = append(statuses, s.Status)
+	}
+	if want := []AuditStatus{AuditOK, AuditLame}; !slices.Equal(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+	if s := audit.Servers[0]; s.Serial != 2024010101 || !slices.Equal(s.NS, []string{"ns1.example.com.", "ns2.example.com."}) {
+		t.Errorf("first server = %+v, want serial 2024010101 and both nameservers", s)
+	}
+}
+
+func TestCheckerAuditAddressFamily(t *testing.T) {
+	soa := reply(t, "example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 2024010101 7200 3600 1209600 300")
+	c := NewChecker(
+		WithResolver("resolver:53"),
+		WithAddressFamily(FamilyIPv6),
+		WithExchanger(fakeExchanger{
+			"resolver:53":       reply(t, "example.com. 300 IN NS ns1.example.com."),
+			"[2001:db8::53]:53": soa,
+		}),
+		WithHostResolver(fakeHosts{"ns1.example.com.": {"192.0.2.53", "2001:db8::53"}}),
+	)
+
+	audit, err := c.AuditDelegation(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("AuditDelegation() error: %v", err)
+	}
+	if len(audit.Servers) != 1 || audit.Servers[0].Address != "2001:db8::53" {
+		t.Fatalf("AuditDelegation() servers = %+v, want only 2001:db8::53", audit.Servers)
+	}
+	primary, err := c.AuditPrimary(context.Background(), audit)
+	if err != nil {
+		t.Fatalf("AuditPrimary() error: %v", err)
+	}
+	if len(primary.Servers) != 1 || primary.Servers[0].Address != "2001:db8::53" {
+		t.Errorf("AuditPrimary() servers = %+v, want only 2001:db8::53", primary.Servers)
+	}
+}
+
+func TestCheckerAuditDelegationFallback(t *testing.T) {
+	c := NewChecker(
+		WithResolver("down:53", "resolver:53"),
+		WithExchanger(fakeExchanger{
+			"resolver:53":  reply(t, "example.com. 300 IN NS ns1.example.com."),
+			"192.0.2.1:53": reply(t, "example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 2024010101 7200 3600 1209600 300"),
+		}),
+		WithHostResolver(fakeHosts{"ns1.example.com.": {"192.0.2.1"}}),
+	)
+
+	audit, err := c.AuditDelegation(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("AuditDelegation() error: %v", err)
+	}
+	if len(audit.Servers) != 1 {
+		t.Errorf("Servers = %+v, want ns1 found through the fallback resolver", audit.Servers)
+	}
+}
+
+func TestNewChecker(t *testing.T) {
+	c := NewChecker(
+		WithResolver("resolver:53"),
+		WithAddressFamily(FamilyIPv6),
+		WithExchanger(fakeExchanger{
+			"resolver:53":       reply(t, "example.com. 300 IN NS ns1.example.com."),
+			"[2001:db8::53]:53": reply(t, "example.com. 300 IN A 192.0.2.1"),
+		}),
+		WithHostResolver(fakeHosts{"ns1.example.com.": {"192.0.2.53", "2001:db8::53"}}),
+	)
+
+	result, err := c.Check(context.Background(), CheckArgs{
+		Domain:     "example.com",
+		RecordType: TypeA,
+		Expected:   []string{"192.0.2.1"},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if ok, _ := result.Match(); !ok || len(result.Servers) != 1 || result.Servers[0].Address != "2001:db8::53" {
+		t.Errorf("Check() = %+v, want a match from 2001:db8::53 only", result)
+	}
+}
+
+func TestNewCheckerExplicitIPv4(t *testing.T) {
+	c := NewChecker(
+		WithResolver("resolver:53"),
+		WithAddressFamily(FamilyIPv6),
+		WithExchanger(fakeExchanger{
+			"resolver:53":   reply(t, "example.com. 300 IN NS ns1.example.com."),
+			"192.0.2.53:53": reply(t, "example.com. 300 IN A 192.0.2.1"),
+		}),
+		WithHostResolver(fakeHosts{"ns1.example.com.": {"192.0.2.53", "2001:db8::53"}}),
+	)
+
+	result, err := c.Check(context.Background(), CheckArgs{
+		Domain:        "example.com",
+		RecordType:    TypeA,
+		Expected:      []string{"192.0.2.1"},
+		AddressFamily: FamilyIPv4,
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if ok, _ := result.Match(); !ok || len(result.Servers) != 1 || result.Servers[0].Address != "192.0.2.53" {
+		t.Errorf("Check() = %+v, want a match from 192.0.2.53 only", result)
+	}
+}
+
+func TestNewCheckerWithClient(t *testing.T) {
+	answer := reply(t, "example.com. 300 IN A 192.0.2.1")
+	addr := startTestServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answer(r))
+	})
+	host, port, _ := net.SplitHostPort(addr)
+
+	c := NewChecker(WithClient(&dns.Client{Timeout: time.Second}))
+	values, _, err := c.QueryServer(context.Background(), host, port, "example.com", TypeA, nil, 0)
+	if err != nil {
+		t.Fatalf("QueryServer() error: %v", err)
+	}
+	if !slices.Equal(values, []string{"192.0.2.1"}) {
+		t.Errorf("QueryServer() = %v, want [192.0.2.1]", values)
+	}
+}
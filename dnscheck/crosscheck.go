@@ -0,0 +1,94 @@
+package dnscheck
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ResolverDelegation is one resolver's view of a domain's delegation.
+type ResolverDelegation struct {
+	Resolver    string
+	Zone        string
+	Nameservers []string
+}
+
+// DelegationMismatchError is returned when resolvers disagree about which
+// zone a domain belongs to or which nameservers serve it.
+type DelegationMismatchError struct {
+	Domain string
+	Views  []ResolverDelegation
+}
+
+func (e *DelegationMismatchError) Error() string {
+	var views []string
+	for _, v := range e.Views {
+		views = append(views, fmt.Sprintf("%s: %s [%s]", v.Resolver, v.Zone, strings.Join(v.Nameservers, ", ")))
+	}
+	return fmt.Sprintf("resolvers disagree on delegation for %s: %s", e.Domain, strings.Join(views, "; "))
+}
+
+// CrossCheckNameservers is like FindZone but asks every resolver in
+// resolvers and confirms they agree on the zone and nameserver set. This
+// catches a resolver serving a stale or poisoned delegation. If they
+// disagree it returns a *DelegationMismatchError describing each view.
+func CrossCheckNameservers(ctx context.Context, domain string, resolvers []string) (string, []string, error) {
+	return defaultChecker.CrossCheckNameservers(ctx, domain, resolvers)
+}
+
+// CrossCheckNameservers is like the package-level CrossCheckNameservers but
+// uses c.
+func (c *Checker) CrossCheckNameservers(ctx context.Context, domain string, resolvers []string) (string, []string, error) {
+	d, err := crossCheckZone(ctx, c.resolverExchanger(), domain, resolvers)
+	if err != nil {
+		return "", nil, err
+	}
+	return d.zone, d.nameservers, nil
+}
+
+// crossCheckZone runs findZone against each resolver and returns the first
+// resolver's delegation if they all agree.
+func crossCheckZone(ctx context.Context, ex Exchanger, domain string, resolvers []string) (*delegation, error) {
+	if len(resolvers) == 0 {
+		return nil, fmt.Errorf("no resolvers to cross-check")
+	}
+
+	var first *delegation
+	var views []ResolverDelegation
+	agree := true
+	for _, resolver := range resolvers {
+		d, err := findZone(ctx, ex, domain, resolver)
+		if err != nil {
+			return nil, fmt.Errorf("resolver %s: %w", resolver, err)
+		}
+		views = append(views, ResolverDelegation{Resolver: resolver, Zone: d.zone, Nameservers: d.nameservers})
+		if first == nil {
+			first = d
+		} else if !sameDelegation(first, d) {
+			agree = false
+		}
+	}
+	if !agree {
+		return nil, &DelegationMismatchError{Domain: domain, Views: views}
+	}
+	return first, nil
+}
+
+// sameDelegation reports whether a and b name the same zone and the same
+// set of nameservers, ignoring order, case, and trailing dots.
+func sameDelegation(a, b *delegation) bool {
+	return strings.EqualFold(a.zone, b.zone) && slices.Equal(nameserverSet(a.nameservers), nameserverSet(b.nameservers))
+}
+
+// nameserverSet returns the normalized, sorted nameserver hostnames.
+func nameserverSet(nameservers []string) []string {
+	set := make([]string, len(nameservers))
+	for i, ns := range nameservers {
+		set[i] = strings.ToLower(dns.Fqdn(ns))
+	}
+	slices.Sort(set)
+	return set
+}
@@ -0,0 +1,45 @@
+package dnscheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCrossCheckZone(t *testing.T) {
+	exchanger := fakeExchanger{
+		"a:53": reply(t,
+			"example.com. 300 IN NS ns1.example.com.",
+			"example.com. 300 IN NS ns2.example.com.",
+		),
+		"b:53": reply(t,
+			"example.com. 300 IN NS NS2.example.com",
+			"example.com. 300 IN NS ns1.example.com.",
+		),
+		"stale:53": reply(t,
+			"example.com. 300 IN NS ns1.example.com.",
+			"example.com. 300 IN NS old.example.net.",
+		),
+	}
+
+	d, err := crossCheckZone(context.Background(), exchanger, "example.com", []string{"a:53", "b:53"})
+	if err != nil {
+		t.Fatalf("crossCheckZone() error: %v", err)
+	}
+	if d.zone != "example.com." || len(d.nameservers) != 2 {
+		t.Errorf("crossCheckZone() = %+v", d)
+	}
+
+	_, err = crossCheckZone(context.Background(), exchanger, "example.com", []string{"a:53", "stale:53"})
+	var mismatch *DelegationMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("crossCheckZone() error = %v, want *DelegationMismatchError", err)
+	}
+	if len(mismatch.Views) != 2 || mismatch.Views[1].Resolver != "stale:53" {
+		t.Errorf("Views = %+v", mismatch.Views)
+	}
+
+	if _, err := crossCheckZone(context.Background(), exchanger, "example.com", []string{"a:53", "down:53"}); err == nil {
+		t.Error("crossCheckZone() with a failing resolver succeeded, want error")
+	}
+}
@@ -0,0 +1,73 @@
+package dnscheck
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// digCommand returns the dig command line that sends the same query as msg
+// to address (host:port), e.g. "dig @1.1.1.1 one.one.one.one. A +norecurse".
+// Options that match dig's defaults are omitted. A "tls://" address adds
+// +tls and an "https://" URL adds +https.
+func digCommand(msg *dns.Msg, address string, tcp bool) string {
+	defaultPort, protocol := "53", ""
+	if tcp {
+		protocol = "+tcp"
+	}
+	if hostport, _, ok := parseTLSAddress(address); ok {
+		address, defaultPort, protocol = hostport, "853", "+tls"
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, defaultPort
+	}
+	if u, err := url.Parse(address); err == nil && isDoHAddress(address) {
+		host, port, defaultPort, protocol = u.Hostname(), cmp.Or(u.Port(), "443"), "443", "+https"
+		if u.Path != "/dns-query" {
+			protocol += "=" + u.Path
+		}
+	}
+
+	parts := []string{"dig", "@" + host}
+	if port != defaultPort {
+		parts = append(parts, "-p", port)
+	}
+	for _, q := range msg.Question {
+		parts = append(parts, q.Name, dns.TypeToString[q.Qtype])
+	}
+	if !msg.RecursionDesired {
+		parts = append(parts, "+norecurse")
+	}
+	if opt := msg.IsEdns0(); opt != nil && opt.Do() {
+		parts = append(parts, "+dnssec")
+	}
+	if protocol != "" {
+		parts = append(parts, protocol)
+	}
+	return strings.Join(parts, " ")
+}
+
+// digExchanger writes the equivalent dig command for every query to w before
+// passing it on. Writes are serialized since queries run concurrently.
+type digExchanger struct {
+	Exchanger
+	mu  *sync.Mutex
+	w   io.Writer
+	tcp bool
+}
+
+func (d digExchanger) Exchange(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+	d.mu.Lock()
+	fmt.Fprintln(d.w, digCommand(msg, address, d.tcp))
+	d.mu.Unlock()
+	return d.Exchanger.Exchange(ctx, msg, address)
+}
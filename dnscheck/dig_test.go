@@ -0,0 +1,57 @@
+package dnscheck
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestDigCommand(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.SetQuestion("one.one.one.one.", dns.TypeA)
+	msg.RecursionDesired = false
+
+	signed := new(dns.Msg)
+	signed.SetQuestion("example.com.", dns.TypeTXT)
+	signed.SetEdns0(4096, true)
+
+	tests := []struct {
+		name    string
+		msg     *dns.Msg
+		address string
+		tcp     bool
+		want    string
+	}{
+		{"norecurse", msg, "1.1.1.1:53", false, "dig @1.1.1.1 one.one.one.one. A +norecurse"},
+		{"ipv6 and port", msg, "[2001:db8::1]:5353", true, "dig @2001:db8::1 -p 5353 one.one.one.one. A +norecurse +tcp"},
+		{"dnssec", signed, "192.0.2.53:53", false, "dig @192.0.2.53 example.com. TXT +dnssec"},
+		{"dns over tls", msg, "tls://1.1.1.1", false, "dig @1.1.1.1 one.one.one.one. A +norecurse +tls"},
+		{"dns over tls and port", msg, "tls://dns.example.net:8853", false, "dig @dns.example.net -p 8853 one.one.one.one. A +norecurse +tls"},
+		{"dns over https", msg, "https://dns.google/dns-query", false, "dig @dns.google one.one.one.one. A +norecurse +https"},
+		{"dns over https path and port", msg, "https://doh.example.net:8443/resolve", false, "dig @doh.example.net -p 8443 one.one.one.one. A +norecurse +https=/resolve"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := digCommand(tt.msg, tt.address, tt.tcp); got != tt.want {
+				t.Errorf("digCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDigOutput(t *testing.T) {
+	var out bytes.Buffer
+	ex := CheckArgs{
+		Exchanger: fakeExchanger{"192.0.2.1:53": reply(t, "example.com. 300 IN A 192.0.2.100")},
+		DigOutput: &out,
+	}.exchanger()
+
+	if _, err := queryServer(context.Background(), ex, "192.0.2.1", "53", "example.com", TypeA, false); err != nil {
+		t.Fatalf("queryServer() error: %v", err)
+	}
+	if want := "dig @192.0.2.1 example.com. A\n"; out.String() != want {
+		t.Errorf("DigOutput = %q, want %q", out.String(), want)
+	}
+}
@@ -2,77 +2,157 @@ package dnscheck
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/miekg/dns"
 )
 
-// DefaultResolver is the recursive resolver used when CheckArgs.Resolver is empty.
+// DefaultResolver is the recursive resolver used when CheckArgs.Resolver is
+// empty, unless CheckArgs.SystemResolver is set.
 var DefaultResolver = "8.8.8.8:53"
 
-var dnsClient = &dns.Client{}
+// DefaultConcurrency is the number of server addresses queried at once when
+// CheckArgs.Concurrency is zero.
+const DefaultConcurrency = 8
 
-var dnsTCPClient = &dns.Client{
-	Net: "tcp",
-}
-
-// exchange sends a DNS query, falling back to TCP if UDP fails.
-func exchange(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
-	response, _, err := dnsClient.ExchangeContext(ctx, msg, address)
-	if err != nil {
-		response, _, err = dnsTCPClient.ExchangeContext(ctx, msg, address)
-	}
-	return response, err
-}
+// retryBackoff is the wait before the first retry of a query; it doubles
+// with each further retry.
+const retryBackoff = 50 * time.Millisecond
 
 // RecordType wraps a DNS record type so callers don't need to import miekg/dns.
 type RecordType uint16
 
 const (
-	TypeA     RecordType = RecordType(dns.TypeA)
-	TypeAAAA  RecordType = RecordType(dns.TypeAAAA)
-	TypeCNAME RecordType = RecordType(dns.TypeCNAME)
-	TypeTXT   RecordType = RecordType(dns.TypeTXT)
-	TypeMX    RecordType = RecordType(dns.TypeMX)
+	TypeA      RecordType = RecordType(dns.TypeA)
+	TypeAAAA   RecordType = RecordType(dns.TypeAAAA)
+	TypeCNAME  RecordType = RecordType(dns.TypeCNAME)
+	TypeTXT    RecordType = RecordType(dns.TypeTXT)
+	TypeMX     RecordType = RecordType(dns.TypeMX)
+	TypeNS     RecordType = RecordType(dns.TypeNS)
+	TypeSOA    RecordType = RecordType(dns.TypeSOA)
+	TypePTR    RecordType = RecordType(dns.TypePTR)
+	TypeSRV    RecordType = RecordType(dns.TypeSRV)
+	TypeCAA    RecordType = RecordType(dns.TypeCAA)
+	TypeAFSDB  RecordType = RecordType(dns.TypeAFSDB)
+	TypeRT     RecordType = RecordType(dns.TypeRT)
+	TypeTLSA   RecordType = RecordType(dns.TypeTLSA)
+	TypeDS     RecordType = RecordType(dns.TypeDS)
+	TypeDNSKEY RecordType = RecordType(dns.TypeDNSKEY)
 )
 
 func (t RecordType) String() string {
-	switch t {
-	case TypeA:
-		return "A"
-	case TypeAAAA:
-		return "AAAA"
-	case TypeCNAME:
-		return "CNAME"
-	case TypeTXT:
-		return "TXT"
-	case TypeMX:
-		return "MX"
-	default:
-		return fmt.Sprintf("UNKNOWN(%d)", uint16(t))
+	if info, ok := recordTypes[t]; ok {
+		return info.name
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", uint16(t))
+}
+
+// ReverseName returns the in-addr.arpa or ip6.arpa name for a PTR lookup of
+// name if it is an IP address literal, and name unchanged otherwise.
+func ReverseName(name string) string {
+	if net.ParseIP(name) == nil {
+		return name
+	}
+	reverse, err := dns.ReverseAddr(name)
+	if err != nil {
+		return name
+	}
+	return reverse
+}
+
+// NormalizeDomain cleans up a domain name as a user might paste it: it trims
+// whitespace, takes the host from a URL such as "https://example.com/path",
+// drops a port, a path and the trailing dot, and lowercases the result. It
+// returns an error if what remains isn't a plausible hostname: dot-separated
+// labels of letters, digits, hyphens and underscores, with no label longer
+// than 63 characters. A leading "*" label, for checking a wildcard record,
+// is allowed.
+func NormalizeDomain(domain string) (string, error) {
+	name := strings.TrimSpace(domain)
+	if strings.Contains(name, "://") {
+		u, err := url.Parse(name)
+		if err != nil {
+			return "", fmt.Errorf("invalid domain name %q: %w", domain, err)
+		}
+		name = u.Hostname()
+	} else {
+		name, _, _ = strings.Cut(name, "/")
+		if host, _, err := net.SplitHostPort(name); err == nil {
+			name = host
+		}
+	}
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	if name == "" {
+		return "", fmt.Errorf("invalid domain name %q: no hostname", domain)
+	}
+	if len(name) > 253 {
+		return "", fmt.Errorf("invalid domain name %q: longer than 253 characters", domain)
+	}
+	for i, label := range strings.Split(name, ".") {
+		if i == 0 && label == "*" {
+			continue
+		}
+		if label == "" {
+			return "", fmt.Errorf("invalid domain name %q: empty label", domain)
+		}
+		if len(label) > 63 {
+			return "", fmt.Errorf("invalid domain name %q: label %q is longer than 63 characters", domain, label)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return "", fmt.Errorf("invalid domain name %q: %q isn't allowed in a hostname", domain, r)
+			}
+		}
 	}
+	return name, nil
 }
 
 // ParseRecordType maps a string like "A" or "aaaa" to a RecordType.
 func ParseRecordType(value string) (RecordType, error) {
-	switch strings.ToUpper(value) {
-	case "A":
-		return TypeA, nil
-	case "AAAA":
-		return TypeAAAA, nil
-	case "CNAME":
-		return TypeCNAME, nil
-	case "TXT":
-		return TypeTXT, nil
-	case "MX":
-		return TypeMX, nil
-	default:
-		return 0, fmt.Errorf("unsupported record type: %q", value)
+	for t, info := range recordTypes {
+		if strings.EqualFold(value, info.name) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported record type: %q", value)
+}
+
+// Rcode wraps a DNS response code so callers don't need to import miekg/dns.
+type Rcode int
+
+const (
+	RcodeSuccess  Rcode = dns.RcodeSuccess
+	RcodeServFail Rcode = dns.RcodeServerFailure
+	RcodeNXDomain Rcode = dns.RcodeNameError
+	RcodeRefused  Rcode = dns.RcodeRefused
+)
+
+func (r Rcode) String() string {
+	if s, ok := dns.RcodeToString[int(r)]; ok {
+		return s
+	}
+	return fmt.Sprintf("RCODE%d", int(r))
+}
+
+// ParseRcode maps a string like "NXDOMAIN" or "refused" to an Rcode.
+func ParseRcode(value string) (Rcode, error) {
+	if rcode, ok := dns.StringToRcode[strings.ToUpper(value)]; ok {
+		return Rcode(rcode), nil
 	}
+	return 0, fmt.Errorf("unsupported rcode: %q", value)
 }
 
 // CheckArgs holds the parameters for a DNS propagation check.
@@ -80,8 +160,307 @@ type CheckArgs struct {
 	Domain     string
 	RecordType RecordType
 	Expected   []string
-	Resolver   string      // defaults to "8.8.8.8:53" if empty
+	Resolver   string       // defaults to DefaultResolver if empty (see SystemResolver); "tls://host[:port]" for DNS over TLS, or an "https://" URL for DNS over HTTPS
 	Logger     *slog.Logger // optional; discards logs if nil
+
+	// RequestID, if set, is added to every line the check logs as
+	// request_id, so the lines of concurrent checks sharing a Logger, as in
+	// a service, can be told apart.
+	RequestID string
+
+	// CheckSignatures sends queries with the DNSSEC OK (DO) bit set and
+	// requires each server to return an RRSIG whose type covered and label
+	// count are consistent with the answer. Servers returning missing or
+	// mismatched signatures are marked as not matching. This is useful for
+	// catching partial signing rollouts across a fleet of servers.
+	CheckSignatures bool
+
+	// ValidateDNSSEC validates each server's answer: the zone's DS records
+	// are fetched through Resolver, each server's DNSKEY set must be signed
+	// by a key matching them, and the answer's RRSIG must verify with one of
+	// its keys. A server whose answer is bogus is marked as not matching,
+	// even if its values are correct. The result is recorded in
+	// ServerResult.DNSSECStatus. Check fails if the zone has no DS records.
+	ValidateDNSSEC bool
+
+	// DNSSEC advertises EDNS0 with a 4096-byte buffer and the DNSSEC OK (DO)
+	// bit on every query, including nameserver discovery, and records the
+	// RRSIGs each server returns in ServerResult.Signatures. Unlike
+	// CheckSignatures, it doesn't affect Match.
+	DNSSEC bool
+
+	// LocalPort binds the UDP and TCP sockets used for every query to this
+	// local port, for networks where egress DNS is only permitted from a
+	// fixed source port. Zero uses an ephemeral port.
+	LocalPort int
+
+	// ForceTCP sends every query over TCP instead of trying UDP first,
+	// including those used to discover the nameservers. This trades latency,
+	// since each query needs a TCP handshake, for reliability on networks
+	// where middleboxes drop or mangle UDP DNS.
+	ForceTCP bool
+
+	// Port is the port the authoritative nameservers are queried on, e.g.
+	// "5353" for a local test server. It defaults to "53". The recursive
+	// resolver's port is given in Resolver.
+	Port string
+
+	// MinNSTTL, if set, also queries each server for the zone's NS records
+	// and marks the server as not matching if any NS record's TTL is below
+	// this minimum. Short NS TTLs cause excess load and slow failover.
+	MinNSTTL time.Duration
+
+	// AcceptRcodes lists response codes that count as a pass when the
+	// server returns them with an empty answer, for servers known to
+	// intentionally refuse or deny a query. NOERROR responses are always
+	// compared against Expected as usual, so listing RcodeSuccess has no
+	// effect. By default no other rcode is accepted.
+	AcceptRcodes []Rcode
+
+	// DetectSpoofing reports responses that don't correspond to the query
+	// sent, such as a mismatched query ID or question, as ErrSpoofedResponse
+	// instead of silently retrying over TCP. Query IDs are always random,
+	// so a mismatch indicates an off-path injection attempt or a broken
+	// resolver.
+	DetectSpoofing bool
+
+	// AnswerFilter, if set, is called for each record in a server's answer
+	// section; records for which it returns false are dropped before values
+	// are extracted. The filter sees the raw records, so it can inspect TTLs
+	// or other fields that aren't part of the value. Matching against
+	// Expected (case-insensitive, FQDN-aware) is applied afterwards to the
+	// values of the records that remain.
+	AnswerFilter func(dns.RR) bool
+
+	// RequireCAA lists CAA properties, as "tag value" (e.g. "issue
+	// letsencrypt.org"), that every server must return regardless of flags
+	// or other records. If Expected is empty, only these requirements are
+	// checked; otherwise the full set must also match Expected.
+	RequireCAA []string
+
+	// ExpectedByServer overrides Expected for individual servers, for
+	// split-horizon or geo-DNS setups where authoritative servers
+	// intentionally return different answers. Keys are either a nameserver
+	// hostname (matched case-insensitively, with or without a trailing dot)
+	// or a server address; an address entry takes precedence over a
+	// hostname entry. Servers without an entry are compared against
+	// Expected.
+	ExpectedByServer map[string][]string
+
+	// ExpectedFromName, if set, is a reference name that is resolved
+	// through Resolver before the check. Its records of RecordType are
+	// added to Expected, so the check passes if every server returns the
+	// same set as the reference, e.g. a load balancer hostname.
+	ExpectedFromName string
+
+	// ExpectedFromPrimary, if set, queries the zone's primary nameserver,
+	// the MNAME of its SOA record, before the other servers and adds its
+	// records of RecordType to Expected, so the check passes if every
+	// server is in sync with the primary. The primary is queried even if it
+	// isn't one of the zone's NS records, and the check returns an error if
+	// it can't be reached or isn't authoritative for the zone. It can't be
+	// used with MatchRegex.
+	ExpectedFromPrimary bool
+
+	// Retries is the number of times to retry a server's query after a
+	// transient failure, i.e. an error or an empty answer when records were
+	// expected, waiting retryBackoff and then twice as long each time.
+	Retries int
+
+	// PerQueryTimeout, if set, bounds each individual query, including
+	// those used to discover the nameservers, so that an unresponsive server
+	// fails fast and the others still get answered. The context passed to
+	// Check remains a ceiling on the whole check.
+	PerQueryTimeout time.Duration
+
+	// AddressFamily selects which of each nameserver's addresses are
+	// queried. The zero value, FamilyDefault, queries IPv4 addresses only,
+	// unless the Checker running the check sets another family. With
+	// FamilyBoth, each IPv4 and IPv6 address gets its own ServerResult, so
+	// differences between the two are caught.
+	AddressFamily AddressFamily
+
+	// Concurrency is the maximum number of server addresses queried at
+	// once. Zero uses DefaultConcurrency. Queries are always sequential when
+	// LocalPort is set, since only one socket can be bound to the port.
+	Concurrency int
+
+	// MaxServers, if positive, caps the number of server addresses queried.
+	// Addresses are sampled round-robin across nameservers so that each
+	// nameserver is represented before any gets a second address. This
+	// bounds runtime for a quick confidence check of a large deployment.
+	MaxServers int
+
+	// CheckTXTSize reports TXT records with character-strings near the
+	// 255-byte limit, or responses too large for a 512-byte UDP message, in
+	// ServerResult.TXTSizeWarnings.
+	CheckTXTSize bool
+
+	// SplitTXTStrings makes each character-string of a TXT record a
+	// separate value. By default a record's strings are concatenated into
+	// one value, which is right for long records such as DKIM keys that are
+	// split only to fit the 255-byte string limit, but not for records whose
+	// strings are independent.
+	SplitTXTStrings bool
+
+	// TXTPrefix, if set, drops the TXT records whose value doesn't start
+	// with it, compared case-insensitively, before comparison, e.g.
+	// "v=spf1" to check a domain's SPF record without listing its other TXT
+	// records. The records that remain are still compared as MatchMode
+	// says, so by default a server passes only if its records with the
+	// prefix are exactly Expected: a second SPF record fails the check. The
+	// records of ExpectedFromName and ExpectedFromPrimary are filtered the
+	// same way. It can only be used with TypeTXT.
+	TXTPrefix string
+
+	// IgnoreMXPreference compares only the hosts of MX records, dropping
+	// the preferences from the expected values and the servers' answers. MX values are otherwise
+	// "preference host", e.g. "10 mail.example.com.", and compared in full
+	// unless every expected value is a bare host. It can only be used with
+	// TypeMX, and not with MatchRegex, whose patterns see the preferences.
+	IgnoreMXPreference bool
+
+	// CrossCheckResolvers, if set, are additional recursive resolvers that
+	// are asked for the domain's NS records alongside Resolver. Check fails
+	// with a *DelegationMismatchError unless they all agree on the zone and
+	// nameserver set.
+	CrossCheckResolvers []string
+
+	// Nameservers, if set, are the servers to check instead of those found
+	// through Resolver, e.g. a new provider's servers before the delegation
+	// is moved to them. Each is a hostname, resolved as usual, or an IP
+	// address, queried directly whatever AddressFamily is. The zone isn't
+	// looked up, so CheckResult.Zone is empty, CNAMEs at the zone apex
+	// aren't detected, and the checks that need the zone, ValidateDNSSEC,
+	// MinNSTTL, ExpectedFromPrimary, CrossCheckResolvers and an ApexCNAME
+	// policy other than ApexCNAMEWarn, can't be used. Hostnames are
+	// compared case-insensitively and duplicates are dropped; IPv6
+	// addresses may be given in brackets.
+	Nameservers []string
+
+	// DigOutput, if set, receives the equivalent dig command line for every
+	// query sent, one per line, so queries can be reproduced by hand. The
+	// commands assume UDP. Writes from one check are serialized, but a
+	// writer shared by checks run concurrently must be safe for concurrent
+	// use.
+	DigOutput io.Writer
+
+	// Exchanger, if set, sends every DNS query in place of the built-in
+	// UDP/TCP client, e.g. to run checks against canned responses in tests.
+	// LocalPort and DetectSpoofing have no effect when it is set.
+	Exchanger Exchanger
+
+	// FallbackResolvers are recursive resolvers tried in order when a query
+	// to Resolver fails, e.g. because it is down. If they all fail, the
+	// error wraps a *ResolverError listing each failure.
+	FallbackResolvers []string
+
+	// SystemResolver, when Resolver is empty, uses the first nameserver in
+	// /etc/resolv.conf instead of DefaultResolver, so checks go through the
+	// resolvers the host is configured with. DefaultResolver is still used
+	// if the file is missing or lists no nameservers.
+	SystemResolver bool
+
+	// HostResolver, if set, resolves nameserver hostnames to addresses in
+	// place of net.DefaultResolver. Nameservers whose addresses were given
+	// as in-zone glue in the NS response aren't resolved, except in a family
+	// the glue has no addresses in.
+	HostResolver HostResolver
+
+	// Cache, if set, answers the check's queries to recursive resolvers,
+	// such as the NS lookups, from earlier checks while their TTLs last.
+	// Queries to the authoritative servers being checked don't use it.
+	Cache *Cache
+
+	// RateLimiter, if set, throttles every query the check sends, including
+	// those to recursive resolvers that the Cache doesn't answer. Share one
+	// between checks to limit them all together.
+	RateLimiter *RateLimiter
+
+	// OnResult, if set, is called with each server's result as soon as it
+	// is known, e.g. to show progress while a check of many servers runs.
+	// It is called from the goroutines querying the servers, so it may be
+	// called concurrently and must be safe for that. It is for observation
+	// only; the same results are in the CheckResult that Check returns.
+	OnResult func(ServerResult)
+
+	// Trace, if set, records every query Check sends, to the resolver and
+	// to the servers being checked, and every nameserver hostname it looks
+	// up, in CheckResult.Trace in the order they complete. Queries answered
+	// from Cache aren't sent, so they aren't recorded.
+	Trace bool
+
+	// OnTrace, if set, is called with each step Trace would record as soon
+	// as it completes, so the steps are seen even if Check returns an
+	// error. Calls are serialized.
+	OnTrace func(TraceStep)
+
+	// ApexCNAME controls what happens when a server returns a CNAME at the
+	// zone apex, which is never valid. Defaults to ApexCNAMEWarn.
+	ApexCNAME ApexCNAMEPolicy
+
+	// MatchMode selects how each server's values are compared with the
+	// expected values. The zero value, MatchExact, requires exactly the
+	// expected set.
+	MatchMode MatchMode
+
+	// RequireEveryPattern, with MatchRegex, also requires every pattern to
+	// match at least one of a server's values.
+	RequireEveryPattern bool
+}
+
+// ApexCNAMEPolicy selects how Check handles a CNAME at the zone apex.
+type ApexCNAMEPolicy int
+
+const (
+	// ApexCNAMEWarn records the CNAME target on ServerResult.ApexCNAME and
+	// logs a warning, but otherwise compares the answer as usual.
+	ApexCNAMEWarn ApexCNAMEPolicy = iota
+	// ApexCNAMEError marks the server as failed.
+	ApexCNAMEError
+	// ApexCNAMEFollow compares the records the CNAME points to. If the
+	// server did not include them in the answer, the target is resolved
+	// through the recursive resolver.
+	ApexCNAMEFollow
+)
+
+// MatchMode selects how Check compares a server's values with the expected
+// values.
+type MatchMode int
+
+const (
+	// MatchExact requires the server to return exactly the expected set of
+	// values, in any order. It is the default.
+	MatchExact MatchMode = iota
+	// MatchSubset requires every expected value to be present but allows
+	// the server to return additional values, e.g. while records are being
+	// added incrementally.
+	MatchSubset
+	// MatchAbsent treats the expected values as values that must not
+	// appear, e.g. an old address being removed during a migration. A
+	// server passes if it returns none of them.
+	MatchAbsent
+	// MatchRegex treats each expected value as a regular expression that
+	// must match a whole value, e.g. "google-site-verification=.*" for a
+	// rotating token. A server passes if it returns at least one value and
+	// every value matches some pattern. See also
+	// CheckArgs.RequireEveryPattern.
+	MatchRegex
+)
+
+func (m MatchMode) String() string {
+	switch m {
+	case MatchExact:
+		return "exact"
+	case MatchSubset:
+		return "subset"
+	case MatchAbsent:
+		return "absent"
+	case MatchRegex:
+		return "regex"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", int(m))
+	}
 }
 
 // ServerResult holds the result of querying a single nameserver IP.
@@ -89,8 +468,76 @@ type ServerResult struct {
 	Nameserver string
 	Address    string
 	Values     []string
-	Match      bool
-	Error      error
+
+	// OtherNameservers lists the other nameservers whose hostnames
+	// resolved to Address too, as with anycast providers. The address is
+	// queried and counted once, under the first nameserver listed.
+	OtherNameservers []string
+
+	// Signatures holds the RRSIG records in the server's answer, without
+	// their headers. It is only set when CheckArgs.DNSSEC is enabled.
+	Signatures []string
+
+	// TTLs holds the TTL of each record in Values, in the same order, to
+	// show how long a stale answer may stay in resolvers' caches. It
+	// doesn't affect Match.
+	TTLs []uint32
+
+	// AddressFamily is the family (FamilyIPv4 or FamilyIPv6) of Address,
+	// i.e. the transport the server was reached over. It is only
+	// meaningful when Address is set.
+	AddressFamily AddressFamily
+
+	Rcode Rcode
+	Match bool
+	Error error
+
+	// Latency is how long the server took to respond, or to fail. It is
+	// zero if the server was never queried.
+	Latency time.Duration
+
+	// Lame is set when the server answered without authority, i.e.
+	// without the AA bit or with REFUSED, which means it doesn't serve the
+	// zone even though it is delegated to. A lame server doesn't match.
+	Lame bool
+
+	// Missing holds the expected values the server didn't return, and
+	// Unexpected the values it returned that weren't expected, compared as
+	// for Match. With MatchSubset only Missing is set; with MatchAbsent,
+	// Unexpected holds the values that should have been removed. Neither is
+	// set with MatchRegex or without expected values.
+	Missing    []string
+	Unexpected []string
+
+	// CNAME is the target of a CNAME the server returned for the domain
+	// when another record type was checked. Values only holds records of the
+	// checked type, so CNAMEs never take part in the comparison; for an
+	// in-zone target they are the target's records, which the server
+	// includes in the answer.
+	CNAME string
+
+	// ApexCNAME is the target of a CNAME the server returned at the zone
+	// apex, if any.
+	ApexCNAME string
+
+	// SignatureError is set when CheckArgs.CheckSignatures is enabled and
+	// the server's answer is missing a consistent RRSIG.
+	SignatureError error
+
+	// DNSSECStatus and DNSSECError record the outcome of validation when
+	// CheckArgs.ValidateDNSSEC is enabled. DNSSECError is set when the
+	// status is DNSSECBogus.
+	DNSSECStatus DNSSECStatus
+	DNSSECError  error
+
+	// NSTTLError is set when CheckArgs.MinNSTTL is enabled and the server
+	// returned NS records with a TTL below the minimum.
+	NSTTLError error
+
+	// TXTSizeWarnings describes TXT records likely to cause truncation or
+	// resolution problems for some clients. It is only set when
+	// CheckArgs.CheckTXTSize is enabled, and doesn't affect Match.
+	TXTSizeWarnings []string
 }
 
 // CheckResult holds the full result of a DNS propagation check.
@@ -98,14 +545,48 @@ type CheckResult struct {
 	Domain      string
 	RecordType  RecordType
 	Expected    []string
+	MatchMode   MatchMode
+	Zone        string // zone apex the nameservers are authoritative for
 	Nameservers []string
 	Servers     []ServerResult
+
+	// ExpectedByServer holds the per-server overrides of Expected, if any.
+	ExpectedByServer map[string][]string
+
+	// Primary is the primary nameserver whose records were added to
+	// Expected when CheckArgs.ExpectedFromPrimary is set.
+	Primary string
+
+	// SampledFrom is the number of server addresses found before sampling
+	// down to CheckArgs.MaxServers. It is zero if no sampling took place.
+	SampledFrom int
+
+	// DuplicateNameservers is the number of duplicate NS records that were
+	// dropped from Nameservers during discovery.
+	DuplicateNameservers int
+
+	// Duration is how long the check took, from nameserver discovery until
+	// the last server answered.
+	Duration time.Duration
+
+	// Trace holds every query and hostname lookup made during the check,
+	// when CheckArgs.Trace is set.
+	Trace []TraceStep
+
+	// Err is set on the partial result Check returns, along with the same
+	// error, when a lookup it needed before querying the servers failed,
+	// such as finding the nameservers. The fields filled in are those known
+	// by then; Servers is empty.
+	Err error
 }
 
 // Match reports whether every server returned the expected records.
 // On success it returns true with an empty string. On failure it returns
 // false with a short description of what went wrong.
 func (r *CheckResult) Match() (bool, string) {
+	if r.Err != nil {
+		return false, fmt.Sprintf("%s: %v", r.Domain, r.Err)
+	}
 	if len(r.Servers) == 0 {
 		return false, fmt.Sprintf("%s: no servers responded", r.Domain)
 	}
@@ -125,177 +606,1622 @@ func (r *CheckResult) Match() (bool, string) {
 	}
 
 	total := len(r.Servers)
-	return false, fmt.Sprintf("%s: %d of %d servers returned unexpected %s records", r.Domain, failed, total, r.RecordType)
+	if r.MatchMode == MatchAbsent {
+		if errors > 0 {
+			return false, fmt.Sprintf("%s: %d of %d servers failed or still return the old %s record", r.Domain, failed, total, r.RecordType)
+		}
+		return false, fmt.Sprintf("%s: %d of %d servers still return the old %s record", r.Domain, failed, total, r.RecordType)
+	}
+	reason := fmt.Sprintf("%s: %d of %d servers returned unexpected %s records", r.Domain, failed, total, r.RecordType)
+	if breakdown := r.failureBreakdown(); breakdown != "" {
+		reason += " (" + breakdown + ")"
+	}
+	return false, reason
+}
+
+// failureBreakdown summarizes the failing servers that are lame, and those
+// that returned no records by response code, e.g. "2 not authoritative for
+// the zone, 3 returned NXDOMAIN, 1 returned no records", so that a broken or
+// half-configured delegation is easy to tell from stale values. It returns
+// an empty string if there are none.
+func (r *CheckResult) failureBreakdown() string {
+	var lame int
+	counts := make(map[Rcode]int)
+	for _, s := range r.Servers {
+		switch {
+		case s.Error != nil || s.Match:
+		case s.Lame:
+			lame++
+		case len(s.Values) == 0:
+			counts[s.Rcode]++
+		}
+	}
+
+	var parts []string
+	if lame > 0 {
+		parts = append(parts, fmt.Sprintf("%d not authoritative for the zone", lame))
+	}
+	for _, rcode := range slices.Sorted(maps.Keys(counts)) {
+		if rcode == RcodeSuccess {
+			parts = append(parts, fmt.Sprintf("%d returned no records", counts[rcode]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d returned %s", counts[rcode], rcode))
+		}
+	}
+	return strings.Join(parts, ", ")
 }
 
 // FindNameservers walks up the domain tree to find the zone's NS records.
+// The walk starts at domain itself and stops at the first name with NS
+// records, which is the deepest zone cut above it, so a name in a delegated
+// subzone such as sub.example.com gets the subzone's nameservers rather than
+// its parent's. To find the servers that publish a zone's DS records, look
+// up the zone's parent instead; a DS check does so itself.
 // The resolver parameter specifies the recursive resolver to use (e.g. "8.8.8.8:53").
-func FindNameservers(ctx context.Context, domain, resolver string) ([]string, error) {
+// If a query to it fails, each of fallbacks is tried in order.
+func FindNameservers(ctx context.Context, domain, resolver string, fallbacks ...string) ([]string, error) {
+	return defaultChecker.FindNameservers(ctx, domain, resolver, fallbacks...)
+}
+
+// FindNameservers is like the package-level FindNameservers but uses c.
+func (c *Checker) FindNameservers(ctx context.Context, domain, resolver string, fallbacks ...string) ([]string, error) {
+	_, servers, err := c.FindZone(ctx, domain, resolver, fallbacks...)
+	return servers, err
+}
+
+// FindZone is like FindNameservers but also returns the zone apex the
+// nameservers are authoritative for. For a subdomain check this may be an
+// ancestor of domain, e.g. "example.com." for "sub.example.com".
+func FindZone(ctx context.Context, domain, resolver string, fallbacks ...string) (string, []string, error) {
+	return defaultChecker.FindZone(ctx, domain, resolver, fallbacks...)
+}
+
+// FindZone is like the package-level FindZone but uses c.
+func (c *Checker) FindZone(ctx context.Context, domain, resolver string, fallbacks ...string) (string, []string, error) {
+	zone, nameservers, err := c.FindDelegation(ctx, domain, resolver, fallbacks...)
+	if err != nil {
+		return "", nil, err
+	}
+	hosts := make([]string, len(nameservers))
+	for i, ns := range nameservers {
+		hosts[i] = ns.Host
+	}
+	return zone, hosts, nil
+}
+
+// Nameserver is an authoritative nameserver found by FindDelegation.
+type Nameserver struct {
+	Host  string
+	Addrs []string // glue addresses from the NS response; empty if there were none
+}
+
+// FindDelegation is like FindZone but also returns the addresses of each
+// nameserver that the resolver included as glue in the additional section
+// of its response, so they can be queried without resolving the hostnames.
+func FindDelegation(ctx context.Context, domain, resolver string, fallbacks ...string) (string, []Nameserver, error) {
+	return defaultChecker.FindDelegation(ctx, domain, resolver, fallbacks...)
+}
+
+// FindDelegation is like the package-level FindDelegation but uses c.
+func (c *Checker) FindDelegation(ctx context.Context, domain, resolver string, fallbacks ...string) (string, []Nameserver, error) {
+	ex := c.resolverExchanger()
+	if len(fallbacks) > 0 {
+		ex = fallbackExchanger{ex, append([]string{resolver}, fallbacks...)}
+	}
+	d, err := findZone(ctx, ex, domain, resolver)
+	if err != nil {
+		return "", nil, err
+	}
+	nameservers := make([]Nameserver, len(d.nameservers))
+	for i, ns := range d.nameservers {
+		nameservers[i] = Nameserver{Host: ns, Addrs: d.glueFor(ns, FamilyBoth)}
+	}
+	return d.zone, nameservers, nil
+}
+
+// delegation describes the result of nameserver discovery.
+type delegation struct {
+	zone        string
+	nameservers []string
+	duplicates  int // duplicate NS records dropped from nameservers
+
+	// glue holds the in-zone A and AAAA records from the additional section
+	// of the NS response, keyed by lowercased owner name.
+	glue map[string][]string
+}
+
+// glueFor returns the glue addresses of nameserver ns in the given family.
+func (d *delegation) glueFor(ns string, family AddressFamily) []string {
+	var addresses []string
+	for _, addr := range d.glue[strings.ToLower(dns.Fqdn(ns))] {
+		if family.includes(addr) {
+			addresses = append(addresses, addr)
+		}
+	}
+	return addresses
+}
+
+// unglued returns the part of family that glue, the glue addresses of a
+// nameserver in family, has no addresses for and so must still be resolved,
+// and false if there is none.
+func unglued(glue []string, family AddressFamily) (AddressFamily, bool) {
+	if len(glue) == 0 {
+		return family, true
+	}
+	if family != FamilyBoth {
+		return family, false
+	}
+	hasIPv4 := slices.ContainsFunc(glue, FamilyIPv4.includes)
+	hasIPv6 := slices.ContainsFunc(glue, FamilyIPv6.includes)
+	switch {
+	case hasIPv4 && !hasIPv6:
+		return FamilyIPv6, true
+	case hasIPv6 && !hasIPv4:
+		return FamilyIPv4, true
+	}
+	return family, false
+}
+
+// glueAddresses returns the addresses of the A and AAAA records in extra
+// that are within zone, keyed by lowercased owner name. Records for names
+// outside the zone are ignored, since the zone's servers aren't
+// authoritative for them and they may be stale or spoofed.
+func glueAddresses(extra []dns.RR, zone string) map[string][]string {
+	glue := make(map[string][]string)
+	for _, record := range extra {
+		name := strings.ToLower(record.Header().Name)
+		if !dns.IsSubDomain(zone, name) {
+			continue
+		}
+		switch r := record.(type) {
+		case *dns.A:
+			glue[name] = append(glue[name], r.A.String())
+		case *dns.AAAA:
+			glue[name] = append(glue[name], r.AAAA.String())
+		}
+	}
+	return glue
+}
+
+// findZone walks up the domain tree like FindNameservers and also returns
+// the zone apex at which the NS records were found.
+func findZone(ctx context.Context, ex Exchanger, domain, resolver string) (*delegation, error) {
 	fqdn := dns.Fqdn(domain)
-	current := fqdn
-	for {
+	if _, ok := dns.IsDomainName(fqdn); !ok {
+		return nil, fmt.Errorf("invalid domain name: %q", domain)
+	}
+
+	// Each lookup strips one label, so the walk can't need more lookups
+	// than fqdn has labels; the root zone itself is never looked up.
+	maxLookups := max(dns.CountLabel(fqdn), 1)
+	offset := 0
+	for lookups := 0; ; lookups++ {
+		// An Exchanger may not notice a canceled context until its next
+		// query times out, so check between referrals as well.
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("NS lookup for %s: %w", fqdn, ctx.Err())
+		default:
+		}
+		if lookups == maxLookups {
+			return nil, fmt.Errorf("NS lookup for %s: gave up after %d lookups", fqdn, lookups)
+		}
+		current := fqdn[offset:]
+
 		msg := new(dns.Msg)
 		msg.SetQuestion(current, dns.TypeNS)
 		msg.RecursionDesired = true
 
-		response, err := exchange(ctx, msg, resolver)
+		response, err := ex.Exchange(ctx, msg, resolver)
 		if err != nil {
 			return nil, fmt.Errorf("NS lookup for %s: %w", current, err)
 		}
 
+		// Only NS records owned by current count: a name such as
+		// _dmarc.example.com may be a CNAME, which the resolver follows to
+		// the NS records of a name in another zone.
 		var servers []string
 		for _, record := range response.Answer {
-			if ns, ok := record.(*dns.NS); ok {
+			if ns, ok := record.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, current) {
 				servers = append(servers, ns.Ns)
 			}
 		}
 		if len(servers) > 0 {
-			return servers, nil
+			servers, duplicates := dedupeNameservers(servers)
+			return &delegation{zone: current, nameservers: servers, duplicates: duplicates, glue: glueAddresses(response.Extra, current)}, nil
 		}
 
-		// Move up one label.
-		index := strings.Index(current, ".")
-		if index < 0 {
-			break
+		// A name with no NS records of its own, such as
+		// _dmarc.example.com or *.example.com, usually gets an answer with
+		// its zone's SOA in the authority section, so the walk can go
+		// straight to the zone apex instead of one label at a time.
+		if apex := authoritySOA(response, current); apex != "" {
+			if next, ok := labelOffset(fqdn, offset, apex); ok {
+				offset = next
+				continue
+			}
 		}
-		next := current[index+1:]
-		if next == "" || next == "." {
+
+		// Move up one label. NextLabel handles escaped dots within a
+		// label, which splitting on "." would not.
+		next, end := dns.NextLabel(fqdn, offset)
+		if end {
 			break
 		}
-		current = next
+		if next <= offset {
+			return nil, fmt.Errorf("NS lookup for %s: no parent of %s", fqdn, current)
+		}
+		offset = next
 	}
 
-	return nil, fmt.Errorf("no nameservers found for %s", fqdn)
+	return nil, fmt.Errorf("%w for %s", ErrNoNameservers, fqdn)
 }
 
-// QueryServer sends a non-recursive query to a specific nameserver IP.
-func QueryServer(ctx context.Context, server, domain string, recordType RecordType) ([]string, error) {
-	fqdn := dns.Fqdn(domain)
-	msg := new(dns.Msg)
-	msg.SetQuestion(fqdn, uint16(recordType))
-	// Set RecursionDesired even though we're querying authoritative nameservers
-	// directly. Some nameservers (e.g. Cloudflare anycast IPs) return empty
-	// answers for non-recursive queries, so we need this to get reliable results.
-	msg.RecursionDesired = true
+// authoritySOA returns the owner of an SOA record in the authority section
+// of response for a zone strictly above name, or "" if there is none.
+func authoritySOA(response *dns.Msg, name string) string {
+	for _, record := range response.Ns {
+		if soa, ok := record.(*dns.SOA); ok && !strings.EqualFold(soa.Hdr.Name, name) && dns.IsSubDomain(soa.Hdr.Name, name) {
+			return soa.Hdr.Name
+		}
+	}
+	return ""
+}
 
-	target := net.JoinHostPort(server, "53")
-	response, err := exchange(ctx, msg, target)
-	if err != nil {
-		return nil, err
+// labelOffset returns the offset of the suffix of fqdn, after offset, that
+// is the name apex.
+func labelOffset(fqdn string, offset int, apex string) (int, bool) {
+	for {
+		next, end := dns.NextLabel(fqdn, offset)
+		if end || next <= offset {
+			return 0, false
+		}
+		offset = next
+		if strings.EqualFold(fqdn[offset:], apex) {
+			return offset, true
+		}
 	}
+}
 
-	var values []string
-	for _, record := range response.Answer {
-		switch r := record.(type) {
-		case *dns.A:
-			values = append(values, r.A.String())
-		case *dns.AAAA:
-			values = append(values, r.AAAA.String())
-		case *dns.CNAME:
-			values = append(values, r.Target)
-		case *dns.TXT:
-			values = append(values, strings.Join(r.Txt, ""))
-		case *dns.MX:
-			values = append(values, r.Mx)
+// dedupeNameservers removes duplicate hostnames from servers, comparing them
+// case-insensitively and ignoring any trailing dot. The first spelling of
+// each hostname is kept. It also returns the number of duplicates removed.
+func dedupeNameservers(servers []string) ([]string, int) {
+	seen := make(map[string]bool, len(servers))
+	var unique []string
+	for _, ns := range servers {
+		key := strings.ToLower(dns.Fqdn(ns))
+		if seen[key] {
+			continue
 		}
+		seen[key] = true
+		unique = append(unique, ns)
 	}
-	return values, nil
+	return unique, len(servers) - len(unique)
 }
 
-// Check performs a full DNS propagation check: finds nameservers, resolves
-// each to IPs, queries each IP, and compares results against expected values.
-func Check(ctx context.Context, args CheckArgs) (*CheckResult, error) {
-	log := args.Logger
-	if log == nil {
-		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+// givenNameservers normalizes the servers given in CheckArgs.Nameservers:
+// brackets around IPv6 addresses are removed, hostnames are lowercased and
+// made fully qualified, and duplicates are dropped.
+func givenNameservers(servers []string) []string {
+	normalized := make([]string, len(servers))
+	for i, ns := range servers {
+		ns = strings.TrimSpace(ns)
+		if ip := strings.TrimSuffix(strings.TrimPrefix(ns, "["), "]"); net.ParseIP(ip) != nil {
+			normalized[i] = ip
+		} else {
+			normalized[i] = dns.Fqdn(strings.ToLower(ns))
+		}
 	}
+	unique, _ := dedupeNameservers(normalized)
+	return unique
+}
+
+// AddressFamily selects which nameserver addresses are used.
+type AddressFamily int
 
-	resolver := args.Resolver
-	if resolver == "" {
-		resolver = DefaultResolver
+const (
+	// FamilyDefault, the zero value, leaves the family unset. It queries
+	// IPv4 addresses, like FamilyIPv4, unless a Checker made with
+	// WithAddressFamily sets another family.
+	FamilyDefault AddressFamily = iota
+	FamilyIPv4
+	FamilyIPv6
+	FamilyBoth
+)
+
+func (f AddressFamily) String() string {
+	switch f {
+	case FamilyDefault, FamilyIPv4:
+		return "IPv4"
+	case FamilyIPv6:
+		return "IPv6"
+	case FamilyBoth:
+		return "both"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", int(f))
 	}
+}
 
-	log.Info("finding nameservers", "domain", args.Domain, "resolver", resolver)
-	nameservers, err := FindNameservers(ctx, args.Domain, resolver)
-	if err != nil {
-		return nil, err
+// includes reports whether addr belongs to the address family.
+func (f AddressFamily) includes(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
 	}
-	log.Info("found nameservers", "nameservers", nameservers)
+	switch f {
+	case FamilyDefault, FamilyIPv4:
+		return ip.To4() != nil
+	case FamilyIPv6:
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
 
-	result := &CheckResult{
-		Domain:      args.Domain,
-		RecordType:  args.RecordType,
-		Expected:    args.Expected,
-		Nameservers: nameservers,
+// addressFamily returns FamilyIPv6 for IPv6 addresses and FamilyIPv4
+// otherwise.
+func addressFamily(addr string) AddressFamily {
+	if FamilyIPv6.includes(addr) {
+		return FamilyIPv6
 	}
+	return FamilyIPv4
+}
+
+// ResolveNameservers resolves each nameserver hostname to its addresses in
+// the given family and returns them all. Nameservers that fail to resolve
+// are skipped; an error is returned only if no addresses were found at all.
+func ResolveNameservers(ctx context.Context, nameservers []string, family AddressFamily) ([]string, error) {
+	return defaultChecker.ResolveNameservers(ctx, nameservers, family)
+}
 
+// ResolveNameservers is like the package-level ResolveNameservers but uses c.
+func (c *Checker) ResolveNameservers(ctx context.Context, nameservers []string, family AddressFamily) ([]string, error) {
+	var all []string
+	var errs []error
 	for _, ns := range nameservers {
-		log.Info("resolving nameserver", "nameserver", ns)
-		addresses, err := net.DefaultResolver.LookupHost(ctx, ns)
+		addresses, err := resolveNameserver(ctx, c.hostResolver(), ns, family)
 		if err != nil {
-			log.Warn("could not resolve nameserver", "nameserver", ns, "error", err)
-			result.Servers = append(result.Servers, ServerResult{
-				Nameserver: ns,
-				Error:      fmt.Errorf("could not resolve nameserver: %w", err),
-			})
-			continue
-		}
-
-		// Filter to IPv4 addresses only, since IPv6 connectivity is not
-		// always available and would cause spurious failures.
-		var ipv4Addresses []string
-		for _, addr := range addresses {
-			if net.ParseIP(addr) != nil && net.ParseIP(addr).To4() != nil {
-				ipv4Addresses = append(ipv4Addresses, addr)
-			}
-		}
-		if len(ipv4Addresses) == 0 {
-			log.Warn("no IPv4 addresses for nameserver", "nameserver", ns)
-			result.Servers = append(result.Servers, ServerResult{
-				Nameserver: ns,
-				Error:      fmt.Errorf("no IPv4 addresses found for nameserver"),
-			})
+			errs = append(errs, fmt.Errorf("%s: %w", ns, err))
 			continue
 		}
-		log.Info("resolved nameserver", "nameserver", ns, "addresses", ipv4Addresses)
+		all = append(all, addresses...)
+	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("no %s addresses found for nameservers: %w", family, errors.Join(errs...))
+	}
+	return all, nil
+}
 
-		for _, addr := range ipv4Addresses {
-			log.Info("querying server", "nameserver", ns, "address", addr, "type", args.RecordType)
-			values, err := QueryServer(ctx, addr, args.Domain, args.RecordType)
-			if err != nil {
-				log.Warn("query failed", "nameserver", ns, "address", addr, "error", err)
-				result.Servers = append(result.Servers, ServerResult{
-					Nameserver: ns,
-					Address:    addr,
-					Error:      fmt.Errorf("query failed: %w", err),
-				})
-				continue
-			}
+// resolveNameserver resolves a nameserver hostname to its addresses in the
+// given family.
+func resolveNameserver(ctx context.Context, hosts HostResolver, ns string, family AddressFamily) ([]string, error) {
+	addresses, err := hosts.LookupHost(ctx, ns)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNameserverUnresolvable, err)
+	}
 
-			match := valuesMatch(values, args.Expected)
-			log.Info("query result", "nameserver", ns, "address", addr, "values", values, "match", match)
-			result.Servers = append(result.Servers, ServerResult{
-				Nameserver: ns,
-				Address:    addr,
-				Values:     values,
-				Match:      match,
-			})
+	var filtered []string
+	for _, addr := range addresses {
+		if family.includes(addr) {
+			filtered = append(filtered, addr)
 		}
 	}
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("%w: no %s addresses found", ErrNameserverUnresolvable, family)
+	}
+	return filtered, nil
+}
 
-	return result, nil
+// QueryServerMsg sends the same query as QueryServer, once, but returns the
+// whole response for callers that need more than the answer's values: its
+// header flags, or the authority and additional sections, e.g. the SOA
+// record that comes with NXDOMAIN. Any response code is returned as is, but
+// a response that's still truncated after a retry over TCP is an error
+// wrapping ErrTruncated.
+func QueryServerMsg(ctx context.Context, server, port, domain string, recordType RecordType) (*dns.Msg, error) {
+	return defaultChecker.QueryServerMsg(ctx, server, port, domain, recordType)
 }
 
-// valuesMatch performs a strict set comparison between got and expected values.
-// Both sets must contain exactly the same elements (order-independent,
-// case-insensitive, FQDN-aware).
-func valuesMatch(got, expected []string) bool {
-	if len(got) != len(expected) {
-		return false
+// QueryServerMsg is like the package-level QueryServerMsg but uses c.
+func (c *Checker) QueryServerMsg(ctx context.Context, server, port, domain string, recordType RecordType) (*dns.Msg, error) {
+	if err := validatePort(port); err != nil {
+		return nil, err
 	}
+	return queryServer(ctx, c.exchanger(), server, port, domain, recordType, false)
+}
 
-	normalize := func(s string) string {
-		return strings.ToLower(strings.TrimSuffix(s, "."))
+// RcodeError is returned by QueryServer when the server answers with a
+// response code other than NOERROR, e.g. NXDOMAIN for a name it doesn't have.
+type RcodeError struct {
+	Rcode Rcode
+}
+
+func (e *RcodeError) Error() string {
+	return "server returned " + e.Rcode.String()
+}
+
+// QueryServer sends a non-recursive query to a specific nameserver IP on
+// port, usually "53". It returns the values of the answer's records of
+// recordType, leaving out any CNAMEs that lead to them, and how long the
+// server took to respond. If filter is non-nil, only the values of records
+// for which it returns true are returned, as with CheckArgs.AnswerFilter. If
+// the response code isn't NOERROR, the error is an *RcodeError, so NXDOMAIN
+// can be told apart from an empty answer.
+//
+// A failed query or an empty NOERROR answer is retried up to retries times,
+// with the same backoff as CheckArgs.Retries; the latency is that of the
+// last attempt.
+func QueryServer(ctx context.Context, server, port, domain string, recordType RecordType, filter func(dns.RR) bool, retries int) ([]string, time.Duration, error) {
+	return defaultChecker.QueryServer(ctx, server, port, domain, recordType, filter, retries)
+}
+
+// QueryServer is like the package-level QueryServer but uses c.
+func (c *Checker) QueryServer(ctx context.Context, server, port, domain string, recordType RecordType, filter func(dns.RR) bool, retries int) ([]string, time.Duration, error) {
+	if err := validatePort(port); err != nil {
+		return nil, 0, err
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	send := func() (*dns.Msg, error) {
+		return queryServer(ctx, c.exchanger(), server, port, domain, recordType, false)
+	}
+	retryable := func(response *dns.Msg, err error) bool {
+		if err != nil {
+			return ctx.Err() == nil
+		}
+		return response.Rcode == dns.RcodeSuccess && len(answerValues(response.Answer)) == 0
+	}
+	response, latency, err := queryRetrying(ctx, retries, log, send, retryable)
+	if err != nil {
+		return nil, latency, err
+	}
+	if response.Rcode != dns.RcodeSuccess {
+		return nil, latency, &RcodeError{Rcode(response.Rcode)}
+	}
+	answer := filterType(response.Answer, recordType)
+	if filter != nil {
+		answer = filterAnswer(answer, filter)
+	}
+	return answerValues(answer), latency, nil
+}
+
+// queryServer sends a query to a specific nameserver IP and port and returns
+// the raw response. When dnssec is set, the query advertises EDNS0 with the
+// DO bit. A truncated response is an error wrapping ErrTruncated, since
+// comparing its partial answer would report a bogus mismatch.
+func queryServer(ctx context.Context, ex Exchanger, server, port, domain string, recordType RecordType, dnssec bool) (*dns.Msg, error) {
+	fqdn := dns.Fqdn(domain)
+	msg := new(dns.Msg)
+	msg.SetQuestion(fqdn, uint16(recordType))
+	// Set RecursionDesired even though we're querying authoritative nameservers
+	// directly. Some nameservers (e.g. Cloudflare anycast IPs) return empty
+	// answers for non-recursive queries, so we need this to get reliable results.
+	msg.RecursionDesired = true
+	if dnssec {
+		msg.SetEdns0(ednsBufferSize, true)
+	}
+
+	target := net.JoinHostPort(server, port)
+	response, err := ex.Exchange(ctx, msg, target)
+	if err == nil && response.Truncated {
+		return nil, fmt.Errorf("%w from %s", ErrTruncated, target)
+	}
+	return response, err
+}
+
+// answerValues extracts the comparable string values from an answer section.
+func answerValues(answer []dns.RR) []string {
+	var values []string
+	for _, record := range answer {
+		if info, ok := recordTypes[RecordType(record.Header().Rrtype)]; ok {
+			values = append(values, info.value(record))
+		}
+	}
+	return values
+}
+
+// values returns the values and TTLs of the records in answer as args
+// compares them.
+func (args CheckArgs) values(answer []dns.RR) ([]string, []uint32) {
+	if args.TXTPrefix != "" {
+		answer = filterAnswer(answer, func(record dns.RR) bool {
+			return hasTXTPrefix(record, args.TXTPrefix)
+		})
+	}
+	if args.SplitTXTStrings && args.RecordType == TypeTXT {
+		return txtStrings(answer)
+	}
+	if args.IgnoreMXPreference && args.RecordType == TypeMX {
+		return mxHosts(answerValues(answer)), answerTTLs(answer)
+	}
+	return answerValues(answer), answerTTLs(answer)
+}
+
+// answerTTLs returns the TTLs of the records answerValues extracts from an
+// answer section, in the same order.
+func answerTTLs(answer []dns.RR) []uint32 {
+	var ttls []uint32
+	for _, record := range answer {
+		if _, ok := recordTypes[RecordType(record.Header().Rrtype)]; ok {
+			ttls = append(ttls, record.Header().Ttl)
+		}
+	}
+	return ttls
+}
+
+// Check performs a full DNS propagation check: finds nameservers, resolves
+// each to IPs, queries each IP, and compares results against expected values.
+//
+// If no expected values are given, through Expected, ExpectedByServer,
+// ExpectedFromName, ExpectedFromPrimary or RequireCAA, Check runs in
+// discovery mode: each server's values are recorded but not compared, so
+// ServerResult.Match only reflects the other checks enabled, such as
+// ValidateDNSSEC. Use CheckResult.Consistent to see whether the servers
+// agree.
+//
+// Check returns an error without sending any queries if args is invalid;
+// see CheckArgs.Validate. If a lookup fails before any server is queried,
+// e.g. the nameservers can't be found, it returns the error together with a
+// partial CheckResult whose Err is set, so callers can still report what
+// was found. The domain is normalized with NormalizeDomain first, so
+// CheckResult.Domain may differ from args.Domain. A domain whose first
+// label is "*", e.g. "*.example.com", is queried literally, which checks
+// the wildcard record itself as the servers have it; labels starting with
+// an underscore, as in "_dmarc.example.com", are ordinary labels.
+func Check(ctx context.Context, args CheckArgs) (*CheckResult, error) {
+	return defaultChecker.Check(ctx, args)
+}
+
+// Check is like the package-level Check but takes any fields args leaves
+// unset, such as Exchanger or Resolver, from c.
+func (c *Checker) Check(ctx context.Context, args CheckArgs) (*CheckResult, error) {
+	args = c.withDefaults(args)
+	if err := args.Validate(); err != nil {
+		return nil, err
+	}
+	args.Domain, _ = NormalizeDomain(args.Domain)
+	start := time.Now()
+	log := args.logger()
+
+	resolver := args.resolver()
+	if err := validatePort(args.port()); err != nil {
+		return nil, err
+	}
+
+	var tr *tracer
+	if args.Trace || args.OnTrace != nil {
+		tr = &tracer{onStep: args.OnTrace, record: args.Trace}
+		args.Exchanger = traceExchanger{args.baseExchanger(), tr}
+		args.HostResolver = traceHosts{args.hostResolver(), tr}
+	}
+
+	ex := args.exchanger()
+	// Recursive lookups may be answered from the cache; the queries to the
+	// servers being checked never are.
+	rex := args.Cache.exchanger(ex)
+
+	result := &CheckResult{
+		Domain:           args.Domain,
+		RecordType:       args.RecordType,
+		Expected:         args.Expected,
+		MatchMode:        args.MatchMode,
+		ExpectedByServer: args.ExpectedByServer,
+	}
+	// fail returns the result as far as the check got, for a failure to
+	// look something up before any server was queried.
+	fail := func(err error) (*CheckResult, error) {
+		result.Err = err
+		result.Duration = time.Since(start)
+		if tr != nil {
+			result.Trace = tr.steps
+		}
+		return result, err
+	}
+
+	if args.ExpectedFromName != "" {
+		log.Info("resolving reference name", "name", args.ExpectedFromName, "type", args.RecordType, "resolver", resolver)
+		records, err := resolveRecords(ctx, rex, args.ExpectedFromName, args.RecordType, resolver)
+		if err != nil {
+			return fail(err)
+		}
+		values, _ := args.values(records)
+		if len(values) == 0 {
+			return nil, fmt.Errorf("resolving %s: no TXT records starting with %q", args.ExpectedFromName, args.TXTPrefix)
+		}
+		log.Info("resolved reference name", "name", args.ExpectedFromName, "values", values)
+		args.Expected = append(slices.Clip(args.Expected), values...)
+		result.Expected = args.Expected
+	}
+
+	var patterns map[string]*regexp.Regexp
+	if args.MatchMode == MatchRegex {
+		var err error
+		if patterns, err = compilePatterns(args); err != nil {
+			return nil, err
+		}
+	}
+
+	d, err := args.delegation(ctx, rex, resolver, log)
+	if err != nil {
+		return fail(err)
+	}
+	zone, nameservers := d.zone, d.nameservers
+	result.Zone, result.Nameservers, result.DuplicateNameservers = zone, nameservers, d.duplicates
+	if d.duplicates > 0 {
+		log.Warn("removed duplicate nameservers", "duplicates", d.duplicates)
+	}
+	log.Info("found nameservers", "zone", zone, "nameservers", nameservers)
+
+	var ds []*dns.DS
+	if args.ValidateDNSSEC {
+		log.Info("fetching DS records", "zone", zone, "resolver", resolver)
+		if ds, err = fetchDS(ctx, rex, zone, resolver); err != nil {
+			return fail(err)
+		}
+	}
+
+	if args.ExpectedFromPrimary {
+		primary, values, err := primaryValues(ctx, rex, ex, args, resolver, d)
+		if err != nil {
+			return fail(err)
+		}
+		log.Info("queried primary nameserver", "primary", primary, "values", values)
+		args.Expected = append(slices.Clip(args.Expected), values...)
+		result.Expected, result.Primary = args.Expected, primary
+	}
+
+	if args.IgnoreMXPreference {
+		args.Expected = mxHosts(args.Expected)
+		if args.ExpectedByServer != nil {
+			byServer := make(map[string][]string, len(args.ExpectedByServer))
+			for server, expected := range args.ExpectedByServer {
+				byServer[server] = mxHosts(expected)
+			}
+			args.ExpectedByServer = byServer
+		}
+		result.Expected, result.ExpectedByServer = args.Expected, args.ExpectedByServer
+	}
+
+	run := &checkRun{
+		args:      args,
+		log:       log,
+		exchanger: ex,
+		hosts:     args.hostResolver(),
+		resolver:  resolver,
+		zone:      zone,
+		patterns:  patterns,
+		ds:        ds,
+	}
+
+	targets, sampledFrom := args.targets(ctx, run.hosts, d, log)
+	result.SampledFrom = sampledFrom
+	if run.args.ExpectedByServer, err = args.sharedExpected(targets); err != nil {
+		return nil, err
+	}
+
+	// Query servers concurrently, storing each result at its target's
+	// index so the order doesn't depend on which server answers first.
+	result.Servers = make([]ServerResult, len(targets))
+	sem := make(chan struct{}, args.concurrency())
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		if target.err != nil {
+			result.Servers[i] = ServerResult{
+				Nameserver: target.nameserver,
+				Error:      target.err,
+			}
+			if args.OnResult != nil {
+				args.OnResult(result.Servers[i])
+			}
+			continue
+		}
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			result.Servers[i] = run.checkServer(ctx, target.nameserver, target.address)
+			result.Servers[i].OtherNameservers = target.others
+			if args.OnResult != nil {
+				args.OnResult(result.Servers[i])
+			}
+		})
+	}
+	wg.Wait()
+
+	result.Duration = time.Since(start)
+	if tr != nil {
+		result.Trace = tr.steps
+	}
+	return result, nil
+}
+
+// delegation finds the nameservers to check: the given Nameservers if set,
+// otherwise those of the zone containing args.Domain. DS records are
+// published by the parent zone, not the zone they delegate, so for DS the
+// search starts one label up, at the parent.
+func (args CheckArgs) delegation(ctx context.Context, rex Exchanger, resolver string, log *slog.Logger) (*delegation, error) {
+	domain := args.Domain
+	if args.RecordType == TypeDS {
+		domain = parentName(dns.Fqdn(domain))
+	}
+	switch {
+	case len(args.Nameservers) > 0:
+		log.Info("using given nameservers", "nameservers", args.Nameservers)
+		return &delegation{nameservers: givenNameservers(args.Nameservers)}, nil
+	case len(args.CrossCheckResolvers) > 0:
+		resolvers := append([]string{resolver}, args.CrossCheckResolvers...)
+		log.Info("finding nameservers", "domain", domain, "resolvers", resolvers)
+		return crossCheckZone(ctx, rex, domain, resolvers)
+	default:
+		log.Info("finding nameservers", "domain", domain, "resolver", resolver)
+		return findZone(ctx, rex, domain, resolver)
+	}
+}
+
+// targets resolves the nameservers of d to the addresses to query, one
+// target per address, deduplicated and sampled down to MaxServers. It also
+// returns the number of queryable targets before sampling, or 0 if none
+// were dropped.
+func (args CheckArgs) targets(ctx context.Context, hosts HostResolver, d *delegation, log *slog.Logger) ([]serverTarget, int) {
+	var targets []serverTarget
+	for _, ns := range d.nameservers {
+		if len(args.Nameservers) > 0 && net.ParseIP(ns) != nil {
+			targets = append(targets, serverTarget{nameserver: ns, address: ns})
+			continue
+		}
+
+		// Glue from the NS response saves resolving the hostname, except
+		// in a family the glue has no addresses in.
+		glue := d.glueFor(ns, args.AddressFamily)
+		if len(glue) > 0 {
+			log.Info("using glue", "nameserver", ns, "addresses", glue)
+			for _, addr := range glue {
+				targets = append(targets, serverTarget{nameserver: ns, address: addr})
+			}
+		}
+		family, resolve := unglued(glue, args.AddressFamily)
+		if !resolve {
+			continue
+		}
+
+		// IPv4 is the default, since IPv6 connectivity is not always
+		// available and would cause spurious failures.
+		log.Info("resolving nameserver", "nameserver", ns, "family", family)
+		addresses, err := resolveNameserver(ctx, hosts, ns, family)
+		if err != nil && len(glue) > 0 {
+			// The nameserver need not have addresses in both families.
+			log.Info("no addresses beyond glue", "nameserver", ns, "family", family, "error", err)
+			continue
+		}
+		if err != nil {
+			log.Warn("could not resolve nameserver", "nameserver", ns, "error", err)
+			targets = append(targets, serverTarget{nameserver: ns, err: err})
+			continue
+		}
+		log.Info("resolved nameserver", "nameserver", ns, "addresses", addresses)
+
+		for _, addr := range addresses {
+			targets = append(targets, serverTarget{nameserver: ns, address: addr})
+		}
+	}
+
+	targets = dedupeTargets(targets)
+	if sampled, total := sampleTargets(targets, args.MaxServers); len(sampled) < len(targets) {
+		log.Info("sampled servers", "sampled", args.MaxServers, "total", total)
+		return sampled, total
+	}
+	return targets, 0
+}
+
+// port returns the port to query authoritative nameservers on.
+func (args CheckArgs) port() string {
+	if args.Port == "" {
+		return "53"
+	}
+	return args.Port
+}
+
+// Validate returns an error describing the first problem with args that
+// would keep Check from running a meaningful check: a missing Domain or one
+// NormalizeDomain rejects, a RecordType that isn't supported, a MatchMode
+// other than MatchExact without expected values to compare against,
+// RequireCAA for a RecordType other than TypeCAA, RequireEveryPattern
+// without MatchRegex, ExpectedFromName, ExpectedFromPrimary or
+// IgnoreMXPreference with MatchRegex, TXTPrefix or IgnoreMXPreference for a
+// RecordType they don't apply to, or Nameservers with a check that needs
+// the zone to be looked up.
+func (args CheckArgs) Validate() error {
+	if args.Domain == "" {
+		return errors.New("invalid check: no domain name")
+	}
+	if _, err := NormalizeDomain(args.Domain); err != nil {
+		return fmt.Errorf("invalid check: %w", err)
+	}
+	if args.RecordType == 0 {
+		return errors.New("invalid check: no record type")
+	}
+	if _, ok := recordTypes[args.RecordType]; !ok {
+		return fmt.Errorf("invalid check: unsupported record type: %s", args.RecordType)
+	}
+	if args.MatchMode != MatchExact && args.discovery() {
+		return errors.New("invalid check: match modes other than exact need expected values")
+	}
+	if len(args.RequireCAA) > 0 && args.RecordType != TypeCAA {
+		return fmt.Errorf("invalid check: required CAA properties can't be checked against %s records", args.RecordType)
+	}
+	if args.RequireEveryPattern && args.MatchMode != MatchRegex {
+		return errors.New("invalid check: RequireEveryPattern needs MatchRegex")
+	}
+	if args.ExpectedFromName != "" && args.MatchMode == MatchRegex {
+		return errors.New("invalid check: a reference name's records can't be used as patterns")
+	}
+	if args.TXTPrefix != "" && args.RecordType != TypeTXT {
+		return fmt.Errorf("invalid check: a TXT prefix can't filter %s records", args.RecordType)
+	}
+	if args.IgnoreMXPreference && args.RecordType != TypeMX {
+		return fmt.Errorf("invalid check: MX preferences can't be ignored for %s records", args.RecordType)
+	}
+	if args.IgnoreMXPreference && args.MatchMode == MatchRegex {
+		return errors.New("invalid check: MX preferences can't be ignored with MatchRegex")
+	}
+	if args.ExpectedFromPrimary && args.MatchMode == MatchRegex {
+		return errors.New("invalid check: the primary's records can't be used as patterns")
+	}
+	if len(args.Nameservers) > 0 {
+		if slices.Contains(args.Nameservers, "") {
+			return errors.New("invalid check: empty nameserver")
+		}
+		if args.ValidateDNSSEC || args.MinNSTTL > 0 || args.ExpectedFromPrimary || len(args.CrossCheckResolvers) > 0 || args.ApexCNAME != ApexCNAMEWarn {
+			return errors.New("invalid check: given nameservers can't be used with checks that need the zone looked up")
+		}
+	}
+	return nil
+}
+
+// validatePort returns an error unless port is a number from 1 to 65535.
+func validatePort(port string) error {
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port: %q", port)
+	}
+	return nil
+}
+
+// concurrency returns the number of servers to query at once.
+func (args CheckArgs) concurrency() int {
+	switch {
+	case args.LocalPort != 0:
+		return 1
+	case args.Concurrency > 0:
+		return args.Concurrency
+	default:
+		return DefaultConcurrency
+	}
+}
+
+// patternsFor returns the compiled patterns for the expected values.
+func (c *checkRun) patternsFor(expected []string) []*regexp.Regexp {
+	patterns := make([]*regexp.Regexp, len(expected))
+	for i, p := range expected {
+		patterns[i] = c.patterns[p]
+	}
+	return patterns
+}
+
+// expectedFor returns the expected values for the server at addr belonging
+// to nameserver ns.
+func (args CheckArgs) expectedFor(ns, addr string) []string {
+	if expected, ok := args.ExpectedByServer[addr]; ok && addr != "" {
+		return expected
+	}
+	if expected, ok := args.expectedForName(ns); ok {
+		return expected
+	}
+	return args.Expected
+}
+
+// expectedForName returns the ExpectedByServer entry for the nameserver
+// hostname ns, if there is one.
+func (args CheckArgs) expectedForName(ns string) ([]string, bool) {
+	for key, expected := range args.ExpectedByServer {
+		if strings.EqualFold(dns.Fqdn(key), dns.Fqdn(ns)) {
+			return expected, true
+		}
+	}
+	return nil, false
+}
+
+// sharedExpected returns ExpectedByServer with the hostname entries for
+// nameservers that share an address with another, as recorded by
+// dedupeTargets, applied to the address, since it is queried only once
+// under the first nameserver. It returns an error if the nameservers
+// sharing an address have differing entries.
+func (args CheckArgs) sharedExpected(targets []serverTarget) (map[string][]string, error) {
+	if len(args.ExpectedByServer) == 0 {
+		return args.ExpectedByServer, nil
+	}
+	byServer := maps.Clone(args.ExpectedByServer)
+	for _, target := range targets {
+		if len(target.others) == 0 {
+			continue
+		}
+		if _, ok := args.ExpectedByServer[target.address]; ok {
+			continue
+		}
+		var from string
+		var expected []string
+		for _, ns := range append([]string{target.nameserver}, target.others...) {
+			values, ok := args.expectedForName(ns)
+			if !ok {
+				continue
+			}
+			if from != "" && !slices.Equal(values, expected) {
+				return nil, fmt.Errorf("invalid check: %s and %s share the address %s but have different expected values", from, ns, target.address)
+			}
+			from, expected = ns, values
+		}
+		if from != "" {
+			byServer[target.address] = expected
+		}
+	}
+	return byServer, nil
+}
+
+// discovery reports whether no expected values were given, in which case
+// values are recorded but not compared.
+func (args CheckArgs) discovery() bool {
+	return len(args.Expected) == 0 && len(args.ExpectedByServer) == 0 && args.ExpectedFromName == "" && !args.ExpectedFromPrimary && len(args.RequireCAA) == 0
+}
+
+// serverTarget is a nameserver address to query, or a nameserver that could
+// not be resolved.
+type serverTarget struct {
+	nameserver string
+	address    string
+	err        error
+
+	// others are the other nameservers that resolved to address.
+	others []string
+}
+
+// dedupeTargets keeps only the first target for each address, recording the
+// nameservers of the others on it, so an address shared by several
+// nameservers is queried and counted once. Unresolvable nameservers are
+// always kept.
+func dedupeTargets(targets []serverTarget) []serverTarget {
+	first := make(map[string]int)
+	var unique []serverTarget
+	for _, target := range targets {
+		if target.err != nil {
+			unique = append(unique, target)
+			continue
+		}
+		key := target.address
+		if ip := net.ParseIP(key); ip != nil {
+			key = ip.String()
+		}
+		i, ok := first[key]
+		if !ok {
+			first[key] = len(unique)
+			unique = append(unique, target)
+			continue
+		}
+		if !strings.EqualFold(unique[i].nameserver, target.nameserver) && !slices.ContainsFunc(unique[i].others, func(ns string) bool {
+			return strings.EqualFold(ns, target.nameserver)
+		}) {
+			unique[i].others = append(unique[i].others, target.nameserver)
+		}
+	}
+	return unique
+}
+
+// sampleTargets reduces the queryable targets to at most max, picking
+// round-robin across nameservers (the first address of each nameserver,
+// then the second, and so on) so the sample stays diverse. Unresolvable
+// nameservers are always kept. The relative order of targets is preserved.
+// It also returns the number of queryable targets before sampling. A max of
+// zero or less keeps every target.
+func sampleTargets(targets []serverTarget, max int) ([]serverTarget, int) {
+	var total int
+	for _, target := range targets {
+		if target.err == nil {
+			total++
+		}
+	}
+	if max <= 0 || total <= max {
+		return targets, total
+	}
+
+	// rank is each target's position among its nameserver's addresses.
+	rank := make([]int, len(targets))
+	seen := make(map[string]int)
+	for i, target := range targets {
+		if target.err == nil {
+			rank[i] = seen[target.nameserver]
+			seen[target.nameserver]++
+		}
+	}
+
+	keep := make([]bool, len(targets))
+	for round, picked := 0, 0; picked < max; round++ {
+		for i, target := range targets {
+			if target.err == nil && rank[i] == round && picked < max {
+				keep[i] = true
+				picked++
+			}
+		}
+	}
+
+	var sampled []serverTarget
+	for i, target := range targets {
+		if target.err != nil || keep[i] {
+			sampled = append(sampled, target)
+		}
+	}
+	return sampled, total
+}
+
+// checkRun holds the state shared by every server queried during a Check.
+type checkRun struct {
+	args      CheckArgs
+	log       *slog.Logger
+	exchanger Exchanger
+	hosts     HostResolver
+	resolver  string
+	zone      string
+
+	// patterns holds the compiled expected values for MatchRegex, keyed by
+	// pattern.
+	patterns map[string]*regexp.Regexp
+
+	// ds holds the zone's DS records for ValidateDNSSEC.
+	ds []*dns.DS
+}
+
+// checkServer queries a single nameserver address and compares its answer
+// against the expected values.
+func (c *checkRun) checkServer(ctx context.Context, ns, addr string) ServerResult {
+	result := c.queryAndCompare(ctx, ns, addr)
+	result.AddressFamily = addressFamily(addr)
+	return result
+}
+
+func (c *checkRun) queryAndCompare(ctx context.Context, ns, addr string) ServerResult {
+	args, log := c.args, c.log
+
+	log.Info("querying server", "nameserver", ns, "address", addr, "family", addressFamily(addr), "type", args.RecordType)
+	response, latency, err := c.query(ctx, ns, addr)
+	if err != nil {
+		log.Warn("query failed", "nameserver", ns, "address", addr, "latency", latency, "error", err)
+		return ServerResult{
+			Nameserver: ns,
+			Address:    addr,
+			Latency:    latency,
+			Error:      &QueryError{Nameserver: ns, Address: addr, Err: err},
+		}
+	}
+
+	rcode := Rcode(response.Rcode)
+	if acceptedRcode(response, args.AcceptRcodes) {
+		log.Info("accepted rcode", "nameserver", ns, "address", addr, "rcode", rcode)
+		return ServerResult{
+			Nameserver: ns,
+			Address:    addr,
+			Latency:    latency,
+			Rcode:      rcode,
+			Match:      true,
+		}
+	}
+
+	answer := response.Answer
+	if args.AnswerFilter != nil {
+		answer = filterAnswer(answer, args.AnswerFilter)
+	}
+	var cname string
+	if args.RecordType != TypeCNAME {
+		cname = cnameTarget(answer, args.Domain)
+	}
+	answer = filterType(answer, args.RecordType)
+	values, ttls := args.values(answer)
+	target := apexCNAME(response, c.zone)
+	if target != "" {
+		log.Warn("CNAME at zone apex", "nameserver", ns, "address", addr, "zone", c.zone, "target", target)
+		switch args.ApexCNAME {
+		case ApexCNAMEError:
+			return ServerResult{
+				Nameserver: ns,
+				Address:    addr,
+				Latency:    latency,
+				Values:     values,
+				TTLs:       ttls,
+				Rcode:      rcode,
+				ApexCNAME:  target,
+				Error:      fmt.Errorf("CNAME at zone apex %s pointing to %s", c.zone, target),
+			}
+		case ApexCNAMEFollow:
+			records, err := followCNAME(ctx, c.exchanger, response, target, args.RecordType, c.resolver)
+			if err != nil {
+				log.Warn("could not follow apex CNAME", "nameserver", ns, "address", addr, "target", target, "error", err)
+				return ServerResult{
+					Nameserver: ns,
+					Address:    addr,
+					Latency:    latency,
+					Rcode:      rcode,
+					ApexCNAME:  target,
+					Error:      fmt.Errorf("following apex CNAME to %s: %w", target, err),
+				}
+			}
+			values, ttls = args.values(records)
+		}
+	}
+	expected := args.expectedFor(ns, addr)
+	var match bool
+	var missing, unexpected []string
+	switch {
+	case args.discovery():
+		match = true
+	case args.MatchMode == MatchRegex:
+		match = regexValuesMatch(values, c.patternsFor(expected), args.RequireEveryPattern)
+	default:
+		match = valuesMatchMode(args.MatchMode, args.RecordType, values, expected)
+		missing, unexpected = valuesDiff(args.MatchMode, args.RecordType, values, expected)
+	}
+	if len(args.RequireCAA) > 0 {
+		// With only requirements given, the full set isn't compared.
+		if len(expected) == 0 {
+			match = true
+		}
+		if missing := missingCAA(values, args.RequireCAA); len(missing) > 0 {
+			log.Warn("required CAA properties missing", "nameserver", ns, "address", addr, "missing", missing)
+			match = false
+		}
+	}
+
+	lame := !response.Authoritative || response.Rcode == dns.RcodeRefused
+	if lame {
+		log.Warn("server is not authoritative", "nameserver", ns, "address", addr, "zone", c.zone, "rcode", rcode)
+		match = false
+	}
+
+	var signatureErr error
+	if args.CheckSignatures {
+		signatureErr = checkSignatures(response, args.Domain, args.RecordType)
+		if signatureErr != nil {
+			log.Warn("signature check failed", "nameserver", ns, "address", addr, "error", signatureErr)
+			match = false
+		}
+	}
+
+	var dnssecStatus DNSSECStatus
+	var dnssecErr error
+	if args.ValidateDNSSEC {
+		dnssecStatus, dnssecErr = c.validateDNSSEC(ctx, addr, response)
+		if dnssecErr != nil {
+			log.Warn("DNSSEC validation failed", "nameserver", ns, "address", addr, "error", dnssecErr)
+			match = false
+		}
+	}
+
+	var nsTTLErr error
+	if args.MinNSTTL > 0 {
+		nsTTLErr = c.checkNSTTL(ctx, addr)
+		if nsTTLErr != nil {
+			log.Warn("NS TTL check failed", "nameserver", ns, "address", addr, "error", nsTTLErr)
+			match = false
+		}
+	}
+
+	var txtWarnings []string
+	if args.CheckTXTSize && args.RecordType == TypeTXT {
+		txtWarnings = txtSizeWarnings(response, answer)
+		for _, w := range txtWarnings {
+			log.Warn("TXT size", "nameserver", ns, "address", addr, "warning", w)
+		}
+	}
+
+	var signatures []string
+	if args.DNSSEC {
+		signatures = answerSignatures(response.Answer)
+		log.Info("signatures", "nameserver", ns, "address", addr, "rrsigs", signatures)
+	}
+
+	log.Info("query result", "nameserver", ns, "address", addr, "values", values, "ttls", ttls, "latency", latency, "match", match)
+	return ServerResult{
+		Nameserver:      ns,
+		Address:         addr,
+		Latency:         latency,
+		Values:          values,
+		TTLs:            ttls,
+		Signatures:      signatures,
+		Rcode:           rcode,
+		Match:           match,
+		Lame:            lame,
+		Missing:         missing,
+		Unexpected:      unexpected,
+		CNAME:           cname,
+		ApexCNAME:       target,
+		SignatureError:  signatureErr,
+		DNSSECStatus:    dnssecStatus,
+		DNSSECError:     dnssecErr,
+		NSTTLError:      nsTTLErr,
+		TXTSizeWarnings: txtWarnings,
+	}
+}
+
+// query sends the check's query to addr, retrying up to CheckArgs.Retries
+// times while the failure looks transient. It returns the last response and
+// how long that attempt took.
+func (c *checkRun) query(ctx context.Context, ns, addr string) (*dns.Msg, time.Duration, error) {
+	args := c.args
+	send := func() (*dns.Msg, error) {
+		return queryServer(ctx, c.exchanger, addr, args.port(), args.Domain, args.RecordType, args.CheckSignatures || args.ValidateDNSSEC)
+	}
+	retryable := func(response *dns.Msg, err error) bool {
+		return c.retryable(ctx, ns, addr, response, err)
+	}
+	return queryRetrying(ctx, args.Retries, c.log.With("nameserver", ns, "address", addr), send, retryable)
+}
+
+// queryRetrying calls send, retrying up to retries times with exponential
+// backoff while retryable reports the failure as transient. It returns the
+// last response and how long that attempt took.
+func queryRetrying(ctx context.Context, retries int, log *slog.Logger, send func() (*dns.Msg, error), retryable func(*dns.Msg, error) bool) (*dns.Msg, time.Duration, error) {
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		response, err := send()
+		latency := time.Since(start)
+		if attempt >= retries || !retryable(response, err) {
+			return response, latency, err
+		}
+
+		backoff := retryBackoff << attempt
+		log.Info("retrying query", "attempt", attempt+1, "backoff", backoff, "error", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return response, latency, err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether a query to addr is worth retrying: it failed
+// for a reason other than the check's context ending, or it returned an
+// empty NOERROR answer when records were expected, which some anycast
+// servers do on a first query.
+func (c *checkRun) retryable(ctx context.Context, ns, addr string, response *dns.Msg, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	if response.Rcode != dns.RcodeSuccess || len(answerValues(response.Answer)) > 0 {
+		return false
+	}
+	return c.args.MatchMode != MatchAbsent && len(c.args.expectedFor(ns, addr)) > 0
+}
+
+// checkNSTTL queries addr for the zone's NS records and returns an error
+// listing any whose TTL is below CheckArgs.MinNSTTL.
+func (c *checkRun) checkNSTTL(ctx context.Context, addr string) error {
+	response, err := queryServer(ctx, c.exchanger, addr, c.args.port(), c.zone, TypeNS, false)
+	if err != nil {
+		return fmt.Errorf("NS query for %s failed: %w", c.zone, err)
+	}
+	return nsTTLAtLeast(response.Answer, c.args.MinNSTTL)
+}
+
+// nsTTLAtLeast returns an error listing every NS record in answer whose TTL
+// is below min.
+func nsTTLAtLeast(answer []dns.RR, min time.Duration) error {
+	var short []string
+	for _, record := range answer {
+		ns, ok := record.(*dns.NS)
+		if !ok {
+			continue
+		}
+		ttl := time.Duration(ns.Hdr.Ttl) * time.Second
+		if ttl < min {
+			short = append(short, fmt.Sprintf("%s (%s)", ns.Ns, ttl))
+		}
+	}
+	if len(short) > 0 {
+		return fmt.Errorf("NS TTL below minimum %s: %s", min, strings.Join(short, ", "))
+	}
+	return nil
+}
+
+// acceptedRcode reports whether response is an empty, non-NOERROR answer
+// whose rcode is listed in accept.
+func acceptedRcode(response *dns.Msg, accept []Rcode) bool {
+	rcode := Rcode(response.Rcode)
+	return rcode != RcodeSuccess && len(response.Answer) == 0 && slices.Contains(accept, rcode)
+}
+
+// apexCNAME returns the target of a CNAME at the zone apex in the response's
+// answer section, or an empty string if there is none.
+func apexCNAME(response *dns.Msg, zone string) string {
+	for _, record := range response.Answer {
+		if cname, ok := record.(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, zone) {
+			return cname.Target
+		}
+	}
+	return ""
+}
+
+// cnameTarget returns the target of the CNAME owned by domain in answer, or
+// an empty string if there is none.
+func cnameTarget(answer []dns.RR, domain string) string {
+	for _, record := range answer {
+		if cname, ok := record.(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, dns.Fqdn(domain)) {
+			return cname.Target
+		}
+	}
+	return ""
+}
+
+// followCNAME returns the records of recordType in the response's answer
+// section, skipping CNAMEs. If there are none, it resolves target through the
+// recursive resolver instead.
+func followCNAME(ctx context.Context, ex Exchanger, response *dns.Msg, target string, recordType RecordType, resolver string) ([]dns.RR, error) {
+	if records := filterType(response.Answer, recordType); len(records) > 0 || recordType == TypeCNAME {
+		return records, nil
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(target), uint16(recordType))
+	msg.RecursionDesired = true
+
+	resolved, err := ex.Exchange(ctx, msg, resolver)
+	if err != nil {
+		return nil, err
+	}
+	return filterType(resolved.Answer, recordType), nil
+}
+
+// ResolveValues resolves name through the recursive resolver and returns the
+// values of its records of recordType, following any CNAMEs. It fails if
+// there are none.
+func ResolveValues(ctx context.Context, name string, recordType RecordType, resolver string) ([]string, error) {
+	return defaultChecker.ResolveValues(ctx, name, recordType, resolver)
+}
+
+// ResolveValues is like the package-level ResolveValues but uses c.
+func (c *Checker) ResolveValues(ctx context.Context, name string, recordType RecordType, resolver string) ([]string, error) {
+	return resolveValues(ctx, c.resolverExchanger(), name, recordType, resolver)
+}
+
+func resolveValues(ctx context.Context, ex Exchanger, name string, recordType RecordType, resolver string) ([]string, error) {
+	records, err := resolveRecords(ctx, ex, name, recordType, resolver)
+	if err != nil {
+		return nil, err
+	}
+	return answerValues(records), nil
+}
+
+// resolveRecords resolves name through resolver with ex and returns its
+// records of recordType. It fails if there are none.
+func resolveRecords(ctx context.Context, ex Exchanger, name string, recordType RecordType, resolver string) ([]dns.RR, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), uint16(recordType))
+	msg.RecursionDesired = true
+
+	response, err := ex.Exchange(ctx, msg, resolver)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", name, err)
+	}
+	if response.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("resolving %s: %s", name, Rcode(response.Rcode))
+	}
+	records := filterType(response.Answer, recordType)
+	if len(records) == 0 {
+		return nil, fmt.Errorf("resolving %s: no %s records", name, recordType)
+	}
+	return records, nil
+}
+
+// primaryValues finds the primary nameserver of d's zone from its SOA
+// record, looked up through resolver with rex, and returns its hostname and
+// its values for the check's domain and type. Each of the primary's
+// addresses is tried in turn, using glue if d has any.
+func primaryValues(ctx context.Context, rex, ex Exchanger, args CheckArgs, resolver string, d *delegation) (string, []string, error) {
+	soa, err := resolveValues(ctx, rex, d.zone, TypeSOA, resolver)
+	if err != nil {
+		return "", nil, fmt.Errorf("finding primary nameserver: %w", err)
+	}
+	primary := strings.Fields(soa[0])[0]
+
+	addresses := d.glueFor(primary, args.AddressFamily)
+	if len(addresses) == 0 {
+		if addresses, err = resolveNameserver(ctx, args.hostResolver(), primary, args.AddressFamily); err != nil {
+			return "", nil, fmt.Errorf("primary nameserver %s: %w", primary, err)
+		}
+	}
+	for _, addr := range addresses {
+		var response *dns.Msg
+		response, err = queryServer(ctx, ex, addr, args.port(), args.Domain, args.RecordType, false)
+		if err != nil {
+			continue
+		}
+		if response.Rcode != dns.RcodeSuccess && response.Rcode != dns.RcodeNameError {
+			err = fmt.Errorf("%s returned %s", addr, Rcode(response.Rcode))
+			continue
+		}
+		if !response.Authoritative {
+			err = fmt.Errorf("%s is not authoritative for %s", addr, d.zone)
+			continue
+		}
+		values, _ := args.values(filterType(response.Answer, args.RecordType))
+		return primary, values, nil
+	}
+	return "", nil, fmt.Errorf("primary nameserver %s: %w", primary, err)
+}
+
+// filterType returns the records in answer whose type is recordType.
+func filterType(answer []dns.RR, recordType RecordType) []dns.RR {
+	return filterAnswer(answer, func(record dns.RR) bool {
+		return record.Header().Rrtype == uint16(recordType)
+	})
+}
+
+// filterAnswer returns the records in answer for which keep returns true.
+func filterAnswer(answer []dns.RR, keep func(dns.RR) bool) []dns.RR {
+	var filtered []dns.RR
+	for _, record := range answer {
+		if keep(record) {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+// valuesMatch performs a strict set comparison between got and expected values.
+// Both sets must contain exactly the same elements (order-independent,
+// case-insensitive, FQDN-aware).
+func valuesMatch(got, expected []string) bool {
+	return valuesMatchFunc(got, expected, normalizeValue)
+}
+
+// valuesMatchType is like valuesMatch but compares values using the
+// normalization appropriate for recordType, e.g. CAA records are compared
+// as (flags, tag, value) tuples.
+func valuesMatchType(recordType RecordType, got, expected []string) bool {
+	return valuesMatchFunc(got, expected, comparisonNormalizer(recordType, expected))
+}
+
+// valuesMatchMode compares got with expected according to mode, using the
+// same per-type normalization as valuesMatchType.
+func valuesMatchMode(mode MatchMode, recordType RecordType, got, expected []string) bool {
+	normalize := comparisonNormalizer(recordType, expected)
+	switch mode {
+	case MatchSubset:
+		return valuesContainFunc(got, expected, normalize)
+	case MatchAbsent:
+		return !valuesIntersectFunc(got, expected, normalize)
+	default:
+		return valuesMatchFunc(got, expected, normalize)
+	}
+}
+
+// valuesDiff returns the expected values missing from got and the values in
+// got that weren't expected, as they matter to mode, comparing normalized
+// values like valuesMatchMode. Repeated values are counted.
+func valuesDiff(mode MatchMode, recordType RecordType, got, expected []string) (missing, unexpected []string) {
+	normalize := comparisonNormalizer(recordType, expected)
+	gotCounts := make(map[string]int, len(got))
+	for _, v := range got {
+		gotCounts[normalize(v)]++
+	}
+	expectedCounts := make(map[string]int, len(expected))
+	for _, v := range expected {
+		expectedCounts[normalize(v)]++
+	}
+
+	if mode == MatchAbsent {
+		for _, v := range got {
+			if expectedCounts[normalize(v)] > 0 {
+				unexpected = append(unexpected, v)
+			}
+		}
+		return nil, unexpected
+	}
+	for _, v := range expected {
+		if key := normalize(v); gotCounts[key] > 0 {
+			gotCounts[key]--
+		} else {
+			missing = append(missing, v)
+		}
+	}
+	if mode == MatchSubset {
+		return missing, nil
+	}
+	for _, v := range got {
+		if key := normalize(v); expectedCounts[key] > 0 {
+			expectedCounts[key]--
+		} else {
+			unexpected = append(unexpected, v)
+		}
+	}
+	return missing, unexpected
+}
+
+// valuesContainFunc reports whether every value in expected appears in got,
+// comparing normalized values. Repeated expected values must appear as many
+// times in got.
+func valuesContainFunc(got, expected []string, normalize func(string) string) bool {
+	gotSet := make(map[string]int, len(got))
+	for _, v := range got {
+		gotSet[normalize(v)]++
+	}
+	for _, v := range expected {
+		key := normalize(v)
+		if gotSet[key] == 0 {
+			return false
+		}
+		gotSet[key]--
+	}
+	return true
+}
+
+// valuesIntersectFunc reports whether any value in expected appears in got,
+// comparing normalized values.
+func valuesIntersectFunc(got, expected []string, normalize func(string) string) bool {
+	gotSet := make(map[string]bool, len(got))
+	for _, v := range got {
+		gotSet[normalize(v)] = true
+	}
+	for _, v := range expected {
+		if gotSet[normalize(v)] {
+			return true
+		}
+	}
+	return false
+}
+
+// comparisonNormalizer is like normalizerFor but lets the form of the
+// expected values select a looser comparison, e.g. comparing only the
+// serials of SOA records when only serials are expected.
+func comparisonNormalizer(recordType RecordType, expected []string) func(string) string {
+	switch recordType {
+	case TypeSOA:
+		return soaNormalizer(expected)
+	case TypeSRV:
+		return srvNormalizer(expected)
+	case TypeMX:
+		return mxNormalizer(expected)
+	default:
+		return normalizerFor(recordType)
+	}
+}
+
+// normalizerFor returns the function that puts values of recordType into a
+// canonical form for comparison.
+func normalizerFor(recordType RecordType) func(string) string {
+	switch recordType {
+	case TypeCAA:
+		return normalizeCAA
+	case TypeSOA:
+		return normalizeSOA
+	case TypeSRV:
+		return normalizeSRV
+	case TypeMX:
+		return normalizeMX
+	case TypeTLSA:
+		return normalizeTLSA
+	case TypeDS:
+		return normalizeDS
+	case TypeDNSKEY:
+		return normalizeDNSKEY
+	default:
+		return normalizeValue
+	}
+}
+
+// normalizeValue lowercases s and strips a trailing dot.
+func normalizeValue(s string) string {
+	return strings.ToLower(strings.TrimSuffix(s, "."))
+}
+
+func valuesMatchFunc(got, expected []string, normalize func(string) string) bool {
+	if len(got) != len(expected) {
+		return false
 	}
 
 	expectedSet := make(map[string]int, len(expected))
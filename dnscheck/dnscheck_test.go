@@ -1,7 +1,27 @@
 package dnscheck
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/miekg/dns"
 )
 
 func TestParseRecordType(t *testing.T) {
@@ -15,16 +35,24 @@ func TestParseRecordType(t *testing.T) {
 		{"CNAME", TypeCNAME, false},
 		{"TXT", TypeTXT, false},
 		{"MX", TypeMX, false},
+		{"AFSDB", TypeAFSDB, false},
+		{"RT", TypeRT, false},
+		{"NS", TypeNS, false},
+		{"SOA", TypeSOA, false},
+		{"PTR", TypePTR, false},
+		{"SRV", TypeSRV, false},
+		{"CAA", TypeCAA, false},
 		// case insensitivity
 		{"a", TypeA, false},
 		{"aaaa", TypeAAAA, false},
 		{"cname", TypeCNAME, false},
 		{"Txt", TypeTXT, false},
 		{"mx", TypeMX, false},
+		{"afsdb", TypeAFSDB, false},
+		{"ns", TypeNS, false},
 		// invalid
 		{"INVALID", 0, true},
 		{"", 0, true},
-		{"NS", 0, true},
 	}
 
 	for _, tt := range tests {
@@ -41,6 +69,56 @@ func TestParseRecordType(t *testing.T) {
 	}
 }
 
+func TestReverseName(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"192.0.2.25", "25.2.0.192.in-addr.arpa."},
+		{"2001:db8::1", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+		{"mail.example.com", "mail.example.com"},
+		{"25.2.0.192.in-addr.arpa.", "25.2.0.192.in-addr.arpa."},
+	}
+	for _, tt := range tests {
+		if got := ReverseName(tt.input); got != tt.want {
+			t.Errorf("ReverseName(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		input, want, wantErr string
+	}{
+		{input: "example.com", want: "example.com"},
+		{input: "  Example.COM.\n", want: "example.com"},
+		{input: "https://www.example.com/path?q=1", want: "www.example.com"},
+		{input: "http://example.com:8080/", want: "example.com"},
+		{input: "example.com/path", want: "example.com"},
+		{input: "example.com:443", want: "example.com"},
+		{input: "_dmarc.example.com", want: "_dmarc.example.com"},
+		{input: "*.example.com", want: "*.example.com"},
+		{input: "25.2.0.192.in-addr.arpa.", want: "25.2.0.192.in-addr.arpa"},
+		{input: "   ", wantErr: "no hostname"},
+		{input: "https:///path", wantErr: "no hostname"},
+		{input: "example..com", wantErr: "empty label"},
+		{input: "exa mple.com", wantErr: "isn't allowed"},
+		{input: "www.*.example.com", wantErr: "isn't allowed"},
+		{input: strings.Repeat("a", 64) + ".com", wantErr: "longer than 63"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeDomain(tt.input)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NormalizeDomain(%q) error = %v, want it to contain %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeDomain(%q) = %q, %v; want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
+
 func TestParseRecordTypeErrorMessage(t *testing.T) {
 	_, err := ParseRecordType("BOGUS")
 	if err == nil {
@@ -62,6 +140,13 @@ func TestRecordTypeString(t *testing.T) {
 		{TypeCNAME, "CNAME"},
 		{TypeTXT, "TXT"},
 		{TypeMX, "MX"},
+		{TypeNS, "NS"},
+		{TypeSOA, "SOA"},
+		{TypePTR, "PTR"},
+		{TypeSRV, "SRV"},
+		{TypeCAA, "CAA"},
+		{TypeAFSDB, "AFSDB"},
+		{TypeRT, "RT"},
 		{RecordType(9999), "UNKNOWN(9999)"},
 	}
 
@@ -181,3 +266,2111 @@ func TestValuesMatch(t *testing.T) {
 		})
 	}
 }
+
+func TestAnswerValues(t *testing.T) {
+	tests := []struct {
+		record string
+		want   string
+	}{
+		{"example.com. 300 IN MX 10 mx1.example.com.", "10 mx1.example.com."},
+		{"_sip._udp.example.com. 300 IN SRV 10 5 5060 sip1.example.com.", "10 5 5060 sip1.example.com."},
+		{"_25._tcp.mail.example.com. 300 IN TLSA 3 1 1 0C72AC70B745AC19998811B131D662C9AC69DBDBE7CB23E5B514B56664C5D3D6", "3 1 1 0c72ac70b745ac19998811b131d662c9ac69dbdbe7cb23e5b514b56664c5d3d6"},
+		{"example.com. 3600 IN DS 55648 13 2 B4C8C1FE2E7477127B27115656AD6256F424625BF5C1E2770CE6D6E37DF61D17", "55648 13 2 b4c8c1fe2e7477127b27115656ad6256f424625bf5c1e2770ce6d6e37df61d17"},
+		{"example.com. 3600 IN DNSKEY 257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ==", "257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ=="},
+	}
+	for _, tt := range tests {
+		values := answerValues([]dns.RR{mustRR(t, tt.record)})
+		if len(values) != 1 || values[0] != tt.want {
+			t.Errorf("answerValues(%q) = %q, want [%q]", tt.record, values, tt.want)
+		}
+	}
+}
+
+func TestValuesMatchType(t *testing.T) {
+	mx := []string{
+		"example.com. 300 IN MX 10 mx1.example.com.",
+		"example.com. 300 IN MX 20 mx2.example.com.",
+	}
+	srv := []string{
+		"_sip._udp.example.com. 300 IN SRV 10 5 5060 sip1.example.com.",
+		"_sip._udp.example.com. 300 IN SRV 20 0 5060 sip2.example.com.",
+	}
+	tlsa := []string{"_25._tcp.mail.example.com. 300 IN TLSA 3 1 1 0C72AC70B745AC19998811B131D662C9AC69DBDBE7CB23E5B514B56664C5D3D6"}
+	ds := []string{"example.com. 3600 IN DS 55648 13 2 B4C8C1FE2E7477127B27115656AD6256F424625BF5C1E2770CE6D6E37DF61D17"}
+	const key = "mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ=="
+	dnskey := []string{"example.com. 3600 IN DNSKEY 257 3 13 " + key}
+
+	tests := []struct {
+		name     string
+		rt       RecordType
+		answer   []string
+		expected []string
+		want     bool
+	}{
+		{"MX full", TypeMX, mx, []string{"20 MX2.example.com", "10 mx1.example.com"}, true},
+		{"MX full, extra spaces", TypeMX, mx, []string{"10  mx1.example.com.", "20 mx2.example.com."}, true},
+		{"MX full, swapped preferences", TypeMX, mx, []string{"20 mx1.example.com", "10 mx2.example.com"}, false},
+		{"MX hosts", TypeMX, mx, []string{"mx1.example.com", "mx2.example.com."}, true},
+		{"MX hosts, one missing", TypeMX, mx, []string{"mx1.example.com", "mx3.example.com"}, false},
+		{"SRV full", TypeSRV, srv, []string{"20 0 5060 SIP2.example.com", "10 5 5060 sip1.example.com"}, true},
+		{"SRV full, extra spaces", TypeSRV, srv, []string{"10  5 5060 sip1.example.com.", "20 0 5060 sip2.example.com."}, true},
+		{"SRV full, different weight", TypeSRV, srv, []string{"10 1 5060 sip1.example.com", "20 0 5060 sip2.example.com"}, false},
+		{"SRV port and target", TypeSRV, srv, []string{"5060 sip1.example.com", "5060 sip2.example.com."}, true},
+		{"SRV port and target, wrong port", TypeSRV, srv, []string{"5061 sip1.example.com", "5060 sip2.example.com"}, false},
+		{"TLSA lowercase", TypeTLSA, tlsa, []string{"3 1 1 0c72ac70b745ac19998811b131d662c9ac69dbdbe7cb23e5b514b56664c5d3d6"}, true},
+		{"TLSA uppercase", TypeTLSA, tlsa, []string{"3 1 1 0C72AC70B745AC19998811B131D662C9AC69DBDBE7CB23E5B514B56664C5D3D6"}, true},
+		{"TLSA split hex", TypeTLSA, tlsa, []string{"3  1 1 0c72ac70b745ac19998811b131d662c9 ac69dbdbe7cb23e5b514b56664c5d3d6"}, true},
+		{"TLSA different selector", TypeTLSA, tlsa, []string{"3 0 1 0c72ac70b745ac19998811b131d662c9ac69dbdbe7cb23e5b514b56664c5d3d6"}, false},
+		{"TLSA different hash", TypeTLSA, tlsa, []string{"3 1 1 1c72ac70b745ac19998811b131d662c9ac69dbdbe7cb23e5b514b56664c5d3d6"}, false},
+		{"DS lowercase", TypeDS, ds, []string{"55648 13 2 b4c8c1fe2e7477127b27115656ad6256f424625bf5c1e2770ce6d6e37df61d17"}, true},
+		{"DS uppercase", TypeDS, ds, []string{"55648 13 2 B4C8C1FE2E7477127B27115656AD6256F424625BF5C1E2770CE6D6E37DF61D17"}, true},
+		{"DS split digest", TypeDS, ds, []string{"55648 13 2 b4c8c1fe2e7477127b27115656ad6256 f424625bf5c1e2770ce6d6e37df61d17"}, true},
+		{"DS different key tag", TypeDS, ds, []string{"55649 13 2 b4c8c1fe2e7477127b27115656ad6256f424625bf5c1e2770ce6d6e37df61d17"}, false},
+		{"DS different digest type", TypeDS, ds, []string{"55648 13 1 b4c8c1fe2e7477127b27115656ad6256f424625bf5c1e2770ce6d6e37df61d17"}, false},
+		{"DNSKEY exact", TypeDNSKEY, dnskey, []string{"257 3 13 " + key}, true},
+		{"DNSKEY split key", TypeDNSKEY, dnskey, []string{"257  3 13 " + key[:44] + " " + key[44:]}, true},
+		{"DNSKEY zone signing key", TypeDNSKEY, dnskey, []string{"256 3 13 " + key}, false},
+		{"DNSKEY different case", TypeDNSKEY, dnskey, []string{"257 3 13 " + strings.ToUpper(key)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var answer []dns.RR
+			for _, s := range tt.answer {
+				answer = append(answer, mustRR(t, s))
+			}
+			values := answerValues(answer)
+			if got := valuesMatchType(tt.rt, values, tt.expected); got != tt.want {
+				t.Errorf("valuesMatchType(%s, %q, %q) = %v, want %v", tt.rt, values, tt.expected, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValuesMatchMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     MatchMode
+		got      []string
+		expected []string
+		want     bool
+	}{
+		{"exact, same set", MatchExact, []string{"1.1.1.1", "1.0.0.1"}, []string{"1.0.0.1", "1.1.1.1"}, true},
+		{"exact, extra value", MatchExact, []string{"1.1.1.1", "1.0.0.1"}, []string{"1.1.1.1"}, false},
+		{"subset, same set", MatchSubset, []string{"1.1.1.1", "1.0.0.1"}, []string{"1.0.0.1", "1.1.1.1"}, true},
+		{"subset, extra value", MatchSubset, []string{"1.1.1.1", "1.0.0.1"}, []string{"1.1.1.1"}, true},
+		{"subset, missing value", MatchSubset, []string{"1.1.1.1"}, []string{"1.1.1.1", "1.0.0.1"}, false},
+		{"subset, normalized", MatchSubset, []string{"Mail.Example.com.", "mx2.example.com."}, []string{"mail.example.com"}, true},
+		{"subset, nothing expected", MatchSubset, []string{"1.1.1.1"}, nil, true},
+		{"subset, duplicate expected", MatchSubset, []string{"a"}, []string{"a", "a"}, false},
+		{"absent, none present", MatchAbsent, []string{"192.0.2.2"}, []string{"192.0.2.1"}, true},
+		{"absent, one present", MatchAbsent, []string{"192.0.2.2", "192.0.2.1"}, []string{"192.0.2.1", "192.0.2.9"}, false},
+		{"absent, empty answer", MatchAbsent, nil, []string{"192.0.2.1"}, true},
+		{"absent, normalized", MatchAbsent, []string{"Old.Example.com."}, []string{"old.example.com"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := valuesMatchMode(tt.mode, TypeA, tt.got, tt.expected); got != tt.want {
+				t.Errorf("valuesMatchMode(%d, %v, %v) = %v, want %v", tt.mode, tt.got, tt.expected, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValuesDiff(t *testing.T) {
+	tests := []struct {
+		name           string
+		mode           MatchMode
+		got, expected  []string
+		wantMissing    []string
+		wantUnexpected []string
+	}{
+		{"exact, same set", MatchExact, []string{"1.1.1.1", "1.0.0.1"}, []string{"1.0.0.1", "1.1.1.1"}, nil, nil},
+		{"exact, both", MatchExact, []string{"1.1.1.1", "9.9.9.9"}, []string{"1.1.1.1", "1.0.0.1"}, []string{"1.0.0.1"}, []string{"9.9.9.9"}},
+		{"exact, normalized", MatchExact, []string{"Mail.Example.com."}, []string{"mail.example.com"}, nil, nil},
+		{"exact, duplicate expected", MatchExact, []string{"a"}, []string{"a", "a"}, []string{"a"}, nil},
+		{"subset, extra value", MatchSubset, []string{"1.1.1.1", "9.9.9.9"}, []string{"1.1.1.1", "1.0.0.1"}, []string{"1.0.0.1"}, nil},
+		{"absent, one present", MatchAbsent, []string{"192.0.2.2", "192.0.2.1"}, []string{"192.0.2.1", "192.0.2.9"}, nil, []string{"192.0.2.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing, unexpected := valuesDiff(tt.mode, TypeA, tt.got, tt.expected)
+			if !slices.Equal(missing, tt.wantMissing) || !slices.Equal(unexpected, tt.wantUnexpected) {
+				t.Errorf("valuesDiff(%d, %v, %v) = %v, %v; want %v, %v", tt.mode, tt.got, tt.expected, missing, unexpected, tt.wantMissing, tt.wantUnexpected)
+			}
+		})
+	}
+}
+
+func TestApexCNAME(t *testing.T) {
+	response := new(dns.Msg)
+	response.Answer = []dns.RR{
+		mustRR(t, "www.example.com. 300 IN CNAME lb.example.net."),
+	}
+	if got := apexCNAME(response, "example.com."); got != "" {
+		t.Errorf("apexCNAME() for non-apex CNAME = %q, want empty", got)
+	}
+
+	response.Answer = []dns.RR{
+		mustRR(t, "Example.COM. 300 IN CNAME lb.example.net."),
+		mustRR(t, "lb.example.net. 300 IN A 192.0.2.1"),
+	}
+	if got := apexCNAME(response, "example.com."); got != "lb.example.net." {
+		t.Errorf("apexCNAME() = %q, want %q", got, "lb.example.net.")
+	}
+}
+
+func TestFollowCNAMEUsesAnswerChain(t *testing.T) {
+	response := new(dns.Msg)
+	response.Answer = []dns.RR{
+		mustRR(t, "example.com. 300 IN CNAME lb.example.net."),
+		mustRR(t, "lb.example.net. 300 IN A 192.0.2.1"),
+		mustRR(t, "lb.example.net. 300 IN A 192.0.2.2"),
+	}
+	// The resolver is never contacted because the answer already contains
+	// the records the CNAME points to.
+	got, err := followCNAME(context.Background(), defaultTransport, response, "lb.example.net.", TypeA, "")
+	if err != nil {
+		t.Fatalf("followCNAME() error: %v", err)
+	}
+	if !valuesMatch(answerValues(got), []string{"192.0.2.1", "192.0.2.2"}) {
+		t.Errorf("followCNAME() = %v, want the A records only", got)
+	}
+}
+
+func TestNewTransportLocalPort(t *testing.T) {
+	if got := newTransport(CheckArgs{}); got != defaultTransport {
+		t.Errorf("newTransport() = %p, want defaultTransport", got)
+	}
+
+	tr := newTransport(CheckArgs{LocalPort: 5300})
+	if addr, ok := tr.udp.Dialer.LocalAddr.(*net.UDPAddr); !ok || addr.Port != 5300 {
+		t.Errorf("UDP dialer LocalAddr = %v, want port 5300", tr.udp.Dialer.LocalAddr)
+	}
+	if addr, ok := tr.tcp.Dialer.LocalAddr.(*net.TCPAddr); !ok || addr.Port != 5300 {
+		t.Errorf("TCP dialer LocalAddr = %v, want port 5300", tr.tcp.Dialer.LocalAddr)
+	}
+}
+
+func TestTransportLocalPortIsUsed(t *testing.T) {
+	// Reserve a free port to use as the source port, then release it.
+	reserved, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket error: %v", err)
+	}
+	localPort := reserved.LocalAddr().(*net.UDPAddr).Port
+	reserved.Close()
+
+	remotePorts := make(chan int, 1)
+	addr := startTestServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		remotePorts <- w.RemoteAddr().(*net.UDPAddr).Port
+		m := new(dns.Msg)
+		m.SetReply(r)
+		w.WriteMsg(m)
+	})
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+	if _, err := newTransport(CheckArgs{LocalPort: localPort}).Exchange(context.Background(), msg, addr); err != nil {
+		t.Fatalf("exchange error: %v", err)
+	}
+	if got := <-remotePorts; got != localPort {
+		t.Errorf("query source port = %d, want %d", got, localPort)
+	}
+}
+
+func TestQueryServerRcodeError(t *testing.T) {
+	addr := startTestServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		w.WriteMsg(m)
+	})
+	host, port, _ := net.SplitHostPort(addr)
+
+	_, _, err := QueryServer(context.Background(), host, port, "missing.example.com", TypeA, nil, 0)
+	var rcodeErr *RcodeError
+	if !errors.As(err, &rcodeErr) || rcodeErr.Rcode != RcodeNXDomain {
+		t.Errorf("QueryServer() error = %v, want NXDOMAIN RcodeError", err)
+	}
+}
+
+func TestQueryServerRetries(t *testing.T) {
+	var attempts atomic.Int32
+	addr := startTestServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if attempts.Add(1) > 1 {
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+				A:   net.ParseIP("192.0.2.1"),
+			})
+		}
+		w.WriteMsg(m)
+	})
+	host, port, _ := net.SplitHostPort(addr)
+
+	values, _, err := QueryServer(context.Background(), host, port, "www.example.com", TypeA, nil, 1)
+	if err != nil || !slices.Equal(values, []string{"192.0.2.1"}) {
+		t.Errorf("QueryServer() = %v, %v, want [192.0.2.1] after a retry", values, err)
+	}
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("QueryServer() made %d attempts, want 2", got)
+	}
+}
+
+func TestQueryServerMsg(t *testing.T) {
+	soa := mustRR(t, "example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 2024010101 7200 3600 1209600 300")
+	addr := startTestServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		m.Authoritative = true
+		m.Ns = append(m.Ns, soa)
+		w.WriteMsg(m)
+	})
+	host, port, _ := net.SplitHostPort(addr)
+
+	response, err := QueryServerMsg(context.Background(), host, port, "missing.example.com", TypeA)
+	if err != nil {
+		t.Fatalf("QueryServerMsg() error: %v", err)
+	}
+	if response.Rcode != dns.RcodeNameError || !response.Authoritative {
+		t.Errorf("response = %v, want an authoritative NXDOMAIN", response)
+	}
+	if len(response.Ns) != 1 || response.Ns[0].Header().Rrtype != dns.TypeSOA {
+		t.Errorf("authority section = %v, want the SOA record", response.Ns)
+	}
+
+	if _, err := QueryServerMsg(context.Background(), host, "0", "example.com", TypeA); err == nil {
+		t.Error("QueryServerMsg() with port 0 succeeded, want error")
+	}
+}
+
+func TestQueryServerSkipsCNAME(t *testing.T) {
+	addr := startTestServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		for _, s := range []string{
+			"www.example.com. 300 IN CNAME lb.example.com.",
+			"lb.example.com. 300 IN A 192.0.2.1",
+			"lb.example.com. 300 IN A 192.0.2.2",
+		} {
+			rr, _ := dns.NewRR(s)
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})
+	host, port, _ := net.SplitHostPort(addr)
+
+	values, _, err := QueryServer(context.Background(), host, port, "www.example.com", TypeA, nil, 0)
+	if err != nil {
+		t.Fatalf("QueryServer() error: %v", err)
+	}
+	if want := []string{"192.0.2.1", "192.0.2.2"}; !slices.Equal(values, want) {
+		t.Errorf("QueryServer() = %v, want %v", values, want)
+	}
+}
+
+func TestCheckCNAMEAnswer(t *testing.T) {
+	tests := []struct {
+		name       string
+		answer     []string
+		wantValues []string
+		wantMatch  bool
+	}{
+		{
+			name: "in-zone target",
+			answer: []string{
+				"www.example.com. 300 IN CNAME lb.example.com.",
+				"lb.example.com. 300 IN A 192.0.2.1",
+				"lb.example.com. 300 IN TXT \"not an address\"",
+			},
+			wantValues: []string{"192.0.2.1"},
+			wantMatch:  true,
+		},
+		{
+			name:      "out-of-zone target",
+			answer:    []string{"www.example.com. 300 IN CNAME lb.example.net."},
+			wantMatch: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exchanger := fakeExchanger{
+				"resolver:53":   reply(t, "example.com. 300 IN NS ns1.example.com."),
+				"192.0.2.53:53": reply(t, tt.answer...),
+			}
+			result, err := Check(context.Background(), CheckArgs{
+				Domain:       "www.example.com",
+				RecordType:   TypeA,
+				Expected:     []string{"192.0.2.1"},
+				Resolver:     "resolver:53",
+				Exchanger:    exchanger,
+				HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.53"}},
+			})
+			if err != nil {
+				t.Fatalf("Check() error: %v", err)
+			}
+			s := result.Servers[0]
+			if !slices.Equal(s.Values, tt.wantValues) || s.Match != tt.wantMatch {
+				t.Errorf("Values = %v, Match = %v; want %v, %v", s.Values, s.Match, tt.wantValues, tt.wantMatch)
+			}
+			if want := strings.Fields(tt.answer[0])[4]; s.CNAME != want {
+				t.Errorf("CNAME = %q, want %q", s.CNAME, want)
+			}
+		})
+	}
+}
+
+func TestSystemResolver(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "resolv.conf")
+	if err := os.WriteFile(path, []byte("search example.com\nnameserver 192.0.2.53\nnameserver 2001:db8::53\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(old string) { resolvConfPath = old }(resolvConfPath)
+
+	tests := []struct {
+		path string
+		args CheckArgs
+		want string
+	}{
+		{path, CheckArgs{SystemResolver: true}, "192.0.2.53:53"},
+		{path, CheckArgs{SystemResolver: true, Resolver: "198.51.100.1:53"}, "198.51.100.1:53"},
+		{path, CheckArgs{}, DefaultResolver},
+		{filepath.Join(dir, "missing"), CheckArgs{SystemResolver: true}, DefaultResolver},
+	}
+	for _, tt := range tests {
+		resolvConfPath = tt.path
+		if got := tt.args.resolver(); got != tt.want {
+			t.Errorf("resolver() with %+v and %s = %q, want %q", tt.args, filepath.Base(tt.path), got, tt.want)
+		}
+	}
+}
+
+func TestTransportForceTCP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket error: %v", err)
+	}
+	listener, err := net.Listen("tcp", conn.LocalAddr().String())
+	if err != nil {
+		conn.Close()
+		t.Skipf("TCP port in use: %v", err)
+	}
+
+	networks := make(chan string, 2)
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		networks <- w.RemoteAddr().Network()
+		m := new(dns.Msg)
+		m.SetReply(r)
+		w.WriteMsg(m)
+	})
+	for _, server := range []*dns.Server{{PacketConn: conn, Handler: handler}, {Listener: listener, Handler: handler}} {
+		go server.ActivateAndServe()
+		t.Cleanup(func() { server.Shutdown() })
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+	if _, err := newTransport(CheckArgs{ForceTCP: true}).Exchange(context.Background(), msg, listener.Addr().String()); err != nil {
+		t.Fatalf("exchange error: %v", err)
+	}
+	if got := <-networks; got != "tcp" {
+		t.Errorf("query sent over %s, want tcp", got)
+	}
+}
+
+func TestTransportRetriesTruncatedOverTCP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket error: %v", err)
+	}
+	listener, err := net.Listen("tcp", conn.LocalAddr().String())
+	if err != nil {
+		conn.Close()
+		t.Skipf("TCP port in use: %v", err)
+	}
+
+	answer := mustRR(t, `example.com. 300 IN TXT "long record"`)
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if w.RemoteAddr().Network() == "udp" {
+			m.Truncated = true
+		} else {
+			m.Answer = append(m.Answer, answer)
+		}
+		w.WriteMsg(m)
+	})
+	for _, server := range []*dns.Server{{PacketConn: conn, Handler: handler}, {Listener: listener, Handler: handler}} {
+		go server.ActivateAndServe()
+		t.Cleanup(func() { server.Shutdown() })
+	}
+
+	for _, args := range []CheckArgs{{}, {DetectSpoofing: true}} {
+		msg := new(dns.Msg)
+		msg.SetQuestion("example.com.", dns.TypeTXT)
+		response, err := newTransport(args).Exchange(context.Background(), msg, listener.Addr().String())
+		if err != nil {
+			t.Fatalf("DetectSpoofing=%v: exchange error: %v", args.DetectSpoofing, err)
+		}
+		if response.Truncated || len(response.Answer) != 1 {
+			t.Errorf("DetectSpoofing=%v: response = %v, want the full answer over TCP", args.DetectSpoofing, response)
+		}
+	}
+}
+
+func TestCheckTruncatedResponse(t *testing.T) {
+	for _, retries := range []int{0, 1} {
+		answer := reply(t, "example.com. 300 IN MX 10 mx1.example.com.", "example.com. 300 IN MX 20 mx2.example.com.")
+		var queries int
+		exchanger := fakeExchanger{
+			"resolver:53": reply(t, "example.com. 300 IN NS ns1.example.com."),
+			"192.0.2.53:53": func(msg *dns.Msg) *dns.Msg {
+				queries++
+				response := answer(msg)
+				if queries == 1 {
+					response.Answer = response.Answer[:1]
+					response.Truncated = true
+				}
+				return response
+			},
+		}
+		result, err := Check(context.Background(), CheckArgs{
+			Domain:       "example.com",
+			RecordType:   TypeMX,
+			Expected:     []string{"mx1.example.com.", "mx2.example.com."},
+			Retries:      retries,
+			Resolver:     "resolver:53",
+			Exchanger:    exchanger,
+			HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.53"}},
+		})
+		if err != nil {
+			t.Fatalf("Check() error: %v", err)
+		}
+		s := result.Servers[0]
+		if retries == 0 && !errors.Is(s.Error, ErrTruncated) {
+			t.Errorf("Retries=0: Error = %v, want ErrTruncated", s.Error)
+		}
+		if retries == 1 && !s.Match {
+			t.Errorf("Retries=1: server = %+v, want a match on the full answer", s)
+		}
+	}
+}
+
+func TestParseTLSAddress(t *testing.T) {
+	tests := []struct {
+		address, hostport, serverName string
+		ok                            bool
+	}{
+		{"tls://1.1.1.1", "1.1.1.1:853", "1.1.1.1", true},
+		{"tls://dns.google:8853", "dns.google:8853", "dns.google", true},
+		{"tls://[2606:4700:4700::1111]", "[2606:4700:4700::1111]:853", "2606:4700:4700::1111", true},
+		{"8.8.8.8:53", "", "", false},
+	}
+	for _, tt := range tests {
+		hostport, serverName, ok := parseTLSAddress(tt.address)
+		if hostport != tt.hostport || serverName != tt.serverName || ok != tt.ok {
+			t.Errorf("parseTLSAddress(%q) = %q, %q, %v, want %q, %q, %v", tt.address, hostport, serverName, ok, tt.hostport, tt.serverName, tt.ok)
+		}
+	}
+}
+
+func TestExchangeTLSVerifiesCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+	server := &dns.Server{Listener: listener, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		w.WriteMsg(m)
+	})}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+
+	// The self-signed certificate isn't trusted, so the query must fail
+	// rather than silently skipping verification.
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeNS)
+	_, err = defaultTransport.Exchange(context.Background(), msg, "tls://"+listener.Addr().String())
+	var verifyErr *tls.CertificateVerificationError
+	if !errors.As(err, &verifyErr) {
+		t.Errorf("Exchange() error = %v, want certificate verification error", err)
+	}
+}
+
+func TestNSTTLAtLeast(t *testing.T) {
+	answer := []dns.RR{
+		mustRR(t, "example.com. 86400 IN NS ns1.example.com."),
+		mustRR(t, "example.com. 300 IN NS ns2.example.com."),
+	}
+
+	if err := nsTTLAtLeast(answer, time.Hour); err == nil {
+		t.Error("nsTTLAtLeast(1h) = nil, want error for ns2")
+	} else if !strings.Contains(err.Error(), "ns2.example.com.") || strings.Contains(err.Error(), "ns1.example.com.") {
+		t.Errorf("nsTTLAtLeast(1h) error = %q, want only ns2 reported", err)
+	}
+
+	if err := nsTTLAtLeast(answer, 5*time.Minute); err != nil {
+		t.Errorf("nsTTLAtLeast(5m) = %v, want nil", err)
+	}
+}
+
+func TestParseRcode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Rcode
+		wantErr bool
+	}{
+		{"NOERROR", RcodeSuccess, false},
+		{"nxdomain", RcodeNXDomain, false},
+		{"SERVFAIL", RcodeServFail, false},
+		{"Refused", RcodeRefused, false},
+		{"BOGUS", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseRcode(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRcode(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRcode(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAcceptedRcode(t *testing.T) {
+	refused := new(dns.Msg)
+	refused.Rcode = dns.RcodeRefused
+
+	refusedWithAnswer := new(dns.Msg)
+	refusedWithAnswer.Rcode = dns.RcodeRefused
+	refusedWithAnswer.Answer = []dns.RR{mustRR(t, "example.com. 300 IN A 192.0.2.1")}
+
+	noError := new(dns.Msg)
+
+	tests := []struct {
+		name     string
+		response *dns.Msg
+		accept   []Rcode
+		want     bool
+	}{
+		{"default rejects REFUSED", refused, nil, false},
+		{"override accepts REFUSED", refused, []Rcode{RcodeRefused}, true},
+		{"override for other rcode", refused, []Rcode{RcodeNXDomain}, false},
+		{"answers are still compared", refusedWithAnswer, []Rcode{RcodeRefused}, false},
+		{"NOERROR is always compared", noError, []Rcode{RcodeSuccess}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := acceptedRcode(tt.response, tt.accept); got != tt.want {
+				t.Errorf("acceptedRcode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddressFamilyIncludes(t *testing.T) {
+	tests := []struct {
+		family AddressFamily
+		addr   string
+		want   bool
+	}{
+		{FamilyIPv4, "192.0.2.1", true},
+		{FamilyIPv4, "2001:db8::1", false},
+		{FamilyIPv6, "192.0.2.1", false},
+		{FamilyIPv6, "2001:db8::1", true},
+		{FamilyBoth, "192.0.2.1", true},
+		{FamilyBoth, "2001:db8::1", true},
+		{FamilyBoth, "not-an-ip", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.family.String()+"/"+tt.addr, func(t *testing.T) {
+			if got := tt.family.includes(tt.addr); got != tt.want {
+				t.Errorf("%v.includes(%q) = %v, want %v", tt.family, tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+// startTestServer starts a DNS server on a local UDP port that answers every
+// query with handler, and returns its address.
+func startTestServer(t *testing.T, handler dns.HandlerFunc) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket error: %v", err)
+	}
+	server := &dns.Server{PacketConn: conn, Handler: handler}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return conn.LocalAddr().String()
+}
+
+func TestExchangeDetectSpoofing(t *testing.T) {
+	tests := []struct {
+		name    string
+		mangle  func(m *dns.Msg)
+		wantErr error
+	}{
+		{
+			name:   "matching response",
+			mangle: func(m *dns.Msg) {},
+		},
+		{
+			name:    "mismatched ID",
+			mangle:  func(m *dns.Msg) { m.Id++ },
+			wantErr: ErrSpoofedResponse,
+		},
+		{
+			name:    "mismatched question",
+			mangle:  func(m *dns.Msg) { m.Question[0].Name = "attacker.example." },
+			wantErr: ErrSpoofedResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := startTestServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+				m := new(dns.Msg)
+				m.SetReply(r)
+				tt.mangle(m)
+				w.WriteMsg(m)
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			msg := new(dns.Msg)
+			msg.SetQuestion("example.com.", dns.TypeA)
+			_, err := newTransport(CheckArgs{DetectSpoofing: true}).Exchange(ctx, msg, addr)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("exchange() error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("exchange() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFilterAnswer(t *testing.T) {
+	answer := []dns.RR{
+		mustRR(t, "example.com. 300 IN A 192.0.2.1"),
+		mustRR(t, "example.com. 30 IN A 192.0.2.2"),
+		mustRR(t, "example.com. 300 IN A 192.0.2.3"),
+	}
+	minTTL := func(record dns.RR) bool { return record.Header().Ttl >= 60 }
+
+	got := answerValues(filterAnswer(answer, minTTL))
+	want := []string{"192.0.2.1", "192.0.2.3"}
+	if !valuesMatch(got, want) {
+		t.Errorf("answerValues(filterAnswer()) = %v, want %v", got, want)
+	}
+}
+
+func TestFindZoneDedupesNameservers(t *testing.T) {
+	resolver := startTestServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if r.Question[0].Name == "example.com." {
+			m.Answer = []dns.RR{
+				mustRR(t, "example.com. 300 IN NS ns1.example.com."),
+				mustRR(t, "example.com. 300 IN NS NS1.Example.COM."),
+				mustRR(t, "example.com. 300 IN NS ns2.example.com."),
+				mustRR(t, "example.com. 300 IN NS ns1.example.com."),
+			}
+		}
+		w.WriteMsg(m)
+	})
+
+	d, err := findZone(context.Background(), defaultTransport, "www.example.com", resolver)
+	if err != nil {
+		t.Fatalf("findZone() error: %v", err)
+	}
+	if d.zone != "example.com." {
+		t.Errorf("zone = %q, want %q", d.zone, "example.com.")
+	}
+	want := []string{"ns1.example.com.", "ns2.example.com."}
+	if !slices.Equal(d.nameservers, want) {
+		t.Errorf("nameservers = %v, want %v", d.nameservers, want)
+	}
+	if d.duplicates != 2 {
+		t.Errorf("duplicates = %d, want 2", d.duplicates)
+	}
+}
+
+// fakeExchanger answers queries from canned handlers keyed by address.
+// Queries to an address without a handler fail.
+type fakeExchanger map[string]func(msg *dns.Msg) *dns.Msg
+
+func (f fakeExchanger) Exchange(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+	handler, ok := f[address]
+	if !ok {
+		return nil, errors.New("connection refused")
+	}
+	return handler(msg), nil
+}
+
+// fakeHosts resolves hostnames from a fixed map.
+type fakeHosts map[string][]string
+
+func (f fakeHosts) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addresses, ok := f[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addresses, nil
+}
+
+// reply returns a handler that answers every query with the given records.
+func reply(t *testing.T, records ...string) func(*dns.Msg) *dns.Msg {
+	t.Helper()
+	var answer []dns.RR
+	for _, s := range records {
+		answer = append(answer, mustRR(t, s))
+	}
+	return func(msg *dns.Msg) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetReply(msg)
+		m.Authoritative = true
+		m.Answer = answer
+		return m
+	}
+}
+
+func TestCheckWildcard(t *testing.T) {
+	answer := reply(t, "*.example.com. 300 IN A 192.0.2.1")
+	exchanger := fakeExchanger{
+		"resolver:53": reply(t, "example.com. 300 IN NS ns1.example.com."),
+		"192.0.2.53:53": func(msg *dns.Msg) *dns.Msg {
+			if name := msg.Question[0].Name; name != "*.example.com." {
+				t.Errorf("server queried for %q, want *.example.com.", name)
+			}
+			return answer(msg)
+		},
+	}
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:       "*.Example.com",
+		RecordType:   TypeA,
+		Expected:     []string{"192.0.2.1"},
+		Resolver:     "resolver:53",
+		Exchanger:    exchanger,
+		HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.53"}},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if ok, reason := result.Match(); !ok || result.Zone != "example.com." {
+		t.Errorf("Check() = zone %q, match %v (%s); want a match in example.com.", result.Zone, ok, reason)
+	}
+}
+
+func TestCheckRequestID(t *testing.T) {
+	var logs strings.Builder
+	_, err := Check(context.Background(), CheckArgs{
+		Domain:     "example.com",
+		RecordType: TypeA,
+		Expected:   []string{"192.0.2.1"},
+		Resolver:   "resolver:53",
+		Exchanger: fakeExchanger{
+			"resolver:53":   reply(t, "example.com. 300 IN NS ns1.example.com."),
+			"192.0.2.53:53": reply(t, "example.com. 300 IN A 192.0.2.1"),
+		},
+		HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.53"}},
+		Logger:       slog.New(slog.NewTextHandler(&logs, nil)),
+		RequestID:    "abc123",
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("logged %q, want a line per step", lines)
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, "request_id=abc123") {
+			t.Errorf("log line %q has no request_id", line)
+		}
+	}
+}
+
+func TestCheckOnResult(t *testing.T) {
+	exchanger := fakeExchanger{
+		"resolver:53": reply(t,
+			"example.com. 300 IN NS ns1.example.com.",
+			"example.com. 300 IN NS ns2.example.com.",
+			"example.com. 300 IN NS ns3.example.com.",
+		),
+		"192.0.2.1:53": reply(t, "example.com. 300 IN A 192.0.2.10"),
+		"192.0.2.2:53": reply(t, "example.com. 300 IN A 192.0.2.10"),
+	}
+	var mu sync.Mutex
+	var seen []string
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:       "example.com",
+		RecordType:   TypeA,
+		Expected:     []string{"192.0.2.10"},
+		Resolver:     "resolver:53",
+		Exchanger:    exchanger,
+		HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.1"}, "ns2.example.com.": {"192.0.2.2"}},
+		Concurrency:  2,
+		OnResult: func(s ServerResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			seen = append(seen, s.Nameserver)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+
+	var want []string
+	for _, s := range result.Servers {
+		want = append(want, s.Nameserver)
+	}
+	slices.Sort(seen)
+	slices.Sort(want)
+	if !slices.Equal(seen, want) || len(seen) != 3 {
+		t.Errorf("OnResult called for %v, want once for each of %v", seen, want)
+	}
+}
+
+func TestCheckWithFakeExchanger(t *testing.T) {
+	exchanger := fakeExchanger{
+		"resolver:53": reply(t,
+			"example.com. 300 IN NS ns1.example.com.",
+			"example.com. 300 IN NS ns2.example.com.",
+			"example.com. 300 IN NS ns3.example.com.",
+		),
+		"192.0.2.1:53": reply(t, "example.com. 300 IN A 192.0.2.100"),
+		"192.0.2.2:53": reply(t, "example.com. 300 IN A 192.0.2.99"),
+		// 192.0.2.3 has no handler, so queries to it fail.
+	}
+	hosts := fakeHosts{
+		"ns1.example.com.": {"192.0.2.1"},
+		"ns2.example.com.": {"192.0.2.2", "192.0.2.3"},
+	}
+
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:       "example.com",
+		RecordType:   TypeA,
+		Expected:     []string{"192.0.2.100"},
+		Resolver:     "resolver:53",
+		Exchanger:    exchanger,
+		HostResolver: hosts,
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+
+	want := []struct {
+		nameserver, address string
+		match, err          bool
+	}{
+		{"ns1.example.com.", "192.0.2.1", true, false},
+		{"ns2.example.com.", "192.0.2.2", false, false},
+		{"ns2.example.com.", "192.0.2.3", false, true},
+		{"ns3.example.com.", "", false, true},
+	}
+	if len(result.Servers) != len(want) {
+		t.Fatalf("got %d servers, want %d: %+v", len(result.Servers), len(want), result.Servers)
+	}
+	for i, w := range want {
+		s := result.Servers[i]
+		if s.Nameserver != w.nameserver || s.Address != w.address || s.Match != w.match || (s.Error != nil) != w.err {
+			t.Errorf("server %d = %+v, want %+v", i, s, w)
+		}
+	}
+
+	matched, reason := result.Match()
+	if matched || reason != "example.com: 3 of 4 servers returned unexpected A records" {
+		t.Errorf("Match() = %v, %q", matched, reason)
+	}
+}
+
+func TestFindZoneWalk(t *testing.T) {
+	tests := []struct {
+		name        string
+		domain      string
+		nsAt        string // name the resolver has NS records for
+		soaAt       string // zone whose SOA the resolver returns for names below it
+		cname       string // the domain's CNAME target, which has NS records
+		wantQueries []string
+		wantErr     error
+	}{
+		{
+			name:        "escaped dot",
+			domain:      `a\.b.sub.example.com`,
+			nsAt:        "example.com.",
+			wantQueries: []string{`a\.b.sub.example.com.`, "sub.example.com.", "example.com."},
+		},
+		{
+			name:        "underscore label below the zone",
+			domain:      "_dmarc.mail.example.com",
+			nsAt:        "example.com.",
+			soaAt:       "example.com.",
+			wantQueries: []string{"_dmarc.mail.example.com.", "example.com."},
+		},
+		{
+			name:        "wildcard",
+			domain:      "*.example.com",
+			nsAt:        "example.com.",
+			soaAt:       "example.com.",
+			wantQueries: []string{"*.example.com.", "example.com."},
+		},
+		{
+			name:        "CNAME to another zone",
+			domain:      "_dmarc.example.com",
+			nsAt:        "example.com.",
+			cname:       "provider.example.net.",
+			wantQueries: []string{"_dmarc.example.com.", "example.com."},
+		},
+		{
+			name:        "no nameservers",
+			domain:      "sub.example.com",
+			wantQueries: []string{"sub.example.com.", "example.com.", "com."},
+			wantErr:     ErrNoNameservers,
+		},
+		{
+			name:   "invalid name",
+			domain: "bad..example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queries []string
+			ex := exchangerFunc(func(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+				name := msg.Question[0].Name
+				queries = append(queries, name)
+				m := new(dns.Msg)
+				m.SetReply(msg)
+				switch {
+				case name == tt.nsAt:
+					m.Answer = []dns.RR{mustRR(t, name+" 300 IN NS ns1.example.com.")}
+				case tt.cname != "" && name == dns.Fqdn(tt.domain):
+					m.Answer = []dns.RR{
+						mustRR(t, name+" 300 IN CNAME "+tt.cname),
+						mustRR(t, tt.cname+" 300 IN NS ns1.example.net."),
+					}
+				case tt.soaAt != "" && dns.IsSubDomain(tt.soaAt, name):
+					m.Ns = []dns.RR{mustRR(t, tt.soaAt+" 300 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300")}
+				}
+				return m, nil
+			})
+
+			d, err := findZone(context.Background(), ex, tt.domain, "resolver:53")
+			if !slices.Equal(queries, tt.wantQueries) {
+				t.Errorf("queried %q, want %q", queries, tt.wantQueries)
+			}
+			switch {
+			case tt.wantQueries == nil:
+				if err == nil {
+					t.Error("findZone() succeeded, want error")
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("findZone() error = %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("findZone() error: %v", err)
+			case d.zone != tt.nsAt:
+				t.Errorf("zone = %q, want %q", d.zone, tt.nsAt)
+			}
+		})
+	}
+}
+
+func TestFindZoneDelegatedSubdomain(t *testing.T) {
+	// sub.example.com is delegated from example.com to its own servers.
+	for _, withSOA := range []bool{false, true} {
+		var queries []string
+		ex := exchangerFunc(func(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+			name := msg.Question[0].Name
+			queries = append(queries, name)
+			m := new(dns.Msg)
+			m.SetReply(msg)
+			switch {
+			case name == "sub.example.com.":
+				m.Answer = []dns.RR{mustRR(t, "sub.example.com. 300 IN NS ns1.sub.example.com.")}
+			case name == "example.com.":
+				m.Answer = []dns.RR{mustRR(t, "example.com. 300 IN NS ns1.example.com.")}
+			case withSOA:
+				m.Ns = []dns.RR{mustRR(t, "sub.example.com. 300 IN SOA ns1.sub.example.com. hostmaster.example.com. 1 7200 3600 1209600 300")}
+			}
+			return m, nil
+		})
+
+		d, err := findZone(context.Background(), ex, "_dmarc.mail.sub.example.com", "resolver:53")
+		if err != nil {
+			t.Fatalf("withSOA=%v: findZone() error: %v", withSOA, err)
+		}
+		if d.zone != "sub.example.com." || !slices.Equal(d.nameservers, []string{"ns1.sub.example.com."}) {
+			t.Errorf("withSOA=%v: findZone() = %s %v, want the subzone's nameservers", withSOA, d.zone, d.nameservers)
+		}
+		if slices.Contains(queries, "example.com.") {
+			t.Errorf("withSOA=%v: queried %q, want the walk to stop at sub.example.com.", withSOA, queries)
+		}
+	}
+}
+
+func TestFindZoneCanceled(t *testing.T) {
+	// The exchanger ignores ctx, as a slow one might until its query times
+	// out, and cancels it after the first lookup of the walk.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var queries []string
+	ex := exchangerFunc(func(_ context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+		queries = append(queries, msg.Question[0].Name)
+		cancel()
+		m := new(dns.Msg)
+		m.SetReply(msg)
+		return m, nil
+	})
+
+	_, err := findZone(ctx, ex, "a.b.c.example.com", "resolver:53")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("findZone() error = %v, want context.Canceled", err)
+	}
+	if len(queries) != 1 {
+		t.Errorf("queried %q after cancellation, want only the first lookup", queries)
+	}
+}
+
+func TestCheckLame(t *testing.T) {
+	answer := reply(t, "example.com. 300 IN A 192.0.2.100")
+	exchanger := fakeExchanger{
+		"resolver:53": reply(t,
+			"example.com. 300 IN NS ns1.example.com.",
+			"example.com. 300 IN NS ns2.example.com.",
+			"example.com. 300 IN NS ns3.example.com.",
+		),
+		"192.0.2.1:53": answer,
+		// A recursive resolver answering from its cache.
+		"192.0.2.2:53": func(msg *dns.Msg) *dns.Msg {
+			m := answer(msg)
+			m.Authoritative = false
+			return m
+		},
+		"192.0.2.3:53": func(msg *dns.Msg) *dns.Msg {
+			return new(dns.Msg).SetRcode(msg, dns.RcodeRefused)
+		},
+	}
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:     "example.com",
+		RecordType: TypeA,
+		Expected:   []string{"192.0.2.100"},
+		Resolver:   "resolver:53",
+		Exchanger:  exchanger,
+		HostResolver: fakeHosts{
+			"ns1.example.com.": {"192.0.2.1"},
+			"ns2.example.com.": {"192.0.2.2"},
+			"ns3.example.com.": {"192.0.2.3"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	for i, want := range []bool{false, true, true} {
+		if s := result.Servers[i]; s.Lame != want || s.Match == want {
+			t.Errorf("%s: Lame = %v, Match = %v; want Lame %v", s.Address, s.Lame, s.Match, want)
+		}
+	}
+	_, reason := result.Match()
+	if want := "example.com: 2 of 3 servers returned unexpected A records (2 not authoritative for the zone)"; reason != want {
+		t.Errorf("Match() reason = %q, want %q", reason, want)
+	}
+}
+
+func TestCheckUsesGlue(t *testing.T) {
+	ns := reply(t, "example.com. 300 IN NS ns1.example.com.", "example.com. 300 IN NS ns2.example.net.")
+	exchanger := fakeExchanger{
+		"resolver:53": func(msg *dns.Msg) *dns.Msg {
+			response := ns(msg)
+			response.Extra = []dns.RR{
+				mustRR(t, "NS1.example.com. 300 IN A 192.0.2.1"),
+				mustRR(t, "ns1.example.com. 300 IN AAAA 2001:db8::1"),
+				// Out of zone, so not trusted as glue.
+				mustRR(t, "ns2.example.net. 300 IN A 192.0.2.9"),
+			}
+			return response
+		},
+		"192.0.2.1:53": reply(t, "example.com. 300 IN A 192.0.2.100"),
+		"192.0.2.2:53": reply(t, "example.com. 300 IN A 192.0.2.100"),
+	}
+	// Only ns2, which has no glue, can be resolved.
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:       "example.com",
+		RecordType:   TypeA,
+		Expected:     []string{"192.0.2.100"},
+		Resolver:     "resolver:53",
+		Exchanger:    exchanger,
+		HostResolver: fakeHosts{"ns2.example.net.": {"192.0.2.2"}},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	var addresses []string
+	for _, s := range result.Servers {
+		addresses = append(addresses, s.Address)
+	}
+	if want := []string{"192.0.2.1", "192.0.2.2"}; !slices.Equal(addresses, want) {
+		t.Errorf("queried %v, want %v", addresses, want)
+	}
+	if matched, reason := result.Match(); !matched {
+		t.Errorf("Match() = false: %s", reason)
+	}
+}
+
+func TestCheckGlueOneFamily(t *testing.T) {
+	ns := reply(t, "example.com. 300 IN NS ns1.example.com.")
+	exchanger := fakeExchanger{
+		"resolver:53": func(msg *dns.Msg) *dns.Msg {
+			response := ns(msg)
+			response.Extra = []dns.RR{mustRR(t, "ns1.example.com. 300 IN A 192.0.2.1")}
+			return response
+		},
+		"192.0.2.1:53":     reply(t, "example.com. 300 IN A 192.0.2.100"),
+		"[2001:db8::1]:53": reply(t, "example.com. 300 IN A 192.0.2.100"),
+	}
+	// The glue has no AAAA record, so the IPv6 address is resolved.
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:        "example.com",
+		RecordType:    TypeA,
+		Expected:      []string{"192.0.2.100"},
+		Resolver:      "resolver:53",
+		Exchanger:     exchanger,
+		HostResolver:  fakeHosts{"ns1.example.com.": {"192.0.2.9", "2001:db8::1"}},
+		AddressFamily: FamilyBoth,
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	var addresses []string
+	for _, s := range result.Servers {
+		addresses = append(addresses, s.Address)
+	}
+	if want := []string{"192.0.2.1", "2001:db8::1"}; !slices.Equal(addresses, want) {
+		t.Errorf("queried %v, want %v", addresses, want)
+	}
+}
+
+func TestCheckFallbackResolvers(t *testing.T) {
+	answers := fakeExchanger{
+		"backup:53":    reply(t, "example.com. 300 IN NS ns1.example.com."),
+		"192.0.2.1:53": reply(t, "example.com. 300 IN A 192.0.2.100"),
+	}
+	var tried []string
+	exchanger := exchangerFunc(func(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+		tried = append(tried, address)
+		if handler, ok := answers[address]; ok {
+			return handler(msg), nil
+		}
+		return nil, errors.New("connection refused")
+	})
+	args := CheckArgs{
+		Domain:            "example.com",
+		RecordType:        TypeA,
+		Expected:          []string{"192.0.2.100"},
+		Resolver:          "down:53",
+		FallbackResolvers: []string{"backup:53"},
+		Exchanger:         exchanger,
+		HostResolver:      fakeHosts{"ns1.example.com.": {"192.0.2.1"}},
+	}
+
+	result, err := Check(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if matched, reason := result.Match(); !matched {
+		t.Errorf("Match() = false: %s", reason)
+	}
+	if want := []string{"down:53", "backup:53", "192.0.2.1:53"}; !slices.Equal(tried, want) {
+		t.Errorf("queried %v, want %v", tried, want)
+	}
+
+	args.FallbackResolvers = []string{"down2:53"}
+	_, err = Check(context.Background(), args)
+	var resolverErr *ResolverError
+	if !errors.As(err, &resolverErr) || !slices.Equal(resolverErr.Resolvers, []string{"down:53", "down2:53"}) {
+		t.Fatalf("Check() error = %v, want a ResolverError for both resolvers", err)
+	}
+	if want := "every resolver failed: down:53: connection refused; down2:53: connection refused"; !strings.Contains(err.Error(), want) {
+		t.Errorf("Check() error = %q, want it to contain %q", err, want)
+	}
+}
+
+func TestCheckErrorKinds(t *testing.T) {
+	exchanger := fakeExchanger{
+		"resolver:53": reply(t,
+			"example.com. 300 IN NS ns1.example.com.",
+			"example.com. 300 IN NS ns2.example.com.",
+		),
+		// 192.0.2.1 has no handler, so queries to it fail.
+	}
+	args := CheckArgs{
+		Domain:       "example.com",
+		RecordType:   TypeA,
+		Expected:     []string{"192.0.2.100"},
+		Resolver:     "resolver:53",
+		Exchanger:    exchanger,
+		HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.1"}},
+	}
+
+	result, err := Check(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	var queryErr *QueryError
+	if !errors.As(result.Servers[0].Error, &queryErr) || queryErr.Address != "192.0.2.1" || queryErr.Nameserver != "ns1.example.com." {
+		t.Errorf("Servers[0].Error = %#v, want QueryError for 192.0.2.1", result.Servers[0].Error)
+	}
+	if !errors.Is(result.Servers[1].Error, ErrNameserverUnresolvable) {
+		t.Errorf("Servers[1].Error = %v, want ErrNameserverUnresolvable", result.Servers[1].Error)
+	}
+
+	args.Exchanger = fakeExchanger{"resolver:53": reply(t)}
+	if _, err := Check(context.Background(), args); !errors.Is(err, ErrNoNameservers) {
+		t.Errorf("Check() error = %v, want ErrNoNameservers", err)
+	}
+}
+
+func TestCheckPartialResult(t *testing.T) {
+	args := CheckArgs{
+		Domain:     "Example.com",
+		RecordType: TypeA,
+		Expected:   []string{"192.0.2.1"},
+		Resolver:   "resolver:53",
+		Exchanger:  fakeExchanger{},
+	}
+	result, err := Check(context.Background(), args)
+	if err == nil || result == nil || result.Err != err {
+		t.Fatalf("Check() with an unreachable resolver = %v, %v; want a partial result with the error", result, err)
+	}
+	if result.Domain != "example.com" || !slices.Equal(result.Expected, args.Expected) || len(result.Servers) != 0 {
+		t.Errorf("partial result = %+v, want the domain and expected values only", result)
+	}
+	if ok, reason := result.Match(); ok || !strings.Contains(reason, "connection refused") {
+		t.Errorf("Match() = %v, %q; want false with the error", ok, reason)
+	}
+
+	// The nameservers were found, but the primary couldn't be queried.
+	args.ExpectedFromPrimary = true
+	args.Exchanger = fakeExchanger{
+		"resolver:53": reply(t,
+			"example.com. 300 IN NS ns1.example.com.",
+			"example.com. 300 IN SOA ns0.example.com. hostmaster.example.com. 1 7200 3600 1209600 300",
+		),
+	}
+	args.HostResolver = fakeHosts{"ns0.example.com.": {"192.0.2.10"}}
+	result, err = Check(context.Background(), args)
+	if err == nil || result == nil {
+		t.Fatalf("Check() with an unreachable primary = %v, %v; want a partial result with the error", result, err)
+	}
+	if result.Zone != "example.com." || !slices.Equal(result.Nameservers, []string{"ns1.example.com."}) {
+		t.Errorf("partial result = %+v, want the zone and nameservers found", result)
+	}
+}
+
+// exchangerFunc adapts a function to the Exchanger interface, for fakes that
+// need the context.
+type exchangerFunc func(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error)
+
+func (f exchangerFunc) Exchange(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+	return f(ctx, msg, address)
+}
+
+func TestCheckPerQueryTimeout(t *testing.T) {
+	fake := fakeExchanger{
+		"resolver:53": reply(t,
+			"example.com. 300 IN NS ns1.example.com.",
+			"example.com. 300 IN NS ns2.example.com.",
+		),
+		"192.0.2.2:53": reply(t, "example.com. 300 IN A 192.0.2.100"),
+	}
+	// 192.0.2.1 never answers.
+	exchanger := exchangerFunc(func(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+		if address == "192.0.2.1:53" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return fake.Exchange(ctx, msg, address)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	result, err := Check(ctx, CheckArgs{
+		Domain:          "example.com",
+		RecordType:      TypeA,
+		Expected:        []string{"192.0.2.100"},
+		PerQueryTimeout: 50 * time.Millisecond,
+		Resolver:        "resolver:53",
+		Exchanger:       exchanger,
+		HostResolver: fakeHosts{
+			"ns1.example.com.": {"192.0.2.1"},
+			"ns2.example.com.": {"192.0.2.2"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Check() took %s, want the slow server to time out after 50ms", elapsed)
+	}
+	if err := result.Servers[0].Error; err == nil || !strings.Contains(err.Error(), "no response within 50ms") {
+		t.Errorf("Servers[0].Error = %v, want per-query timeout", err)
+	}
+	if !result.Servers[1].Match {
+		t.Errorf("Servers[1] = %+v, want match", result.Servers[1])
+	}
+}
+
+func TestCheckRetries(t *testing.T) {
+	answer := reply(t, "example.com. 300 IN A 192.0.2.100")
+	empty := reply(t)
+	ns := reply(t, "example.com. 300 IN NS ns1.example.com.")
+
+	// The server fails, then returns an empty answer, then answers.
+	var attempts int
+	exchanger := exchangerFunc(func(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+		if address == "resolver:53" {
+			return ns(msg), nil
+		}
+		attempts++
+		switch attempts {
+		case 1:
+			return nil, errors.New("i/o timeout")
+		case 2:
+			return empty(msg), nil
+		default:
+			return answer(msg), nil
+		}
+	})
+	args := CheckArgs{
+		Domain:       "example.com",
+		RecordType:   TypeA,
+		Expected:     []string{"192.0.2.100"},
+		Resolver:     "resolver:53",
+		Exchanger:    exchanger,
+		HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.1"}},
+	}
+
+	for _, tt := range []struct {
+		retries, attempts int
+		match             bool
+	}{
+		{retries: 0, attempts: 1, match: false},
+		{retries: 1, attempts: 2, match: false},
+		{retries: 5, attempts: 3, match: true},
+	} {
+		attempts = 0
+		args.Retries = tt.retries
+		result, err := Check(context.Background(), args)
+		if err != nil {
+			t.Fatalf("Check() error: %v", err)
+		}
+		if attempts != tt.attempts || result.Servers[0].Match != tt.match {
+			t.Errorf("Retries %d: %d attempts, match %v, want %d attempts, match %v", tt.retries, attempts, result.Servers[0].Match, tt.attempts, tt.match)
+		}
+	}
+}
+
+func TestCheckDiscovery(t *testing.T) {
+	exchanger := fakeExchanger{
+		"resolver:53":  reply(t, "example.com. 300 IN NS ns1.example.com.", "example.com. 300 IN NS ns2.example.com."),
+		"192.0.2.1:53": reply(t, "example.com. 300 IN A 192.0.2.100"),
+		"192.0.2.2:53": reply(t, "example.com. 300 IN A 192.0.2.99"),
+	}
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:     "example.com",
+		RecordType: TypeA,
+		Resolver:   "resolver:53",
+		Exchanger:  exchanger,
+		HostResolver: fakeHosts{
+			"ns1.example.com.": {"192.0.2.1"},
+			"ns2.example.com.": {"192.0.2.2"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	for _, s := range result.Servers {
+		if len(s.Values) != 1 || !s.Match {
+			t.Errorf("%s: Values = %v, Match = %v; want one value and Match", s.Address, s.Values, s.Match)
+		}
+	}
+	if consistent, _ := result.Consistent(); consistent {
+		t.Error("Consistent() = true, want false")
+	}
+}
+
+func TestCheckAddressFamily(t *testing.T) {
+	exchanger := fakeExchanger{
+		"resolver:53":      reply(t, "example.com. 300 IN NS ns1.example.com."),
+		"192.0.2.1:53":     reply(t, "example.com. 300 IN A 192.0.2.100"),
+		"[2001:db8::1]:53": reply(t, "example.com. 300 IN A 192.0.2.99"),
+	}
+	args := CheckArgs{
+		Domain:       "example.com",
+		RecordType:   TypeA,
+		Expected:     []string{"192.0.2.100"},
+		Resolver:     "resolver:53",
+		Exchanger:    exchanger,
+		HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.1", "2001:db8::1"}},
+	}
+
+	tests := []struct {
+		family    AddressFamily
+		addresses []string
+	}{
+		{FamilyIPv4, []string{"192.0.2.1"}},
+		{FamilyIPv6, []string{"2001:db8::1"}},
+		{FamilyBoth, []string{"192.0.2.1", "2001:db8::1"}},
+	}
+	for _, tt := range tests {
+		args.AddressFamily = tt.family
+		result, err := Check(context.Background(), args)
+		if err != nil {
+			t.Fatalf("Check(%v) error: %v", tt.family, err)
+		}
+		var addresses []string
+		for _, s := range result.Servers {
+			addresses = append(addresses, s.Address)
+			if s.AddressFamily != addressFamily(s.Address) {
+				t.Errorf("Check(%v): %s has AddressFamily %v", tt.family, s.Address, s.AddressFamily)
+			}
+		}
+		if !slices.Equal(addresses, tt.addresses) {
+			t.Errorf("Check(%v) queried %v, want %v", tt.family, addresses, tt.addresses)
+		}
+	}
+}
+
+func TestSampleTargets(t *testing.T) {
+	unresolvable := errors.New("no such host")
+	targets := []serverTarget{
+		{nameserver: "ns1", address: "192.0.2.1"},
+		{nameserver: "ns1", address: "192.0.2.2"},
+		{nameserver: "ns1", address: "192.0.2.3"},
+		{nameserver: "ns2", address: "192.0.2.4"},
+		{nameserver: "ns2", address: "192.0.2.5"},
+		{nameserver: "ns3", err: unresolvable},
+		{nameserver: "ns4", address: "192.0.2.6"},
+	}
+
+	tests := []struct {
+		max       int
+		addresses []string
+	}{
+		{0, []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4", "192.0.2.5", "", "192.0.2.6"}},
+		{10, []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4", "192.0.2.5", "", "192.0.2.6"}},
+		{2, []string{"192.0.2.1", "192.0.2.4", ""}},
+		{3, []string{"192.0.2.1", "192.0.2.4", "", "192.0.2.6"}},
+		{5, []string{"192.0.2.1", "192.0.2.2", "192.0.2.4", "192.0.2.5", "", "192.0.2.6"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.max), func(t *testing.T) {
+			sampled, total := sampleTargets(targets, tt.max)
+			if total != 6 {
+				t.Errorf("total = %d, want 6", total)
+			}
+			var addresses []string
+			for _, target := range sampled {
+				addresses = append(addresses, target.address)
+			}
+			if !slices.Equal(addresses, tt.addresses) {
+				t.Errorf("sampleTargets(%d) addresses = %q, want %q", tt.max, addresses, tt.addresses)
+			}
+		})
+	}
+}
+
+func TestExpectedFor(t *testing.T) {
+	args := CheckArgs{
+		Expected: []string{"192.0.2.1"},
+		ExpectedByServer: map[string][]string{
+			"NS-EU.example.com": {"198.51.100.1"},
+			"203.0.113.53":      {"203.0.113.1"},
+		},
+	}
+
+	tests := []struct {
+		ns, addr string
+		want     []string
+	}{
+		{"ns-us.example.com.", "192.0.2.53", []string{"192.0.2.1"}},
+		{"ns-eu.example.com.", "198.51.100.53", []string{"198.51.100.1"}},
+		{"ns-eu.example.com.", "203.0.113.53", []string{"203.0.113.1"}},
+		{"ns-eu.example.com.", "", []string{"198.51.100.1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ns+"/"+tt.addr, func(t *testing.T) {
+			if got := args.expectedFor(tt.ns, tt.addr); !slices.Equal(got, tt.want) {
+				t.Errorf("expectedFor(%q, %q) = %v, want %v", tt.ns, tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckExpectedFromName(t *testing.T) {
+	ns := reply(t, "example.com. 300 IN NS ns1.example.com.")
+	lb := reply(t,
+		"www.example.com. 300 IN CNAME lb.example.net.",
+		"lb.example.net. 60 IN A 192.0.2.10",
+		"lb.example.net. 60 IN A 192.0.2.11",
+	)
+	exchanger := fakeExchanger{
+		"resolver:53": func(msg *dns.Msg) *dns.Msg {
+			if msg.Question[0].Qtype == dns.TypeNS {
+				return ns(msg)
+			}
+			return lb(msg)
+		},
+		"192.0.2.1:53": reply(t,
+			"example.com. 300 IN A 192.0.2.11",
+			"example.com. 300 IN A 192.0.2.10",
+		),
+	}
+
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:           "example.com",
+		RecordType:       TypeA,
+		ExpectedFromName: "www.example.com",
+		Resolver:         "resolver:53",
+		Exchanger:        exchanger,
+		HostResolver:     fakeHosts{"ns1.example.com.": {"192.0.2.1"}},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if want := []string{"192.0.2.10", "192.0.2.11"}; !slices.Equal(result.Expected, want) {
+		t.Errorf("Expected = %v, want %v", result.Expected, want)
+	}
+	if ok, reason := result.Match(); !ok {
+		t.Errorf("Match() = false, %q", reason)
+	}
+}
+
+func TestCheckExpectedFromPrimary(t *testing.T) {
+	// ns0.example.com. is a hidden primary, not listed in the NS records.
+	exchanger := fakeExchanger{
+		"resolver:53": reply(t,
+			"example.com. 300 IN NS ns1.example.com.",
+			"example.com. 300 IN NS ns2.example.com.",
+			"example.com. 300 IN SOA ns0.example.com. hostmaster.example.com. 1 7200 3600 1209600 300",
+		),
+		"192.0.2.10:53": reply(t, "www.example.com. 300 IN A 192.0.2.1"),
+		"192.0.2.53:53": reply(t, "www.example.com. 300 IN A 192.0.2.1"),
+		"192.0.2.54:53": reply(t, "www.example.com. 300 IN A 192.0.2.2"),
+	}
+	hosts := fakeHosts{
+		"ns0.example.com.": {"192.0.2.10"},
+		"ns1.example.com.": {"192.0.2.53"},
+		"ns2.example.com.": {"192.0.2.54"},
+	}
+	args := CheckArgs{
+		Domain:              "www.example.com",
+		RecordType:          TypeA,
+		ExpectedFromPrimary: true,
+		Resolver:            "resolver:53",
+		Exchanger:           exchanger,
+		HostResolver:        hosts,
+	}
+
+	result, err := Check(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if result.Primary != "ns0.example.com." || !slices.Equal(result.Expected, []string{"192.0.2.1"}) {
+		t.Errorf("Primary, Expected = %q, %v; want the primary's answer", result.Primary, result.Expected)
+	}
+	if !result.Servers[0].Match || result.Servers[1].Match {
+		t.Errorf("servers = %+v, want only ns1 in sync with the primary", result.Servers)
+	}
+
+	delete(exchanger, "192.0.2.10:53")
+	if _, err := Check(context.Background(), args); err == nil || !strings.Contains(err.Error(), "primary nameserver ns0.example.com.") {
+		t.Errorf("Check() with an unreachable primary error = %v, want one naming the primary", err)
+	}
+}
+
+func TestCheckNameservers(t *testing.T) {
+	// There is no resolver, so discovery would fail.
+	answer := reply(t, "example.com. 300 IN A 192.0.2.1")
+	exchanger := fakeExchanger{
+		"192.0.2.9:53":     answer,
+		"198.51.100.7:53":  answer,
+		"[2001:db8::7]:53": answer,
+	}
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:       "example.com",
+		RecordType:   TypeA,
+		Expected:     []string{"192.0.2.1"},
+		Nameservers:  []string{"NS9.example.net", "198.51.100.7", "[2001:db8::7]", "ns9.example.net."},
+		Resolver:     "resolver:53",
+		Exchanger:    exchanger,
+		HostResolver: fakeHosts{"ns9.example.net.": {"192.0.2.9", "2001:db8::9"}},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if ok, reason := result.Match(); !ok {
+		t.Errorf("Match() = false, %q", reason)
+	}
+	var addresses []string
+	for _, s := range result.Servers {
+		addresses = append(addresses, s.Address)
+	}
+	if want := []string{"192.0.2.9", "198.51.100.7", "2001:db8::7"}; !slices.Equal(addresses, want) {
+		t.Errorf("queried %v, want %v: IPv4 for the hostname, once, and every address given", addresses, want)
+	}
+	if result.Zone != "" {
+		t.Errorf("Zone = %q, want none without discovery", result.Zone)
+	}
+}
+
+func TestCheckSharedAddress(t *testing.T) {
+	// ns1 and ns2 are served from the same anycast address.
+	answer := reply(t, "example.com. 300 IN A 192.0.2.1")
+	exchanger := &countingExchanger{
+		Exchanger: fakeExchanger{
+			"resolver:53": reply(t,
+				"example.com. 300 IN NS ns1.example.com.",
+				"example.com. 300 IN NS ns2.example.com.",
+				"example.com. 300 IN NS ns3.example.com.",
+			),
+			"192.0.2.53:53": answer,
+			"192.0.2.54:53": answer,
+		},
+		counts: make(map[string]int),
+	}
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:     "example.com",
+		RecordType: TypeA,
+		Expected:   []string{"192.0.2.1"},
+		Resolver:   "resolver:53",
+		Exchanger:  exchanger,
+		HostResolver: fakeHosts{
+			"ns1.example.com.": {"192.0.2.53"},
+			"ns2.example.com.": {"192.0.2.53"},
+			"ns3.example.com.": {"192.0.2.54", "192.0.2.53"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if len(result.Servers) != 2 || exchanger.counts["192.0.2.53:53"] != 1 {
+		t.Fatalf("Servers = %+v, queried 192.0.2.53 %d times; want each address once", result.Servers, exchanger.counts["192.0.2.53:53"])
+	}
+	s := result.Servers[0]
+	if s.Nameserver != "ns1.example.com." || !slices.Equal(s.OtherNameservers, []string{"ns2.example.com.", "ns3.example.com."}) {
+		t.Errorf("shared server = %s, others %v; want ns1 with ns2 and ns3", s.Nameserver, s.OtherNameservers)
+	}
+	if got, want := s.label(), "ns1.example.com., ns2.example.com., ns3.example.com. (192.0.2.53, IPv4)"; got != want {
+		t.Errorf("label() = %q, want %q", got, want)
+	}
+}
+
+func TestCheckSharedAddressExpectedByServer(t *testing.T) {
+	exchanger := fakeExchanger{
+		"resolver:53": reply(t,
+			"example.com. 300 IN NS ns1.example.com.",
+			"example.com. 300 IN NS ns2.example.com.",
+		),
+		"192.0.2.53:53": reply(t, "example.com. 300 IN A 192.0.2.9"),
+	}
+	hosts := fakeHosts{
+		"ns1.example.com.": {"192.0.2.53"},
+		"ns2.example.com.": {"192.0.2.53"},
+	}
+	tests := []struct {
+		name      string
+		byServer  map[string][]string
+		wantMatch bool
+		wantErr   bool
+	}{
+		{"entry for the other nameserver", map[string][]string{"ns2.example.com": {"192.0.2.9"}}, true, false},
+		{"same entry for both", map[string][]string{"ns1.example.com": {"192.0.2.9"}, "ns2.example.com": {"192.0.2.9"}}, true, false},
+		{"conflicting entries", map[string][]string{"ns1.example.com": {"192.0.2.1"}, "ns2.example.com": {"192.0.2.9"}}, false, true},
+		{"address entry wins", map[string][]string{"192.0.2.53": {"192.0.2.9"}, "ns1.example.com": {"192.0.2.1"}, "ns2.example.com": {"192.0.2.2"}}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Check(context.Background(), CheckArgs{
+				Domain:           "example.com",
+				RecordType:       TypeA,
+				Expected:         []string{"192.0.2.1"},
+				ExpectedByServer: tt.byServer,
+				Resolver:         "resolver:53",
+				Exchanger:        exchanger,
+				HostResolver:     hosts,
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Check() succeeded, want an error for conflicting expected values")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check() error: %v", err)
+			}
+			if matched, reason := result.Match(); matched != tt.wantMatch {
+				t.Errorf("Match() = %v, %q; want %v", matched, reason, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestCheckTTLs(t *testing.T) {
+	exchanger := fakeExchanger{
+		"resolver:53": reply(t, "example.com. 300 IN NS ns1.example.com."),
+		"192.0.2.1:53": reply(t,
+			"example.com. 3600 IN A 192.0.2.10",
+			"example.com. 120 IN A 192.0.2.11",
+		),
+	}
+
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:       "example.com",
+		RecordType:   TypeA,
+		Expected:     []string{"192.0.2.10", "192.0.2.11"},
+		Resolver:     "resolver:53",
+		Exchanger:    exchanger,
+		HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.1"}},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	s := result.Servers[0]
+	if !s.Match || !slices.Equal(s.TTLs, []uint32{3600, 120}) {
+		t.Errorf("server = %+v, want match with TTLs [3600 120]", s)
+	}
+}
+
+func TestCheckLatency(t *testing.T) {
+	answer := reply(t, "example.com. 300 IN A 192.0.2.10")
+	exchanger := fakeExchanger{
+		"resolver:53": reply(t, "example.com. 300 IN NS ns1.example.com."),
+		"192.0.2.1:53": func(msg *dns.Msg) *dns.Msg {
+			time.Sleep(20 * time.Millisecond)
+			return answer(msg)
+		},
+	}
+
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:       "example.com",
+		RecordType:   TypeA,
+		Expected:     []string{"192.0.2.10"},
+		Resolver:     "resolver:53",
+		Exchanger:    exchanger,
+		HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.1"}},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if got := result.Servers[0].Latency; got < 20*time.Millisecond {
+		t.Errorf("Latency = %s, want at least 20ms", got)
+	}
+}
+
+func TestCheckPort(t *testing.T) {
+	// Only the authoritative query goes to the custom port.
+	exchanger := fakeExchanger{
+		"resolver:53":    reply(t, "example.com. 300 IN NS ns1.example.com."),
+		"192.0.2.1:5353": reply(t, "example.com. 300 IN A 192.0.2.10"),
+	}
+	args := CheckArgs{
+		Domain:       "example.com",
+		RecordType:   TypeA,
+		Expected:     []string{"192.0.2.10"},
+		Resolver:     "resolver:53",
+		Port:         "5353",
+		Exchanger:    exchanger,
+		HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.1"}},
+	}
+
+	result, err := Check(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if ok, reason := result.Match(); !ok {
+		t.Errorf("Match() = false, %q", reason)
+	}
+
+	for _, port := range []string{"0", "65536", "dns"} {
+		args.Port = port
+		if _, err := Check(context.Background(), args); err == nil {
+			t.Errorf("Check() with port %q succeeded, want error", port)
+		}
+	}
+}
+
+func TestCheckConcurrency(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	exchanger := fakeExchanger{
+		"resolver:53": reply(t, "example.com. 300 IN NS ns1.example.com."),
+	}
+	var addresses []string
+	for i := 1; i <= 6; i++ {
+		addr := fmt.Sprintf("192.0.2.%d", i)
+		addresses = append(addresses, addr)
+		answer := reply(t, "example.com. 300 IN A 192.0.2.100")
+		exchanger[addr+":53"] = func(msg *dns.Msg) *dns.Msg {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				m := maxInFlight.Load()
+				if n <= m || maxInFlight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			// Later servers answer first.
+			time.Sleep(time.Duration(7-i) * 5 * time.Millisecond)
+			return answer(msg)
+		}
+	}
+
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:       "example.com",
+		RecordType:   TypeA,
+		Expected:     []string{"192.0.2.100"},
+		Resolver:     "resolver:53",
+		Exchanger:    exchanger,
+		HostResolver: fakeHosts{"ns1.example.com.": addresses},
+		Concurrency:  2,
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if got := maxInFlight.Load(); got != 2 {
+		t.Errorf("max concurrent queries = %d, want 2", got)
+	}
+	for i, s := range result.Servers {
+		if s.Address != addresses[i] || !s.Match {
+			t.Errorf("server %d = %+v, want %s matching", i, s, addresses[i])
+		}
+	}
+}
+
+func TestCheckMatchAbsent(t *testing.T) {
+	exchanger := fakeExchanger{
+		"resolver:53": reply(t,
+			"example.com. 300 IN NS ns1.example.com.",
+			"example.com. 300 IN NS ns2.example.com.",
+		),
+		"192.0.2.1:53": reply(t, "example.com. 300 IN A 192.0.2.200"),
+		"192.0.2.2:53": reply(t, "example.com. 300 IN A 192.0.2.100"),
+	}
+
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:     "example.com",
+		RecordType: TypeA,
+		Expected:   []string{"192.0.2.100"},
+		MatchMode:  MatchAbsent,
+		Resolver:   "resolver:53",
+		Exchanger:  exchanger,
+		HostResolver: fakeHosts{
+			"ns1.example.com.": {"192.0.2.1"},
+			"ns2.example.com.": {"192.0.2.2"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if !result.Servers[0].Match || result.Servers[1].Match {
+		t.Errorf("Servers = %+v, want only the first to match", result.Servers)
+	}
+	matched, reason := result.Match()
+	if matched || reason != "example.com: 1 of 2 servers still return the old A record" {
+		t.Errorf("Match() = %v, %q", matched, reason)
+	}
+}
+
+func TestCheckArgsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    CheckArgs
+		wantErr string
+	}{
+		{
+			name: "valid",
+			args: CheckArgs{Domain: "example.com", RecordType: TypeA, Expected: []string{"192.0.2.1"}},
+		},
+		{
+			name: "discovery",
+			args: CheckArgs{Domain: "example.com", RecordType: TypeA},
+		},
+		{
+			name:    "no domain",
+			args:    CheckArgs{RecordType: TypeA, Expected: []string{"192.0.2.1"}},
+			wantErr: "no domain name",
+		},
+		{
+			name:    "malformed domain",
+			args:    CheckArgs{Domain: "example..com", RecordType: TypeA},
+			wantErr: "invalid domain name",
+		},
+		{
+			name:    "no record type",
+			args:    CheckArgs{Domain: "example.com", Expected: []string{"192.0.2.1"}},
+			wantErr: "no record type",
+		},
+		{
+			name:    "unsupported record type",
+			args:    CheckArgs{Domain: "example.com", RecordType: RecordType(dns.TypeHINFO)},
+			wantErr: "unsupported record type",
+		},
+		{
+			name:    "match mode without expected values",
+			args:    CheckArgs{Domain: "example.com", RecordType: TypeA, MatchMode: MatchAbsent},
+			wantErr: "need expected values",
+		},
+		{
+			name:    "required CAA for another type",
+			args:    CheckArgs{Domain: "example.com", RecordType: TypeTXT, RequireCAA: []string{"issue letsencrypt.org"}},
+			wantErr: "against TXT records",
+		},
+		{
+			name:    "TXT prefix for another type",
+			args:    CheckArgs{Domain: "example.com", RecordType: TypeMX, TXTPrefix: "v=spf1"},
+			wantErr: "can't filter MX records",
+		},
+		{
+			name:    "ignored MX preferences for another type",
+			args:    CheckArgs{Domain: "example.com", RecordType: TypeSRV, IgnoreMXPreference: true},
+			wantErr: "can't be ignored for SRV records",
+		},
+		{
+			name:    "ignored MX preferences with regex",
+			args:    CheckArgs{Domain: "example.com", RecordType: TypeMX, Expected: []string{"mx.*"}, MatchMode: MatchRegex, IgnoreMXPreference: true},
+			wantErr: "can't be ignored with MatchRegex",
+		},
+		{
+			name:    "given nameservers with DNSSEC validation",
+			args:    CheckArgs{Domain: "example.com", RecordType: TypeA, Nameservers: []string{"192.0.2.53"}, ValidateDNSSEC: true},
+			wantErr: "need the zone looked up",
+		},
+		{
+			name:    "given nameservers with an apex CNAME policy",
+			args:    CheckArgs{Domain: "example.com", RecordType: TypeA, Nameservers: []string{"192.0.2.53"}, ApexCNAME: ApexCNAMEFollow},
+			wantErr: "need the zone looked up",
+		},
+		{
+			name:    "primary's records as patterns",
+			args:    CheckArgs{Domain: "example.com", RecordType: TypeTXT, ExpectedFromPrimary: true, MatchMode: MatchRegex},
+			wantErr: "can't be used as patterns",
+		},
+		{
+			name:    "every pattern without regex",
+			args:    CheckArgs{Domain: "example.com", RecordType: TypeA, Expected: []string{"192.0.2.1"}, RequireEveryPattern: true},
+			wantErr: "needs MatchRegex",
+		},
+		{
+			name:    "reference name with regex",
+			args:    CheckArgs{Domain: "example.com", RecordType: TypeTXT, ExpectedFromName: "reference.example.com", MatchMode: MatchRegex},
+			wantErr: "reference name's records can't be used as patterns",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.args.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckValidatesArgs(t *testing.T) {
+	_, err := Check(context.Background(), CheckArgs{
+		RecordType: TypeA,
+		Exchanger: exchangerFunc(func(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+			t.Errorf("query sent to %s for an invalid check", address)
+			return nil, errors.New("unexpected query")
+		}),
+	})
+	if err == nil || !strings.Contains(err.Error(), "no domain name") {
+		t.Errorf("Check() error = %v, want no domain name", err)
+	}
+}
+
+func TestCheckDSQueriesParent(t *testing.T) {
+	ds := reply(t, "example.com. 3600 IN DS 55648 13 2 b4c8c1fe2e7477127b27115656ad6256f424625bf5c1e2770ce6d6e37df61d17")
+	nsFor := map[string]func(*dns.Msg) *dns.Msg{
+		"com.":         reply(t, "com. 172800 IN NS a.gtld-servers.net."),
+		"example.com.": reply(t, "example.com. 300 IN NS ns1.example.com."),
+	}
+	exchanger := exchangerFunc(func(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+		switch address {
+		case "resolver:53":
+			return nsFor[msg.Question[0].Name](msg), nil
+		case "192.0.2.30:53":
+			return ds(msg), nil
+		}
+		t.Errorf("unexpected query to %s for %s", address, msg.Question[0].Name)
+		return new(dns.Msg).SetRcode(msg, dns.RcodeRefused), nil
+	})
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:     "example.com",
+		RecordType: TypeDS,
+		Expected:   []string{"55648 13 2 B4C8C1FE2E7477127B27115656AD6256F424625BF5C1E2770CE6D6E37DF61D17"},
+		Resolver:   "resolver:53",
+		Exchanger:  exchanger,
+		HostResolver: fakeHosts{
+			"a.gtld-servers.net.": {"192.0.2.30"},
+			"ns1.example.com.":    {"192.0.2.53"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if result.Zone != "com." || len(result.Servers) != 1 || result.Servers[0].Nameserver != "a.gtld-servers.net." {
+		t.Errorf("zone = %q, servers %+v; want the com. servers", result.Zone, result.Servers)
+	}
+	if ok, reason := result.Match(); !ok {
+		t.Errorf("Match() = false: %s", reason)
+	}
+}
+
+func TestParentName(t *testing.T) {
+	for name, want := range map[string]string{
+		"sub.example.com.": "example.com.",
+		"example.com.":     "com.",
+		"com.":             ".",
+		`a\.b.example.`:    "example.",
+	} {
+		if got := parentName(name); got != want {
+			t.Errorf("parentName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
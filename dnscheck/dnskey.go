@@ -0,0 +1,21 @@
+package dnscheck
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// formatDNSKEY renders a DNSKEY record as
+// "flags protocol algorithm public-key-base64".
+func formatDNSKEY(r *dns.DNSKEY) string {
+	return fmt.Sprintf("%d %d %d %s", r.Flags, r.Protocol, r.Algorithm, r.PublicKey)
+}
+
+// normalizeDNSKEY puts a DNSKEY value into canonical form: the three
+// numeric fields separated by single spaces, followed by the public key
+// with any spaces within it removed, as zone files may split it. Unlike hex,
+// base64 is case-sensitive, so the key is otherwise left as is.
+func normalizeDNSKEY(value string) string {
+	return normalizeKeyData(value, false)
+}
@@ -0,0 +1,88 @@
+package dnscheck
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ednsBufferSize is the UDP payload size advertised in EDNS0, large enough
+// for most signed answers to avoid truncation.
+const ednsBufferSize = 4096
+
+// dnssecExchanger advertises EDNS0 with the DNSSEC OK (DO) bit on every query
+// before passing it on, so servers include RRSIGs in their answers.
+type dnssecExchanger struct {
+	Exchanger
+}
+
+func (d dnssecExchanger) Exchange(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+	if opt := msg.IsEdns0(); opt == nil {
+		msg = msg.Copy()
+		msg.SetEdns0(ednsBufferSize, true)
+	} else if !opt.Do() {
+		msg = msg.Copy()
+		msg.IsEdns0().SetDo()
+	}
+	return d.Exchanger.Exchange(ctx, msg, address)
+}
+
+// answerSignatures returns the RRSIG records in answer, without their
+// headers, e.g. "A 13 2 300 20240201000000 20240101000000 34505 example.com. ...".
+func answerSignatures(answer []dns.RR) []string {
+	var signatures []string
+	for _, record := range answer {
+		if sig, ok := record.(*dns.RRSIG); ok {
+			signatures = append(signatures, strings.TrimPrefix(sig.String(), sig.Hdr.String()))
+		}
+	}
+	return signatures
+}
+
+// checkSignatures verifies that the answer section of response carries an
+// RRSIG consistent with the returned RRset: it must cover the requested type
+// and its label count must not exceed the owner name's (a smaller count is
+// legitimate for wildcard expansions). It does not verify the signature
+// cryptographically. An answer with no records of the requested type is not
+// checked, since there is no RRset to sign.
+func checkSignatures(response *dns.Msg, domain string, recordType RecordType) error {
+	owner := dns.Fqdn(domain)
+
+	var records int
+	var signatures []*dns.RRSIG
+	for _, record := range response.Answer {
+		if !strings.EqualFold(record.Header().Name, owner) {
+			continue
+		}
+		if sig, ok := record.(*dns.RRSIG); ok {
+			signatures = append(signatures, sig)
+			continue
+		}
+		if record.Header().Rrtype == uint16(recordType) {
+			records++
+		}
+	}
+	if records == 0 {
+		return nil
+	}
+	if len(signatures) == 0 {
+		return fmt.Errorf("missing RRSIG for %s %s", owner, recordType)
+	}
+
+	labels := uint8(dns.CountLabel(owner))
+	var reasons []string
+	for _, sig := range signatures {
+		if sig.TypeCovered != uint16(recordType) {
+			reasons = append(reasons, fmt.Sprintf("RRSIG covers %s", dns.TypeToString[sig.TypeCovered]))
+			continue
+		}
+		if sig.Labels > labels {
+			reasons = append(reasons, fmt.Sprintf("RRSIG labels %d exceeds owner labels %d", sig.Labels, labels))
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("no consistent RRSIG for %s %s: %s", owner, recordType, strings.Join(reasons, "; "))
+}
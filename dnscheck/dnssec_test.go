@@ -0,0 +1,123 @@
+package dnscheck
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("dns.NewRR(%q) error: %v", s, err)
+	}
+	return rr
+}
+
+func TestCheckSignatures(t *testing.T) {
+	const sig = "20300101000000 20200101000000 12345 example.com. AAAA"
+
+	tests := []struct {
+		name    string
+		answer  []string
+		wantErr bool
+	}{
+		{
+			name: "matching signature",
+			answer: []string{
+				"www.example.com. 300 IN A 192.0.2.1",
+				"www.example.com. 300 IN RRSIG A 13 3 300 " + sig,
+			},
+		},
+		{
+			name: "wildcard expansion has fewer labels",
+			answer: []string{
+				"www.example.com. 300 IN A 192.0.2.1",
+				"www.example.com. 300 IN RRSIG A 13 2 300 " + sig,
+			},
+		},
+		{
+			name: "missing signature",
+			answer: []string{
+				"www.example.com. 300 IN A 192.0.2.1",
+			},
+			wantErr: true,
+		},
+		{
+			name: "signature covers wrong type",
+			answer: []string{
+				"www.example.com. 300 IN A 192.0.2.1",
+				"www.example.com. 300 IN RRSIG AAAA 13 3 300 " + sig,
+			},
+			wantErr: true,
+		},
+		{
+			name: "signature labels exceed owner",
+			answer: []string{
+				"www.example.com. 300 IN A 192.0.2.1",
+				"www.example.com. 300 IN RRSIG A 13 4 300 " + sig,
+			},
+			wantErr: true,
+		},
+		{
+			name:   "empty answer is not checked",
+			answer: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := new(dns.Msg)
+			for _, s := range tt.answer {
+				response.Answer = append(response.Answer, mustRR(t, s))
+			}
+			err := checkSignatures(response, "www.example.com", TypeA)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkSignatures() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckDNSSEC(t *testing.T) {
+	// Both servers fail the query unless it carries the DO bit.
+	requireDO := func(handler func(*dns.Msg) *dns.Msg) func(*dns.Msg) *dns.Msg {
+		return func(msg *dns.Msg) *dns.Msg {
+			if opt := msg.IsEdns0(); opt == nil || !opt.Do() || opt.UDPSize() != 4096 {
+				t.Errorf("query for %s without EDNS0 DO bit", msg.Question[0].Name)
+			}
+			return handler(msg)
+		}
+	}
+	exchanger := fakeExchanger{
+		"resolver:53": requireDO(reply(t, "example.com. 300 IN NS ns1.example.com.")),
+		"192.0.2.1:53": requireDO(reply(t,
+			"example.com. 300 IN A 192.0.2.1",
+			"example.com. 300 IN RRSIG A 13 2 300 20300101000000 20200101000000 12345 example.com. AAAA",
+		)),
+	}
+
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:       "example.com",
+		RecordType:   TypeA,
+		Expected:     []string{"192.0.2.1"},
+		DNSSEC:       true,
+		Resolver:     "resolver:53",
+		Exchanger:    exchanger,
+		HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.1"}},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	s := result.Servers[0]
+	if !s.Match {
+		t.Errorf("Match = false, values %v", s.Values)
+	}
+	want := []string{"A 13 2 300 20300101000000 20200101000000 12345 example.com. AAAA"}
+	if !slices.Equal(s.Signatures, want) {
+		t.Errorf("Signatures = %q, want %q", s.Signatures, want)
+	}
+}
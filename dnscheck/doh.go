@@ -0,0 +1,71 @@
+package dnscheck
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// dohContentType is the media type of DNS messages sent over HTTPS.
+const dohContentType = "application/dns-message"
+
+// isDoHAddress reports whether address is a DNS over HTTPS URL, e.g.
+// "https://dns.google/dns-query".
+func isDoHAddress(address string) bool {
+	return strings.HasPrefix(address, "https://")
+}
+
+// exchangeHTTPS sends a DNS query to the DNS over HTTPS endpoint url using
+// the RFC 8484 wire format over POST. As the RFC recommends, the query is
+// sent with ID 0 so responses are cacheable; the response is given the ID of
+// msg so callers can't tell the difference.
+func (t *transport) exchangeHTTPS(ctx context.Context, msg *dns.Msg, url string) (*dns.Msg, error) {
+	query := msg.Copy()
+	query.Id = 0
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohContentType)
+	req.Header.Set("Accept", dohContentType)
+
+	client := t.http
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS over HTTPS request to %s failed: %s", url, resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != dohContentType {
+		return nil, fmt.Errorf("DNS over HTTPS response from %s has content type %q, want %s", url, mediaType, dohContentType)
+	}
+	// A DNS message is at most 65535 bytes.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+
+	response := new(dns.Msg)
+	if err := response.Unpack(body); err != nil {
+		return nil, fmt.Errorf("DNS over HTTPS response from %s: %w", url, err)
+	}
+	response.Id = msg.Id
+	return response, nil
+}
@@ -0,0 +1,60 @@
+package dnscheck
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestExchangeHTTPS(t *testing.T) {
+	answer := reply(t, "example.com. 300 IN NS ns1.example.com.")
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dohContentType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		query := new(dns.Msg)
+		if err := query.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if query.Id != 0 {
+			t.Errorf("query ID = %d, want 0", query.Id)
+		}
+		packed, _ := answer(query).Pack()
+		w.Header().Set("Content-Type", dohContentType)
+		w.Write(packed)
+	}))
+	defer server.Close()
+
+	tr := &transport{udp: dnsClient, tcp: dnsTCPClient, http: server.Client()}
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeNS)
+	response, err := tr.Exchange(context.Background(), msg, server.URL+"/dns-query")
+	if err != nil {
+		t.Fatalf("Exchange() error: %v", err)
+	}
+	if response.Id != msg.Id {
+		t.Errorf("response ID = %d, want %d", response.Id, msg.Id)
+	}
+	if len(response.Answer) != 1 {
+		t.Errorf("Answer = %v, want one NS record", response.Answer)
+	}
+}
+
+func TestExchangeHTTPSStatus(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	tr := &transport{udp: dnsClient, tcp: dnsTCPClient, http: server.Client()}
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeNS)
+	if _, err := tr.Exchange(context.Background(), msg, server.URL+"/dns-query"); err == nil {
+		t.Error("Exchange() with a 404 response succeeded, want error")
+	}
+}
@@ -0,0 +1,31 @@
+package dnscheck
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// formatDS renders a DS record as "keytag algorithm digest-type digest-hex".
+func formatDS(r *dns.DS) string {
+	return fmt.Sprintf("%d %d %d %s", r.KeyTag, r.Algorithm, r.DigestType, strings.ToLower(r.Digest))
+}
+
+// normalizeDS puts a DS value into canonical form. A DS value has the same
+// layout as a TLSA value, three numeric fields followed by hex, so it's
+// normalized the same way.
+func normalizeDS(value string) string {
+	return normalizeKeyData(value, true)
+}
+
+// parentName returns the name one label above fqdn, whose zone holds the
+// DS records for a zone apexed at fqdn, e.g. "com." for "example.com.".
+// The parent of a top-level domain is the root, ".".
+func parentName(fqdn string) string {
+	next, end := dns.NextLabel(fqdn, 0)
+	if end {
+		return "."
+	}
+	return fqdn[next:]
+}
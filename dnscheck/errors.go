@@ -0,0 +1,60 @@
+package dnscheck
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNoNameservers is returned, wrapped, by FindNameservers and Check
+	// when no NS records are found for the domain or any of its ancestors.
+	ErrNoNameservers = errors.New("no nameservers found")
+
+	// ErrNameserverUnresolvable is wrapped by the ServerResult.Error of a
+	// nameserver whose hostname couldn't be resolved to a usable address.
+	ErrNameserverUnresolvable = errors.New("could not resolve nameserver")
+
+	// ErrTruncated is wrapped by the error of a query whose response still
+	// had the TC bit set after the Exchanger was done with it, which means
+	// the answer is incomplete. The default Exchanger retries truncated UDP
+	// responses over TCP, so it is usually seen with custom Exchangers.
+	ErrTruncated = errors.New("truncated response")
+)
+
+// QueryError is the ServerResult.Error of a server that couldn't be queried,
+// e.g. because of a timeout or a refused connection. Err is the underlying
+// network error.
+type QueryError struct {
+	Nameserver string // hostname of the nameserver, if known
+	Address    string // address that was queried
+	Err        error
+}
+
+func (e *QueryError) Error() string {
+	return "query failed: " + e.Err.Error()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// ResolverError is returned, wrapped, when a query failed on the recursive
+// resolver and every fallback resolver. Errors holds the error from each
+// resolver, in the order they were tried.
+type ResolverError struct {
+	Resolvers []string
+	Errors    []error
+}
+
+func (e *ResolverError) Error() string {
+	failures := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		failures[i] = fmt.Sprintf("%s: %v", e.Resolvers[i], err)
+	}
+	return "every resolver failed: " + strings.Join(failures, "; ")
+}
+
+func (e *ResolverError) Unwrap() []error {
+	return e.Errors
+}
@@ -0,0 +1,329 @@
+package dnscheck
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var dnsClient = &dns.Client{}
+
+var dnsTCPClient = &dns.Client{
+	Net: "tcp",
+}
+
+// tlsScheme prefixes a resolver address that should be queried over DNS over
+// TLS (RFC 7858), e.g. "tls://1.1.1.1" or "tls://dns.google:853".
+const tlsScheme = "tls://"
+
+// udpTimeout bounds a hand-rolled UDP exchange when the context has no
+// deadline, matching the miekg/dns client's default.
+const udpTimeout = 2 * time.Second
+
+// ErrSpoofedResponse is returned when spoofing detection is enabled and a
+// response does not correspond to the query that was sent, which indicates
+// an off-path injection attempt or a broken resolver.
+var ErrSpoofedResponse = errors.New("possible spoofed response")
+
+// Exchanger sends a DNS query to address ("host:port") and returns the
+// response. The default implementation sends the query over UDP and falls
+// back to TCP. Tests and callers can supply their own via
+// CheckArgs.Exchanger to run checks without network access.
+type Exchanger interface {
+	Exchange(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error)
+}
+
+// HostResolver resolves nameserver hostnames to addresses. It is satisfied
+// by *net.Resolver; net.DefaultResolver is used by default.
+type HostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// transport is the default Exchanger. It holds the UDP and TCP clients used
+// to send queries.
+type transport struct {
+	udp            *dns.Client
+	tcp            *dns.Client
+	http           *http.Client // for DNS over HTTPS; http.DefaultClient if nil
+	detectSpoofing bool
+	forceTCP       bool
+}
+
+var defaultTransport = &transport{udp: dnsClient, tcp: dnsTCPClient}
+
+// newTransport returns a transport configured from args. If args does not
+// change any transport settings, the default transport is returned.
+func newTransport(args CheckArgs) *transport {
+	if args.LocalPort == 0 && !args.DetectSpoofing && !args.ForceTCP {
+		return defaultTransport
+	}
+	t := &transport{
+		udp:            dnsClient,
+		tcp:            dnsTCPClient,
+		detectSpoofing: args.DetectSpoofing,
+		forceTCP:       args.ForceTCP,
+	}
+	if args.LocalPort != 0 {
+		t.udp = &dns.Client{
+			Dialer: &net.Dialer{LocalAddr: &net.UDPAddr{Port: args.LocalPort}},
+		}
+		t.tcp = &dns.Client{
+			Net:    "tcp",
+			Dialer: &net.Dialer{LocalAddr: &net.TCPAddr{Port: args.LocalPort}},
+		}
+	}
+	return t
+}
+
+// Exchange sends a DNS query, falling back to TCP if UDP fails or the
+// response is truncated, or over TCP only if forceTCP is set. Addresses
+// starting with "tls://" are queried over DNS over TLS instead, and
+// "https://" URLs over DNS over HTTPS.
+func (t *transport) Exchange(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+	if isDoHAddress(address) {
+		return t.exchangeHTTPS(ctx, msg, address)
+	}
+	if address, serverName, ok := parseTLSAddress(address); ok {
+		return t.exchangeTLS(ctx, msg, address, serverName)
+	}
+	if t.detectSpoofing {
+		return t.exchangeStrict(ctx, msg, address)
+	}
+	if t.forceTCP {
+		response, _, err := t.tcp.ExchangeContext(ctx, msg, address)
+		return response, err
+	}
+	response, _, err := t.udp.ExchangeContext(ctx, msg, address)
+	if err != nil || response.Truncated {
+		response, _, err = t.tcp.ExchangeContext(ctx, msg, address)
+	}
+	return response, err
+}
+
+// exchangeTLS sends a DNS query over TLS to address, verifying that the
+// server's certificate is valid for serverName. An IP address as serverName
+// must appear in the certificate's IP SANs, as it does for public resolvers
+// like 1.1.1.1 and 8.8.8.8.
+func (t *transport) exchangeTLS(ctx context.Context, msg *dns.Msg, address, serverName string) (*dns.Msg, error) {
+	client := &dns.Client{
+		Net:       "tcp-tls",
+		TLSConfig: &tls.Config{ServerName: serverName},
+		Dialer:    t.tcp.Dialer,
+	}
+	response, _, err := client.ExchangeContext(ctx, msg, address)
+	return response, err
+}
+
+// parseTLSAddress reports whether address uses the "tls://" scheme and, if
+// so, returns it as host:port, defaulting to port 853, along with the host
+// to verify the certificate against.
+func parseTLSAddress(address string) (hostport, serverName string, ok bool) {
+	rest, ok := strings.CutPrefix(address, tlsScheme)
+	if !ok {
+		return "", "", false
+	}
+	host, port, err := net.SplitHostPort(rest)
+	if err != nil {
+		host, port = strings.Trim(rest, "[]"), "853"
+	}
+	return net.JoinHostPort(host, port), host, true
+}
+
+// exchangeStrict is like Exchange, but treats any response that does not
+// match the query as ErrSpoofedResponse. The miekg/dns client silently
+// discards UDP responses with a mismatched ID, so the UDP exchange is done
+// by hand on a fresh socket, where any such response is unexpected.
+func (t *transport) exchangeStrict(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+	var response *dns.Msg
+	var err error
+	if !t.forceTCP {
+		response, err = t.exchangeUDPStrict(ctx, msg, address)
+	}
+	if t.forceTCP || err != nil && !errors.Is(err, ErrSpoofedResponse) || err == nil && response.Truncated {
+		response, _, err = t.tcp.ExchangeContext(ctx, msg, address)
+		if errors.Is(err, dns.ErrId) {
+			err = fmt.Errorf("%w from %s: query ID %d does not match response", ErrSpoofedResponse, address, msg.Id)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkQuestion(msg, response, address); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (t *transport) exchangeUDPStrict(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+	conn, err := t.udp.DialContext(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(udpTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	if err := conn.WriteMsg(msg); err != nil {
+		return nil, err
+	}
+	response, err := conn.ReadMsg()
+	if err != nil {
+		return nil, err
+	}
+	if response.Id != msg.Id {
+		return nil, fmt.Errorf("%w from %s: query ID %d does not match response ID %d", ErrSpoofedResponse, address, msg.Id, response.Id)
+	}
+	return response, nil
+}
+
+// checkQuestion verifies that response echoes the question in msg.
+func checkQuestion(msg, response *dns.Msg, address string) error {
+	if len(response.Question) != len(msg.Question) {
+		return fmt.Errorf("%w from %s: question count %d does not match query", ErrSpoofedResponse, address, len(response.Question))
+	}
+	for i, q := range msg.Question {
+		got := response.Question[i]
+		if !strings.EqualFold(got.Name, q.Name) || got.Qtype != q.Qtype || got.Qclass != q.Qclass {
+			return fmt.Errorf("%w from %s: question %s does not match query %s", ErrSpoofedResponse, address, got.String(), q.String())
+		}
+	}
+	return nil
+}
+
+// exchanger returns the Exchanger to use for args.
+func (args CheckArgs) exchanger() Exchanger {
+	ex := args.baseExchanger()
+	if args.PerQueryTimeout > 0 {
+		ex = timeoutExchanger{ex, args.PerQueryTimeout}
+	}
+	// Waiting for the limiter doesn't count against PerQueryTimeout.
+	if args.RateLimiter != nil {
+		ex = rateLimitExchanger{ex, args.RateLimiter}
+	}
+	if args.DNSSEC {
+		ex = dnssecExchanger{ex}
+	}
+	if args.DigOutput != nil {
+		ex = digExchanger{ex, new(sync.Mutex), args.DigOutput, args.ForceTCP}
+	}
+	if len(args.FallbackResolvers) > 0 {
+		ex = fallbackExchanger{ex, append([]string{args.resolver()}, args.FallbackResolvers...)}
+	}
+	return ex
+}
+
+// baseExchanger returns the Exchanger that sends args's queries over the
+// network: args.Exchanger if set, and otherwise the built-in client.
+func (args CheckArgs) baseExchanger() Exchanger {
+	if args.Exchanger != nil {
+		return args.Exchanger
+	}
+	return newTransport(args)
+}
+
+// fallbackExchanger retries a query that fails on the first of resolvers on
+// each of the others in turn, so one unreachable resolver doesn't fail the
+// whole check. Queries to any other address are passed through.
+type fallbackExchanger struct {
+	Exchanger
+	resolvers []string
+}
+
+func (f fallbackExchanger) Exchange(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+	if address != f.resolvers[0] {
+		return f.Exchanger.Exchange(ctx, msg, address)
+	}
+	resolverErr := new(ResolverError)
+	for _, resolver := range f.resolvers {
+		response, err := f.Exchanger.Exchange(ctx, msg, resolver)
+		if err == nil {
+			return response, nil
+		}
+		resolverErr.Resolvers = append(resolverErr.Resolvers, resolver)
+		resolverErr.Errors = append(resolverErr.Errors, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, resolverErr
+}
+
+// timeoutExchanger bounds every exchange by its own timeout, in addition to
+// any deadline on the caller's context, so that one unresponsive server
+// fails fast instead of using up the whole check's budget.
+type timeoutExchanger struct {
+	Exchanger
+	timeout time.Duration
+}
+
+func (t timeoutExchanger) Exchange(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	response, err := t.Exchanger.Exchange(queryCtx, msg, address)
+	if err != nil && ctx.Err() == nil && queryCtx.Err() != nil {
+		return nil, fmt.Errorf("no response within %s: %w", t.timeout, err)
+	}
+	return response, err
+}
+
+// hostResolver returns the HostResolver to use for args.
+func (args CheckArgs) hostResolver() HostResolver {
+	if args.HostResolver != nil {
+		return args.HostResolver
+	}
+	return net.DefaultResolver
+}
+
+// logger returns the Logger to use for args, with its RequestID attached.
+func (args CheckArgs) logger() *slog.Logger {
+	log := args.Logger
+	if log == nil {
+		return slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	if args.RequestID != "" {
+		log = log.With("request_id", args.RequestID)
+	}
+	return log
+}
+
+// resolvConfPath is the file SystemResolver reads nameservers from.
+var resolvConfPath = "/etc/resolv.conf"
+
+// resolver returns the recursive resolver to use for args.
+func (args CheckArgs) resolver() string {
+	switch {
+	case args.Resolver != "":
+		return args.Resolver
+	case args.SystemResolver:
+		return systemResolver()
+	default:
+		return DefaultResolver
+	}
+}
+
+// systemResolver returns the first nameserver in resolvConfPath as
+// host:port, or DefaultResolver if the file is missing or lists none, e.g.
+// on Windows.
+func systemResolver() string {
+	config, err := dns.ClientConfigFromFile(resolvConfPath)
+	if err != nil || len(config.Servers) == 0 {
+		return DefaultResolver
+	}
+	return net.JoinHostPort(config.Servers[0], config.Port)
+}
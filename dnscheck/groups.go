@@ -0,0 +1,136 @@
+package dnscheck
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ValueGroup is a set of servers that gave the same answer: either the same
+// normalized set of values, or the same error.
+type ValueGroup struct {
+	Values  []string // sorted values of the first server in the group; empty for errors and empty answers
+	Rcode   Rcode    // shared response code, e.g. RcodeNXDomain for a group of empty answers
+	Error   error    // shared error, for a group of servers that failed
+	Match   bool     // whether every server in the group matched
+	Servers []ServerResult
+}
+
+// Groups groups the servers by the answer they returned, comparing values
+// the same way Match does. Servers that failed are grouped by error message,
+// and servers that returned no records are grouped by response code, so
+// NXDOMAIN and an empty NOERROR answer are kept apart. Groups are
+// ordered by size, largest first, then by first appearance.
+func (r *CheckResult) Groups() []ValueGroup {
+	normalize := normalizerFor(r.RecordType)
+	var groups []ValueGroup
+	index := make(map[string]int)
+	for _, s := range r.Servers {
+		var key string
+		if s.Error != nil {
+			key = "error\x00" + s.Error.Error()
+		} else {
+			normalized := make([]string, len(s.Values))
+			for i, v := range s.Values {
+				normalized[i] = normalize(v)
+			}
+			slices.Sort(normalized)
+			key = fmt.Sprintf("values\x00%d\x00%s", s.Rcode, strings.Join(normalized, "\x00"))
+		}
+
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			group := ValueGroup{Rcode: s.Rcode, Error: s.Error, Match: true}
+			if s.Error == nil {
+				group.Values = slices.Sorted(slices.Values(s.Values))
+			}
+			groups = append(groups, group)
+		}
+		groups[i].Servers = append(groups[i].Servers, s)
+		groups[i].Match = groups[i].Match && s.Match
+	}
+
+	slices.SortStableFunc(groups, func(a, b ValueGroup) int {
+		return cmp.Compare(len(b.Servers), len(a.Servers))
+	})
+	return groups
+}
+
+// answer describes the answer shared by the servers in a group that didn't
+// fail: its values, or the response code or "no records" if it was empty.
+func (g ValueGroup) answer() string {
+	switch {
+	case len(g.Values) > 0:
+		return strings.Join(g.Values, ", ")
+	case g.Rcode != RcodeSuccess:
+		return g.Rcode.String()
+	default:
+		return "no records"
+	}
+}
+
+// Consistent reports whether every server that responded returned the same
+// answer, regardless of whether it matched the expected values, along with
+// the distinct answers found, most common first. It's useful for spotting a
+// split-brain zone without knowing what the right answer is, so Expected
+// may be empty. Servers that failed are ignored; values are compared the
+// same way Groups compares them.
+func (r *CheckResult) Consistent() (bool, []string) {
+	var answers []string
+	for _, g := range r.Groups() {
+		if g.Error == nil {
+			answers = append(answers, g.answer())
+		}
+	}
+	return len(answers) <= 1, answers
+}
+
+// ReportGroups is like Report but lists the servers grouped by the answer
+// they returned, which makes it easy to see how many distinct states exist
+// during a partial propagation. Nothing is written if every server matched.
+func (r *CheckResult) ReportGroups(w io.Writer, color bool) {
+	matched, reason := r.Match()
+	if matched {
+		return
+	}
+
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + colorReset
+	}
+
+	fmt.Fprintln(w, paint(colorRed, reason))
+	if r.SampledFrom > 0 {
+		fmt.Fprintf(w, "sampled %d of %d servers\n", len(r.Servers), r.SampledFrom)
+	}
+	for _, g := range r.Groups() {
+		var heading string
+		if g.Error != nil {
+			heading = fmt.Sprintf("%s failed: %v", pluralServers(len(g.Servers)), g.Error)
+		} else {
+			heading = fmt.Sprintf("%s returned %s", pluralServers(len(g.Servers)), g.answer())
+		}
+		if g.Match {
+			fmt.Fprintln(w, paint(colorGreen, heading+" (ok)"))
+		} else {
+			fmt.Fprintln(w, paint(colorRed, heading))
+		}
+		for _, s := range g.Servers {
+			fmt.Fprintf(w, "  %s\n", s.label())
+		}
+	}
+}
+
+// pluralServers returns "1 server" or "N servers".
+func pluralServers(n int) string {
+	if n == 1 {
+		return "1 server"
+	}
+	return fmt.Sprintf("%d servers", n)
+}
@@ -0,0 +1,97 @@
+package dnscheck
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReportGroups(t *testing.T) {
+	timeout := errors.New("query failed: i/o timeout")
+	result := &CheckResult{
+		Domain:     "example.com",
+		RecordType: TypeA,
+		Expected:   []string{"192.0.2.1", "192.0.2.2"},
+		Servers: []ServerResult{
+			{Nameserver: "ns1.example.com.", Address: "192.0.2.51", Values: []string{"192.0.2.9"}},
+			{Nameserver: "ns2.example.com.", Address: "192.0.2.52", Values: []string{"192.0.2.2", "192.0.2.1"}, Match: true},
+			{Nameserver: "ns3.example.com.", Address: "192.0.2.53", Error: timeout},
+			{Nameserver: "ns4.example.com.", Address: "192.0.2.54", Values: []string{"192.0.2.1", "192.0.2.2"}, Match: true},
+			{Nameserver: "ns5.example.com.", Address: "192.0.2.55"},
+			{Nameserver: "ns6.example.com.", Address: "192.0.2.56", Error: timeout},
+		},
+	}
+
+	groups := result.Groups()
+	if len(groups) != 4 {
+		t.Fatalf("Groups() returned %d groups, want 4: %+v", len(groups), groups)
+	}
+
+	var out bytes.Buffer
+	result.ReportGroups(&out, false)
+	want := strings.Join([]string{
+		"example.com: 4 of 6 servers returned unexpected A records (1 returned no records)",
+		"2 servers returned 192.0.2.1, 192.0.2.2 (ok)",
+		"  ns2.example.com. (192.0.2.52, IPv4)",
+		"  ns4.example.com. (192.0.2.54, IPv4)",
+		"2 servers failed: query failed: i/o timeout",
+		"  ns3.example.com. (192.0.2.53, IPv4)",
+		"  ns6.example.com. (192.0.2.56, IPv4)",
+		"1 server returned 192.0.2.9",
+		"  ns1.example.com. (192.0.2.51, IPv4)",
+		"1 server returned no records",
+		"  ns5.example.com. (192.0.2.55, IPv4)",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("ReportGroups() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestConsistent(t *testing.T) {
+	timeout := errors.New("query failed: i/o timeout")
+	tests := []struct {
+		name    string
+		servers []ServerResult
+		want    bool
+		answers []string
+	}{
+		{
+			name: "same values in different order",
+			servers: []ServerResult{
+				{Values: []string{"192.0.2.1", "192.0.2.2"}},
+				{Values: []string{"192.0.2.2", "192.0.2.1"}},
+				{Error: timeout},
+			},
+			want:    true,
+			answers: []string{"192.0.2.1, 192.0.2.2"},
+		},
+		{
+			name: "split brain",
+			servers: []ServerResult{
+				{Values: []string{"192.0.2.1"}},
+				{Values: []string{"192.0.2.9"}},
+				{Values: []string{"192.0.2.9"}},
+				{Rcode: RcodeNXDomain},
+			},
+			want:    false,
+			answers: []string{"192.0.2.9", "192.0.2.1", "NXDOMAIN"},
+		},
+		{
+			name:    "every server failed",
+			servers: []ServerResult{{Error: timeout}},
+			want:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &CheckResult{Domain: "example.com", RecordType: TypeA, Servers: tt.servers}
+			got, answers := result.Consistent()
+			if got != tt.want || !slices.Equal(answers, tt.answers) {
+				t.Errorf("Consistent() = %v, %q, want %v, %q", got, answers, tt.want, tt.answers)
+			}
+		})
+	}
+}
@@ -2,11 +2,11 @@ package dnscheck_test
 
 import (
 	"context"
-	"net"
 	"testing"
 	"time"
 
 	"github.com/jacob2161/addled/dnscheck"
+	"github.com/miekg/dns"
 )
 
 func testContext(t *testing.T) context.Context {
@@ -18,52 +18,25 @@ func testContext(t *testing.T) context.Context {
 
 const testDomain = "one.one.one.one"
 
-// nameserverIPv4s returns all IPv4 addresses for all nameservers of the test
-// domain, for use in tests that need to try multiple IPs.
-func nameserverIPv4s(t *testing.T) []string {
+// nameserverIPv4 returns an IPv4 address of one of the test domain's
+// nameservers.
+func nameserverIPv4(t *testing.T) string {
 	t.Helper()
 	ctx := testContext(t)
 	servers, err := dnscheck.FindNameservers(ctx, testDomain, "8.8.8.8:53")
 	if err != nil {
 		t.Fatalf("FindNameservers error: %v", err)
 	}
-	var ips []string
-	for _, ns := range servers {
-		addresses, err := net.DefaultResolver.LookupHost(ctx, ns)
-		if err != nil {
-			continue
-		}
-		for _, addr := range addresses {
-			if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
-				ips = append(ips, addr)
-			}
-		}
-	}
-	if len(ips) == 0 {
-		t.Fatal("could not resolve any nameserver to an IPv4 address")
+	ips, err := dnscheck.ResolveNameservers(ctx, servers, dnscheck.FamilyIPv4)
+	if err != nil {
+		t.Fatalf("could not resolve any nameserver to an IPv4 address: %v", err)
 	}
-	return ips
+	return ips[0]
 }
 
-// queryWithRetry tries querying each nameserver IP until one returns a
-// non-empty result. This handles flaky connectivity to Cloudflare anycast IPs.
-func queryWithRetry(t *testing.T, ips []string, recordType dnscheck.RecordType) []string {
-	t.Helper()
-	ctx := testContext(t)
-	for _, ip := range ips {
-		values, err := dnscheck.QueryServer(ctx, ip, testDomain, recordType)
-		if err == nil && len(values) > 0 {
-			t.Logf("successful query to %s: %v", ip, values)
-			return values
-		}
-		if err != nil {
-			t.Logf("query to %s failed: %v", ip, err)
-		} else {
-			t.Logf("query to %s returned empty", ip)
-		}
-	}
-	return nil
-}
+// queryRetries is the number of times the QueryServer tests retry a failed
+// or empty query. This handles flaky connectivity to Cloudflare anycast IPs.
+const queryRetries = 3
 
 func TestFindNameservers(t *testing.T) {
 	if testing.Short() {
@@ -86,10 +59,14 @@ func TestQueryServerA(t *testing.T) {
 		t.Skip("skipping integration test in short mode")
 	}
 
-	ips := nameserverIPv4s(t)
-	values := queryWithRetry(t, ips, dnscheck.TypeA)
+	ip := nameserverIPv4(t)
+	values, latency, err := dnscheck.QueryServer(testContext(t), ip, "53", testDomain, dnscheck.TypeA, nil, queryRetries)
+	if err != nil {
+		t.Fatalf("QueryServer(%s) error: %v", ip, err)
+	}
+	t.Logf("query to %s in %s: %v", ip, latency, values)
 	if len(values) == 0 {
-		t.Fatal("got no A records from any nameserver")
+		t.Fatalf("got no A records from %s", ip)
 	}
 
 	expected := map[string]bool{"1.1.1.1": false, "1.0.0.1": false}
@@ -105,15 +82,39 @@ func TestQueryServerA(t *testing.T) {
 	}
 }
 
+func TestQueryServerAnswerFilter(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ip := nameserverIPv4(t)
+	only := func(record dns.RR) bool {
+		a, ok := record.(*dns.A)
+		return ok && a.A.String() == "1.1.1.1"
+	}
+	values, latency, err := dnscheck.QueryServer(testContext(t), ip, "53", testDomain, dnscheck.TypeA, only, queryRetries)
+	if err != nil {
+		t.Fatalf("QueryServer(%s) error: %v", ip, err)
+	}
+	t.Logf("query to %s in %s: %v", ip, latency, values)
+	if len(values) != 1 || values[0] != "1.1.1.1" {
+		t.Errorf("QueryServer() with a filter = %v, want [1.1.1.1]", values)
+	}
+}
+
 func TestQueryServerAAAA(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test in short mode")
 	}
 
-	ips := nameserverIPv4s(t)
-	values := queryWithRetry(t, ips, dnscheck.TypeAAAA)
+	ip := nameserverIPv4(t)
+	values, latency, err := dnscheck.QueryServer(testContext(t), ip, "53", testDomain, dnscheck.TypeAAAA, nil, queryRetries)
+	if err != nil {
+		t.Fatalf("QueryServer(%s) error: %v", ip, err)
+	}
+	t.Logf("query to %s in %s: %v", ip, latency, values)
 	if len(values) == 0 {
-		t.Fatal("got no AAAA records from any nameserver")
+		t.Fatalf("got no AAAA records from %s", ip)
 	}
 
 	expected := map[string]bool{
@@ -271,3 +272,25 @@ func TestCheckCustomResolver(t *testing.T) {
 		t.Errorf("expected at least one server to match with custom resolver, none did")
 	}
 }
+
+func TestFindZoneSubdomain(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := testContext(t)
+	zone, _, err := dnscheck.FindZone(ctx, testDomain, "8.8.8.8:53")
+	if err != nil {
+		t.Fatalf("FindZone(%q) error: %v", testDomain, err)
+	}
+
+	subdomain := "addled-nonexistent." + testDomain
+	subZone, _, err := dnscheck.FindZone(ctx, subdomain, "8.8.8.8:53")
+	if err != nil {
+		t.Fatalf("FindZone(%q) error: %v", subdomain, err)
+	}
+	if subZone != zone {
+		t.Errorf("FindZone(%q) zone = %q, want %q", subdomain, subZone, zone)
+	}
+	t.Logf("zone: %s", zone)
+}
@@ -0,0 +1,265 @@
+package dnscheck
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// checkResultJSON is the JSON form of a CheckResult. Its field names are a
+// stable schema: fields may be added, but existing ones won't be renamed or
+// removed.
+type checkResultJSON struct {
+	Domain      string             `json:"domain"`
+	Type        string             `json:"type"`
+	Expected    []string           `json:"expected"`
+	Primary     string             `json:"primary,omitempty"`
+	MatchMode   string             `json:"match_mode"`
+	Zone        string             `json:"zone"`
+	Nameservers []string           `json:"nameservers"`
+	Match       bool               `json:"match"`
+	Reason      string             `json:"reason,omitempty"`
+	Error       string             `json:"error,omitempty"`
+	Servers     []serverResultJSON `json:"servers"`
+}
+
+// serverResultJSON is the JSON form of a ServerResult.
+type serverResultJSON struct {
+	Nameserver       string   `json:"nameserver"`
+	OtherNameservers []string `json:"other_nameservers,omitempty"`
+	Address          string   `json:"address,omitempty"`
+	Family           string   `json:"family,omitempty"`
+	LatencyMS        float64  `json:"latency_ms,omitempty"`
+	Values           []string `json:"values"`
+	TTLs             []uint32 `json:"ttls"`
+	Signatures       []string `json:"signatures,omitempty"`
+	Missing          []string `json:"missing,omitempty"`
+	Unexpected       []string `json:"unexpected,omitempty"`
+	CNAME            string   `json:"cname,omitempty"`
+	ApexCNAME        string   `json:"apex_cname,omitempty"`
+	Rcode            string   `json:"rcode,omitempty"`
+	Match            bool     `json:"match"`
+	Lame             bool     `json:"lame,omitempty"`
+	Error            string   `json:"error,omitempty"`
+
+	SignatureError  string   `json:"signature_error,omitempty"`
+	DNSSECStatus    string   `json:"dnssec_status,omitempty"`
+	DNSSECError     string   `json:"dnssec_error,omitempty"`
+	NSTTLError      string   `json:"ns_ttl_error,omitempty"`
+	TXTSizeWarnings []string `json:"txt_size_warnings,omitempty"`
+}
+
+// MarshalJSON encodes the result as a JSON object with these fields:
+//
+//	domain       string
+//	type         string, the record type's name, e.g. "A"
+//	expected     array of strings
+//	primary      string, the primary nameserver whose records were expected
+//	             with CheckArgs.ExpectedFromPrimary; omitted otherwise
+//	match_mode   string, how values were compared with expected: "exact",
+//	             "subset", "absent" or "regex"
+//	zone         string
+//	nameservers  array of strings
+//	match        bool, as returned by Match
+//	reason       string, as returned by Match; omitted when match is true
+//	error        string, the message of Err for a check that couldn't run;
+//	             omitted if there was none
+//	servers      array of objects:
+//	  nameserver string
+//	  other_nameservers
+//	             array of strings, the other nameservers that share address;
+//	             omitted if none
+//	  address    string; omitted if the nameserver couldn't be resolved
+//	  family     string, "IPv4" or "IPv6", the family of address; omitted
+//	             with address
+//	  latency_ms number, the server's response time in milliseconds;
+//	             omitted if it wasn't queried
+//	  values     array of strings; empty rather than null
+//	  ttls       array of numbers, the TTL of each value; empty rather than null
+//	  signatures array of strings, the RRSIGs returned; omitted if none
+//	  missing    array of strings, expected values the server didn't
+//	             return; omitted if none
+//	  unexpected array of strings, values the server returned that weren't
+//	             expected; omitted if none
+//	  cname      string, the target of a CNAME returned for the domain when
+//	             another type was checked; omitted if none
+//	  apex_cname string, the target of a CNAME returned at the zone apex;
+//	             omitted if none
+//	  rcode      string, the response code, e.g. "NXDOMAIN"; omitted for
+//	             NOERROR
+//	  match      bool
+//	  lame       bool, true if the server isn't authoritative for the zone;
+//	             omitted if false
+//	  error      string, the error's message; omitted if there was none
+//	  signature_error, dnssec_error, ns_ttl_error
+//	             strings, the messages of SignatureError, DNSSECError and
+//	             NSTTLError; each omitted if there was none
+//	  dnssec_status
+//	             string, "secure" or "bogus"; omitted if not validated
+//	  txt_size_warnings
+//	             array of strings; omitted if none
+//
+// Fields not listed, such as ExpectedByServer, are not included.
+func (r *CheckResult) MarshalJSON() ([]byte, error) {
+	match, reason := r.Match()
+	out := checkResultJSON{
+		Domain:      r.Domain,
+		Type:        r.RecordType.String(),
+		Expected:    r.Expected,
+		Primary:     r.Primary,
+		MatchMode:   r.MatchMode.String(),
+		Zone:        r.Zone,
+		Nameservers: r.Nameservers,
+		Match:       match,
+		Reason:      reason,
+		Error:       errorMessage(r.Err),
+		Servers:     make([]serverResultJSON, 0, len(r.Servers)),
+	}
+	for _, s := range r.Servers {
+		out.Servers = append(out.Servers, s.toJSON())
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a result encoded by MarshalJSON. The match and
+// reason fields are ignored, since Match computes them from the servers.
+// Errors, including the check's own, are restored as plain errors carrying
+// the original message.
+func (r *CheckResult) UnmarshalJSON(data []byte) error {
+	var in checkResultJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	recordType, err := ParseRecordType(in.Type)
+	if err != nil {
+		return err
+	}
+	mode, err := parseMatchMode(in.MatchMode)
+	if err != nil {
+		return err
+	}
+
+	*r = CheckResult{
+		Domain:      in.Domain,
+		RecordType:  recordType,
+		Expected:    in.Expected,
+		Primary:     in.Primary,
+		MatchMode:   mode,
+		Zone:        in.Zone,
+		Nameservers: in.Nameservers,
+		Err:         jsonError(in.Error),
+	}
+	for _, s := range in.Servers {
+		server := ServerResult{
+			Nameserver:       s.Nameserver,
+			OtherNameservers: s.OtherNameservers,
+			Address:          s.Address,
+			Latency:          time.Duration(s.LatencyMS * float64(time.Millisecond)),
+			Values:           s.Values,
+			TTLs:             s.TTLs,
+			Signatures:       s.Signatures,
+			Missing:          s.Missing,
+			Unexpected:       s.Unexpected,
+			CNAME:            s.CNAME,
+			ApexCNAME:        s.ApexCNAME,
+			Match:            s.Match,
+			Lame:             s.Lame,
+			Error:            jsonError(s.Error),
+			SignatureError:   jsonError(s.SignatureError),
+			DNSSECError:      jsonError(s.DNSSECError),
+			NSTTLError:       jsonError(s.NSTTLError),
+			TXTSizeWarnings:  s.TXTSizeWarnings,
+		}
+		if s.Rcode != "" {
+			if server.Rcode, err = ParseRcode(s.Rcode); err != nil {
+				return err
+			}
+		}
+		switch s.DNSSECStatus {
+		case DNSSECSecure.String():
+			server.DNSSECStatus = DNSSECSecure
+		case DNSSECBogus.String():
+			server.DNSSECStatus = DNSSECBogus
+		}
+		switch s.Family {
+		case "IPv4":
+			server.AddressFamily = FamilyIPv4
+		case "IPv6":
+			server.AddressFamily = FamilyIPv6
+		}
+		r.Servers = append(r.Servers, server)
+	}
+	return nil
+}
+
+// jsonError returns an error with message, or nil if message is empty.
+func jsonError(message string) error {
+	if message == "" {
+		return nil
+	}
+	return errors.New(message)
+}
+
+// errorMessage returns err's message, or "" if err is nil.
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// toJSON returns the JSON form of s.
+func (s ServerResult) toJSON() serverResultJSON {
+	out := serverResultJSON{
+		Nameserver:       s.Nameserver,
+		OtherNameservers: s.OtherNameservers,
+		Address:          s.Address,
+		LatencyMS:        float64(s.Latency) / float64(time.Millisecond),
+		Values:           s.Values,
+		TTLs:             s.TTLs,
+		Signatures:       s.Signatures,
+		Missing:          s.Missing,
+		Unexpected:       s.Unexpected,
+		CNAME:            s.CNAME,
+		ApexCNAME:        s.ApexCNAME,
+		Match:            s.Match,
+		Lame:             s.Lame,
+		Error:            errorMessage(s.Error),
+		SignatureError:   errorMessage(s.SignatureError),
+		DNSSECError:      errorMessage(s.DNSSECError),
+		NSTTLError:       errorMessage(s.NSTTLError),
+		TXTSizeWarnings:  s.TXTSizeWarnings,
+	}
+	if s.Rcode != RcodeSuccess {
+		out.Rcode = s.Rcode.String()
+	}
+	if s.DNSSECStatus != DNSSECNotValidated {
+		out.DNSSECStatus = s.DNSSECStatus.String()
+	}
+	if s.Address != "" {
+		out.Family = s.AddressFamily.String()
+	}
+	if out.Values == nil {
+		out.Values = []string{}
+	}
+	if out.TTLs == nil {
+		out.TTLs = []uint32{}
+	}
+	return out
+}
+
+// parseMatchMode maps a name returned by MatchMode.String back to the
+// MatchMode. An empty name, as in JSON without a match_mode field, is
+// MatchExact.
+func parseMatchMode(name string) (MatchMode, error) {
+	if name == "" {
+		return MatchExact, nil
+	}
+	for _, m := range []MatchMode{MatchExact, MatchSubset, MatchAbsent, MatchRegex} {
+		if m.String() == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported match mode: %q", name)
+}
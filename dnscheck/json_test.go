@@ -0,0 +1,173 @@
+package dnscheck
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckResultMarshalJSON(t *testing.T) {
+	result := &CheckResult{
+		Domain:      "example.com",
+		RecordType:  TypeAAAA,
+		Expected:    []string{"2001:db8::1"},
+		Zone:        "example.com.",
+		Nameservers: []string{"ns1.example.com.", "ns2.example.com."},
+		Servers: []ServerResult{
+			{Nameserver: "ns1.example.com.", Address: "192.0.2.53", AddressFamily: FamilyIPv4, Latency: 12500 * time.Microsecond, Values: []string{"2001:db8::1"}, TTLs: []uint32{300}, Match: true},
+			{Nameserver: "ns2.example.com.", Error: errors.New("could not resolve nameserver")},
+		},
+	}
+
+	got, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("json.Marshal() error: %v", err)
+	}
+	want := `{"domain":"example.com","type":"AAAA","expected":["2001:db8::1"],"match_mode":"exact","zone":"example.com.",` +
+		`"nameservers":["ns1.example.com.","ns2.example.com."],"match":false,` +
+		`"reason":"example.com: 1 of 2 servers returned unexpected AAAA records","servers":[` +
+		`{"nameserver":"ns1.example.com.","address":"192.0.2.53","family":"IPv4","latency_ms":12.5,"values":["2001:db8::1"],"ttls":[300],"match":true},` +
+		`{"nameserver":"ns2.example.com.","values":[],"ttls":[],"match":false,"error":"could not resolve nameserver"}]}`
+	if string(got) != want {
+		t.Errorf("json.Marshal() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCheckResultMarshalJSONMatch(t *testing.T) {
+	result := &CheckResult{
+		Domain:     "example.com",
+		RecordType: TypeTXT,
+		Servers:    []ServerResult{{Nameserver: "ns1.example.com.", Address: "192.0.2.53", Values: []string{"v=spf1 -all"}, Match: true}},
+	}
+
+	got, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("json.Marshal() error: %v", err)
+	}
+	want := `{"domain":"example.com","type":"TXT","expected":null,"match_mode":"exact","zone":"","nameservers":null,"match":true,"servers":[` +
+		`{"nameserver":"ns1.example.com.","address":"192.0.2.53","family":"IPv4","values":["v=spf1 -all"],"ttls":[],"match":true}]}`
+	if string(got) != want {
+		t.Errorf("json.Marshal() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCheckResultUnmarshalJSON(t *testing.T) {
+	want := &CheckResult{
+		Domain:      "example.com",
+		RecordType:  TypeMX,
+		Expected:    []string{"mail.example.com."},
+		Primary:     "ns0.example.com.",
+		Zone:        "example.com.",
+		Nameservers: []string{"ns1.example.com."},
+		Servers: []ServerResult{
+			{Nameserver: "ns1.example.com.", OtherNameservers: []string{"ns4.example.com."}, Address: "192.0.2.53", AddressFamily: FamilyIPv4, Latency: 3 * time.Millisecond, Values: []string{"mail.example.com."}, TTLs: []uint32{3600}, Match: true},
+			{Nameserver: "ns1.example.com.", Address: "2001:db8::53", AddressFamily: FamilyIPv6, Values: []string{}, TTLs: []uint32{}, Error: errors.New("i/o timeout")},
+			{Nameserver: "ns3.example.com.", Address: "192.0.2.55", AddressFamily: FamilyIPv4, Values: []string{}, TTLs: []uint32{}, Rcode: RcodeNXDomain},
+			{
+				Nameserver: "ns2.example.com.", Address: "192.0.2.54", AddressFamily: FamilyIPv4,
+				Values:          []string{"mail.example.com."},
+				TTLs:            []uint32{3600},
+				ApexCNAME:       "lb.example.net.",
+				SignatureError:  errors.New("no RRSIG"),
+				DNSSECStatus:    DNSSECBogus,
+				DNSSECError:     errors.New("RRSIG doesn't verify"),
+				NSTTLError:      errors.New("NS TTL 60 below 3600"),
+				TXTSizeWarnings: []string{"record over 255 bytes"},
+			},
+		},
+	}
+
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("json.Marshal() error: %v", err)
+	}
+	var got CheckResult
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() error: %v", err)
+	}
+
+	// Errors don't compare equal by value, so compare their messages and
+	// then the rest without them.
+	for i := range want.Servers {
+		w, g := &want.Servers[i], &got.Servers[i]
+		errs := []struct {
+			name      string
+			want, got *error
+		}{
+			{"Error", &w.Error, &g.Error},
+			{"SignatureError", &w.SignatureError, &g.SignatureError},
+			{"DNSSECError", &w.DNSSECError, &g.DNSSECError},
+			{"NSTTLError", &w.NSTTLError, &g.NSTTLError},
+		}
+		for _, e := range errs {
+			if errorMessage(*e.got) != errorMessage(*e.want) {
+				t.Errorf("Servers[%d].%s = %v, want %v", i, e.name, *e.got, *e.want)
+			}
+			*e.want, *e.got = nil, nil
+		}
+	}
+	if !reflect.DeepEqual(&got, want) {
+		t.Errorf("round trip = %+v, want %+v", got, *want)
+	}
+
+	if err := json.Unmarshal([]byte(`{"domain":"example.com","type":"BOGUS"}`), &got); err == nil {
+		t.Error("json.Unmarshal() with unknown type succeeded, want error")
+	}
+	if err := json.Unmarshal([]byte(`{"domain":"example.com","type":"A","match_mode":"bogus"}`), &got); err == nil {
+		t.Error("json.Unmarshal() with unknown match mode succeeded, want error")
+	}
+}
+
+func TestCheckResultUnmarshalJSONMatchMode(t *testing.T) {
+	result := &CheckResult{
+		Domain:     "example.com",
+		RecordType: TypeA,
+		Expected:   []string{"192.0.2.1"},
+		MatchMode:  MatchAbsent,
+		Servers:    []ServerResult{{Nameserver: "ns1.example.com.", Address: "192.0.2.53", Values: []string{"192.0.2.1"}}},
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("json.Marshal() error: %v", err)
+	}
+	var got CheckResult
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() error: %v", err)
+	}
+	if got.MatchMode != MatchAbsent {
+		t.Errorf("MatchMode = %v, want %v", got.MatchMode, MatchAbsent)
+	}
+	_, want := result.Match()
+	if _, reason := got.Match(); reason != want {
+		t.Errorf("Match() reason after round trip = %q, want %q", reason, want)
+	}
+}
+
+func TestCheckResultJSONErr(t *testing.T) {
+	result := &CheckResult{
+		Domain:     "example.com",
+		RecordType: TypeA,
+		Err:        errors.New("no nameservers found"),
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("json.Marshal() error: %v", err)
+	}
+	want := `{"domain":"example.com","type":"A","expected":null,"match_mode":"exact","zone":"","nameservers":null,"match":false,` +
+		`"reason":"example.com: no nameservers found","error":"no nameservers found","servers":[]}`
+	if string(data) != want {
+		t.Errorf("json.Marshal() =\n%s\nwant\n%s", data, want)
+	}
+
+	var got CheckResult
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() error: %v", err)
+	}
+	if errorMessage(got.Err) != "no nameservers found" {
+		t.Errorf("Err after round trip = %v, want %q", got.Err, "no nameservers found")
+	}
+}
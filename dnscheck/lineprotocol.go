@@ -0,0 +1,49 @@
+package dnscheck
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var lineProtocolTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// LineProtocol renders the result as InfluxDB line protocol, one
+// "dns_check" point per server tagged with domain, type, nameserver,
+// address and address family, and with other_nameservers, comma-separated,
+// for an address several nameservers share. Each point has a boolean match field, an
+// error field that is true if the server could not be queried and, for
+// servers that were queried, a latency_ms field with the response time in
+// milliseconds. All points share timestamp ts.
+func (r *CheckResult) LineProtocol(ts time.Time) string {
+	var b strings.Builder
+	for _, s := range r.Servers {
+		b.WriteString("dns_check")
+		writeTag(&b, "domain", r.Domain)
+		writeTag(&b, "type", r.RecordType.String())
+		writeTag(&b, "nameserver", s.Nameserver)
+		writeTag(&b, "other_nameservers", strings.Join(s.OtherNameservers, ","))
+		writeTag(&b, "address", s.Address)
+		if s.Address != "" {
+			writeTag(&b, "family", s.AddressFamily.String())
+		}
+		fmt.Fprintf(&b, " match=%t,error=%t", s.Match, s.Error != nil)
+		if s.Address != "" {
+			fmt.Fprintf(&b, ",latency_ms=%g", float64(s.Latency)/float64(time.Millisecond))
+		}
+		fmt.Fprintf(&b, " %d\n", ts.UnixNano())
+	}
+	return b.String()
+}
+
+// writeTag appends ",key=value" to b, escaping value. Empty values are
+// omitted since line protocol does not allow them.
+func writeTag(b *strings.Builder, key, value string) {
+	if value == "" {
+		return
+	}
+	b.WriteString(",")
+	b.WriteString(key)
+	b.WriteString("=")
+	b.WriteString(lineProtocolTagEscaper.Replace(value))
+}
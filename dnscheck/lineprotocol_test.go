@@ -0,0 +1,27 @@
+package dnscheck
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLineProtocol(t *testing.T) {
+	result := &CheckResult{
+		Domain:     "example.com",
+		RecordType: TypeTXT,
+		Servers: []ServerResult{
+			{Nameserver: "ns1.example.com.", OtherNameservers: []string{"ns4.example.com.", "ns5.example.com."}, Address: "192.0.2.53", Match: true, Latency: 12500 * time.Microsecond},
+			{Nameserver: "ns 2,x=y.", Address: "2001:db8::54", AddressFamily: FamilyIPv6, Latency: 40 * time.Millisecond},
+			{Nameserver: "ns3.example.com.", Error: errors.New("could not resolve nameserver")},
+		},
+	}
+
+	ts := time.Unix(1700000000, 0)
+	want := "dns_check,domain=example.com,type=TXT,nameserver=ns1.example.com.,other_nameservers=ns4.example.com.\\,ns5.example.com.,address=192.0.2.53,family=IPv4 match=true,error=false,latency_ms=12.5 1700000000000000000\n" +
+		`dns_check,domain=example.com,type=TXT,nameserver=ns\ 2\,x\=y.,address=2001:db8::54,family=IPv6 match=false,error=false,latency_ms=40 1700000000000000000` + "\n" +
+		"dns_check,domain=example.com,type=TXT,nameserver=ns3.example.com. match=false,error=true 1700000000000000000\n"
+	if got := result.LineProtocol(ts); got != want {
+		t.Errorf("LineProtocol() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,124 @@
+package dnscheck
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMetricsLimit is the number of domain and record type pairs a
+// Metrics keeps when Limit is zero.
+const DefaultMetricsLimit = 1000
+
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Metrics records the outcome of the latest check of each domain and record
+// type and serves it in the Prometheus text exposition format, so it can be
+// registered as a /metrics handler and scraped. Record results with
+// CheckResult.Observe. The zero value is ready to use, and a Metrics is safe
+// for concurrent use.
+type Metrics struct {
+	// Limit bounds the number of domain and record type pairs kept, since
+	// each one is a series for the scraper to store. Once it is reached,
+	// observing a new pair drops the one observed least recently. If zero,
+	// DefaultMetricsLimit is used.
+	Limit int
+
+	mu     sync.Mutex
+	latest map[metricsKey]metricsSample
+	seq    uint64 // incremented by each Observe
+}
+
+type metricsKey struct {
+	domain     string
+	recordType RecordType
+}
+
+type metricsSample struct {
+	servers, matching int
+	duration          time.Duration
+	success           bool
+	seq               uint64 // Metrics.seq when observed
+}
+
+// Observe records r in m, replacing the previous result for the same domain
+// and record type.
+func (r *CheckResult) Observe(m *Metrics) {
+	sample := metricsSample{servers: len(r.Servers), duration: r.Duration}
+	for _, s := range r.Servers {
+		if s.Match {
+			sample.matching++
+		}
+	}
+	sample.success, _ = r.Match()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.latest == nil {
+		m.latest = make(map[metricsKey]metricsSample)
+	}
+	m.seq++
+	sample.seq = m.seq
+	key := metricsKey{r.Domain, r.RecordType}
+	if _, ok := m.latest[key]; !ok && len(m.latest) >= cmp.Or(m.Limit, DefaultMetricsLimit) {
+		oldest := slices.MinFunc(slices.Collect(maps.Keys(m.latest)), func(a, b metricsKey) int {
+			return cmp.Compare(m.latest[a].seq, m.latest[b].seq)
+		})
+		delete(m.latest, oldest)
+	}
+	m.latest[key] = sample
+}
+
+// metric describes one of the gauges written by WriteTo.
+type metric struct {
+	name, help string
+	value      func(metricsSample) float64
+}
+
+var metrics = []metric{
+	{"addled_servers_total", "Number of server addresses queried by the latest check.", func(s metricsSample) float64 { return float64(s.servers) }},
+	{"addled_servers_matching", "Number of server addresses that returned the expected records in the latest check.", func(s metricsSample) float64 { return float64(s.matching) }},
+	{"addled_check_duration_seconds", "How long the latest check took.", func(s metricsSample) float64 { return s.duration.Seconds() }},
+	{"addled_check_success", "Whether every server matched in the latest check (1) or not (0).", func(s metricsSample) float64 {
+		if s.success {
+			return 1
+		}
+		return 0
+	}},
+}
+
+// WriteTo writes every gauge, labeled by domain and record type, to w in the
+// Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	keys := slices.SortedFunc(maps.Keys(m.latest), func(a, b metricsKey) int {
+		return cmp.Or(cmp.Compare(a.domain, b.domain), cmp.Compare(a.recordType.String(), b.recordType.String()))
+	})
+	samples := make([]metricsSample, len(keys))
+	for i, key := range keys {
+		samples[i] = m.latest[key]
+	}
+	m.mu.Unlock()
+
+	var b strings.Builder
+	for _, metric := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", metric.name, metric.help, metric.name)
+		for i, key := range keys {
+			fmt.Fprintf(&b, "%s{domain=\"%s\",type=\"%s\"} %g\n", metric.name, metricsLabelEscaper.Replace(key.domain), key.recordType, metric.value(samples[i]))
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics for a Prometheus scrape.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
@@ -0,0 +1,78 @@
+package dnscheck
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	var m Metrics
+	results := []*CheckResult{
+		{
+			Domain:     "example.com",
+			RecordType: TypeA,
+			Servers:    []ServerResult{{Match: true}, {Match: false}},
+			Duration:   1500 * time.Millisecond,
+		},
+		{
+			Domain:     `quote".example`,
+			RecordType: TypeTXT,
+			Servers:    []ServerResult{{Match: true}},
+			Duration:   250 * time.Millisecond,
+		},
+		{
+			Domain:     "example.com",
+			RecordType: TypeA,
+			Servers:    []ServerResult{{Match: true}, {Match: true}},
+			Duration:   time.Second,
+		},
+	}
+	for _, r := range results {
+		r.Observe(&m)
+	}
+
+	var out bytes.Buffer
+	if _, err := m.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo() error: %v", err)
+	}
+	want := `# HELP addled_servers_total Number of server addresses queried by the latest check.
+# TYPE addled_servers_total gauge
+addled_servers_total{domain="example.com",type="A"} 2
+addled_servers_total{domain="quote\".example",type="TXT"} 1
+# HELP addled_servers_matching Number of server addresses that returned the expected records in the latest check.
+# TYPE addled_servers_matching gauge
+addled_servers_matching{domain="example.com",type="A"} 2
+addled_servers_matching{domain="quote\".example",type="TXT"} 1
+# HELP addled_check_duration_seconds How long the latest check took.
+# TYPE addled_check_duration_seconds gauge
+addled_check_duration_seconds{domain="example.com",type="A"} 1
+addled_check_duration_seconds{domain="quote\".example",type="TXT"} 0.25
+# HELP addled_check_success Whether every server matched in the latest check (1) or not (0).
+# TYPE addled_check_success gauge
+addled_check_success{domain="example.com",type="A"} 1
+addled_check_success{domain="quote\".example",type="TXT"} 1
+`
+	if out.String() != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestMetricsLimit(t *testing.T) {
+	m := Metrics{Limit: 2}
+	for _, domain := range []string{"a.example", "b.example", "a.example", "c.example"} {
+		(&CheckResult{Domain: domain, RecordType: TypeA}).Observe(&m)
+	}
+
+	var out bytes.Buffer
+	if _, err := m.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo() error: %v", err)
+	}
+	// b.example was observed least recently, so c.example replaced it.
+	for domain, want := range map[string]bool{"a.example": true, "b.example": false, "c.example": true} {
+		if got := strings.Contains(out.String(), `domain="`+domain+`"`); got != want {
+			t.Errorf("WriteTo() includes %s = %v, want %v:\n%s", domain, got, want, out.String())
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package dnscheck
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// MultiCheckResult holds the results of checking several record types for
+// the same domain, one CheckResult per type.
+type MultiCheckResult struct {
+	Domain  string
+	Results []*CheckResult
+}
+
+// CheckMulti checks several record types for args.Domain, e.g. A and AAAA
+// after a migration, with expected mapping each type to its expected values.
+// Each type is checked with Check using the rest of args, one after another
+// in order of type code, sharing a Cache so the nameservers are only looked
+// up once. It returns an error, naming the type, if any check can't run.
+func CheckMulti(ctx context.Context, args CheckArgs, expected map[RecordType][]string) (*MultiCheckResult, error) {
+	return defaultChecker.CheckMulti(ctx, args, expected)
+}
+
+// CheckMulti is like the package-level CheckMulti but uses c.
+func (c *Checker) CheckMulti(ctx context.Context, args CheckArgs, expected map[RecordType][]string) (*MultiCheckResult, error) {
+	if args.Cache == nil && c.Cache == nil {
+		args.Cache = new(Cache)
+	}
+	multi := &MultiCheckResult{Domain: args.Domain}
+	for _, recordType := range slices.Sorted(maps.Keys(expected)) {
+		typeArgs := args
+		typeArgs.RecordType = recordType
+		typeArgs.Expected = expected[recordType]
+		result, err := c.Check(ctx, typeArgs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", recordType, err)
+		}
+		multi.Domain = result.Domain
+		multi.Results = append(multi.Results, result)
+	}
+	return multi, nil
+}
+
+// Match reports whether every type's check passed. On failure the reason
+// joins the Match reasons of the types that failed with "; ".
+func (r *MultiCheckResult) Match() (bool, string) {
+	var reasons []string
+	for _, result := range r.Results {
+		if ok, reason := result.Match(); !ok {
+			reasons = append(reasons, reason)
+		}
+	}
+	return len(reasons) == 0, strings.Join(reasons, "; ")
+}
+
+// ForType returns the CheckResult for recordType, or nil if that type was
+// not checked.
+func (r *MultiCheckResult) ForType(recordType RecordType) *CheckResult {
+	for _, result := range r.Results {
+		if result.RecordType == recordType {
+			return result
+		}
+	}
+	return nil
+}
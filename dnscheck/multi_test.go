@@ -0,0 +1,91 @@
+package dnscheck
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestMultiCheckResultForType(t *testing.T) {
+	a := &CheckResult{Domain: "example.com", RecordType: TypeA}
+	mx := &CheckResult{Domain: "example.com", RecordType: TypeMX}
+	multi := &MultiCheckResult{
+		Domain:  "example.com",
+		Results: []*CheckResult{a, mx},
+	}
+
+	if got := multi.ForType(TypeA); got != a {
+		t.Errorf("ForType(A) = %v, want %v", got, a)
+	}
+	if got := multi.ForType(TypeMX); got != mx {
+		t.Errorf("ForType(MX) = %v, want %v", got, mx)
+	}
+	if got := multi.ForType(TypeAAAA); got != nil {
+		t.Errorf("ForType(AAAA) for unchecked type = %v, want nil", got)
+	}
+}
+
+func TestCheckMulti(t *testing.T) {
+	answerA := reply(t, "example.com. 300 IN A 192.0.2.1")
+	answerAAAA := reply(t, "example.com. 300 IN AAAA 2001:db8::1")
+	exchanger := countingExchanger{
+		Exchanger: fakeExchanger{
+			"resolver:53": reply(t, "example.com. 300 IN NS ns1.example.com."),
+			"192.0.2.53:53": func(msg *dns.Msg) *dns.Msg {
+				if msg.Question[0].Qtype == dns.TypeAAAA {
+					return answerAAAA(msg)
+				}
+				return answerA(msg)
+			},
+		},
+		counts: make(map[string]int),
+	}
+	args := CheckArgs{
+		Domain:       "example.com",
+		Resolver:     "resolver:53",
+		Exchanger:    exchanger,
+		HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.53"}},
+	}
+
+	multi, err := CheckMulti(context.Background(), args, map[RecordType][]string{
+		TypeAAAA: {"2001:db8::1"},
+		TypeA:    {"192.0.2.1"},
+	})
+	if err != nil {
+		t.Fatalf("CheckMulti() error: %v", err)
+	}
+	if len(multi.Results) != 2 || multi.Results[0].RecordType != TypeA || multi.Results[1].RecordType != TypeAAAA {
+		t.Fatalf("CheckMulti() results = %v, want A then AAAA", multi.Results)
+	}
+	if ok, reason := multi.Match(); !ok {
+		t.Errorf("Match() = false (%s), want true", reason)
+	}
+	if n := exchanger.counts["resolver:53"]; n != 1 {
+		t.Errorf("resolver queried %d times, want 1 with the shared cache", n)
+	}
+
+	multi, err = CheckMulti(context.Background(), args, map[RecordType][]string{
+		TypeA:    {"192.0.2.1"},
+		TypeAAAA: {"2001:db8::2"},
+	})
+	if err != nil {
+		t.Fatalf("CheckMulti() error: %v", err)
+	}
+	ok, reason := multi.Match()
+	if ok || !strings.Contains(reason, "AAAA") {
+		t.Errorf("Match() = %v, %q, want false naming AAAA", ok, reason)
+	}
+	if ok, _ := multi.ForType(TypeA).Match(); !ok {
+		t.Errorf("ForType(A).Match() = false, want true")
+	}
+
+	args.RequireCAA = []string{"issue letsencrypt.org"}
+	_, err = CheckMulti(context.Background(), args, map[RecordType][]string{
+		TypeTXT: {"v=spf1 -all"},
+	})
+	if err == nil || !strings.HasPrefix(err.Error(), "TXT: invalid check") {
+		t.Errorf("CheckMulti() with RequireCAA on TXT error = %v, want an invalid check naming TXT", err)
+	}
+}
@@ -0,0 +1,70 @@
+package dnscheck
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// formatMX renders an MX record as "preference host".
+func formatMX(r *dns.MX) string {
+	return fmt.Sprintf("%d %s", r.Preference, r.Mx)
+}
+
+// normalizeMX puts an MX value into canonical form: fields separated by
+// single spaces, with the host normalized like other hostnames.
+func normalizeMX(value string) string {
+	return normalizeHostFields(value)
+}
+
+// normalizeHostFields normalizes the values of record types that end in a
+// hostname, such as MX and SRV: the fields are separated by single spaces
+// and the last one is normalized like other hostnames.
+func normalizeHostFields(value string) string {
+	fields := strings.Fields(value)
+	if len(fields) > 0 {
+		fields[len(fields)-1] = normalizeValue(fields[len(fields)-1])
+	}
+	return strings.Join(fields, " ")
+}
+
+// mxHost returns the normalized host of an MX value, with or without its
+// preference.
+func mxHost(value string) string {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return ""
+	}
+	return normalizeValue(fields[len(fields)-1])
+}
+
+// mxNormalizer returns the normalizer used to compare MX values against
+// expected. Expected values are either "preference host" or, to ignore the
+// preference, just the host. If every expected value is a host, only hosts
+// are compared.
+func mxNormalizer(expected []string) func(string) string {
+	for _, v := range expected {
+		if len(strings.Fields(v)) != 1 {
+			return normalizeMX
+		}
+	}
+	return mxHost
+}
+
+// mxHosts returns values, MX values or hostnames, with any preferences
+// dropped, for CheckArgs.IgnoreMXPreference.
+func mxHosts(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	hosts := make([]string, len(values))
+	for i, v := range values {
+		fields := strings.Fields(v)
+		if len(fields) > 0 {
+			v = fields[len(fields)-1]
+		}
+		hosts[i] = v
+	}
+	return hosts
+}
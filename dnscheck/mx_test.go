@@ -0,0 +1,39 @@
+package dnscheck
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestCheckIgnoreMXPreference(t *testing.T) {
+	// The preferences changed, which only matters without
+	// IgnoreMXPreference.
+	for _, ignore := range []bool{false, true} {
+		result, err := Check(context.Background(), CheckArgs{
+			Domain:             "example.com",
+			RecordType:         TypeMX,
+			Expected:           []string{"10 mx1.example.com.", "20 mx2.example.com."},
+			IgnoreMXPreference: ignore,
+			Resolver:           "resolver:53",
+			Exchanger: fakeExchanger{
+				"resolver:53": reply(t, "example.com. 300 IN NS ns1.example.com."),
+				"192.0.2.53:53": reply(t,
+					"example.com. 300 IN MX 20 mx1.example.com.",
+					"example.com. 300 IN MX 10 mx2.example.com.",
+				),
+			},
+			HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.53"}},
+		})
+		if err != nil {
+			t.Fatalf("IgnoreMXPreference=%v: Check() error: %v", ignore, err)
+		}
+		s := result.Servers[0]
+		if s.Match != ignore {
+			t.Errorf("IgnoreMXPreference=%v: Match = %v with values %q", ignore, s.Match, s.Values)
+		}
+		if ignore && !slices.Equal(s.Values, []string{"mx1.example.com.", "mx2.example.com."}) {
+			t.Errorf("IgnoreMXPreference: Values = %q, want only the hosts", s.Values)
+		}
+	}
+}
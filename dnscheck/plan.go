@@ -0,0 +1,98 @@
+package dnscheck
+
+import (
+	"context"
+	"time"
+)
+
+// CheckPlan describes what a check would query: the nameservers found for
+// the domain and the addresses they resolved to.
+type CheckPlan struct {
+	Domain      string
+	Zone        string
+	Nameservers []string
+
+	// DuplicateNameservers is the number of repeated nameservers that were
+	// dropped from Nameservers during discovery.
+	DuplicateNameservers int
+
+	// Servers holds one entry per address that would be queried, in the
+	// order Check would report them, plus one for each nameserver that
+	// could not be resolved.
+	Servers []PlannedServer
+
+	// SampledFrom is the number of addresses there were before MaxServers
+	// reduced them to Servers, or 0 if none were dropped.
+	SampledFrom int
+
+	// Duration is how long discovery and resolution took.
+	Duration time.Duration
+}
+
+// PlannedServer is an address a check would query, or the error resolving
+// a nameserver to one.
+type PlannedServer struct {
+	Nameserver string
+	Address    string
+
+	// OtherNameservers are the other nameservers that share Address and
+	// would not be queried separately.
+	OtherNameservers []string
+
+	Err error
+}
+
+// Plan runs the nameserver discovery and resolution steps of Check for args
+// and returns the servers Check would query, without sending them any
+// record queries. Expected values are ignored, so ExpectedFromName and
+// ExpectedFromPrimary are not looked up, and neither are DS records for
+// ValidateDNSSEC. Like Check, it returns an error if args is invalid or the
+// nameservers can't be found; nameservers that can't be resolved are
+// reported in CheckPlan.Servers.
+func Plan(ctx context.Context, args CheckArgs) (*CheckPlan, error) {
+	return defaultChecker.Plan(ctx, args)
+}
+
+// Plan is like the package-level Plan but takes any fields args leaves
+// unset from c, as Check does.
+func (c *Checker) Plan(ctx context.Context, args CheckArgs) (*CheckPlan, error) {
+	args = c.withDefaults(args)
+	if err := args.Validate(); err != nil {
+		return nil, err
+	}
+	args.Domain, _ = NormalizeDomain(args.Domain)
+	start := time.Now()
+	log := args.logger()
+
+	if args.OnTrace != nil {
+		tr := &tracer{onStep: args.OnTrace}
+		args.Exchanger = traceExchanger{args.baseExchanger(), tr}
+		args.HostResolver = traceHosts{args.hostResolver(), tr}
+	}
+	rex := args.Cache.exchanger(args.exchanger())
+
+	d, err := args.delegation(ctx, rex, args.resolver(), log)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("found nameservers", "zone", d.zone, "nameservers", d.nameservers)
+
+	plan := &CheckPlan{
+		Domain:               args.Domain,
+		Zone:                 d.zone,
+		Nameservers:          d.nameservers,
+		DuplicateNameservers: d.duplicates,
+	}
+	targets, sampledFrom := args.targets(ctx, args.hostResolver(), d, log)
+	plan.SampledFrom = sampledFrom
+	for _, target := range targets {
+		plan.Servers = append(plan.Servers, PlannedServer{
+			Nameserver:       target.nameserver,
+			Address:          target.address,
+			OtherNameservers: target.others,
+			Err:              target.err,
+		})
+	}
+	plan.Duration = time.Since(start)
+	return plan, nil
+}
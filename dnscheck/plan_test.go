@@ -0,0 +1,55 @@
+package dnscheck
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	exchanger := &countingExchanger{
+		Exchanger: fakeExchanger{
+			"resolver:53": reply(t,
+				"example.com. 300 IN NS ns1.example.com.",
+				"example.com. 300 IN NS ns2.example.com.",
+				"example.com. 300 IN NS ns3.example.com.",
+			),
+		},
+		counts: make(map[string]int),
+	}
+	plan, err := Plan(context.Background(), CheckArgs{
+		Domain:     "www.example.com",
+		RecordType: TypeA,
+		Expected:   []string{"192.0.2.1"},
+		Resolver:   "resolver:53",
+		Exchanger:  exchanger,
+		HostResolver: fakeHosts{
+			"ns1.example.com.": {"192.0.2.53"},
+			"ns2.example.com.": {"192.0.2.53", "192.0.2.54"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Plan() error: %v", err)
+	}
+	if plan.Zone != "example.com." || len(plan.Nameservers) != 3 {
+		t.Errorf("zone = %q, nameservers %v; want example.com. with 3 nameservers", plan.Zone, plan.Nameservers)
+	}
+	for address, n := range exchanger.counts {
+		if address != "resolver:53" {
+			t.Errorf("queried %s %d times; want only the resolver queried", address, n)
+		}
+	}
+
+	if len(plan.Servers) != 3 {
+		t.Fatalf("Servers = %+v, want 3", plan.Servers)
+	}
+	if s := plan.Servers[0]; s.Address != "192.0.2.53" || !slices.Equal(s.OtherNameservers, []string{"ns2.example.com."}) {
+		t.Errorf("Servers[0] = %+v, want 192.0.2.53 shared with ns2", s)
+	}
+	if s := plan.Servers[1]; s.Nameserver != "ns2.example.com." || s.Address != "192.0.2.54" {
+		t.Errorf("Servers[1] = %+v, want ns2 at 192.0.2.54", s)
+	}
+	if s := plan.Servers[2]; s.Nameserver != "ns3.example.com." || s.Err == nil {
+		t.Errorf("Servers[2] = %+v, want ns3 with a resolution error", s)
+	}
+}
@@ -0,0 +1,86 @@
+package dnscheck
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// RateLimiter spaces out DNS queries so that no more than a fixed number are
+// sent per second. One RateLimiter can be shared by any number of checks,
+// e.g. in CheckBatch, to throttle all of their queries together, which keeps
+// a sweep of many domains hosted by the same provider under its rate
+// limits. A nil *RateLimiter doesn't limit anything.
+type RateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRateLimiter returns a RateLimiter that allows qps queries per second,
+// evenly spaced. A qps of zero or less returns nil, which doesn't limit.
+func NewRateLimiter(qps float64) *RateLimiter {
+	if qps <= 0 {
+		return nil
+	}
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / qps)}
+}
+
+// Wait blocks until the next query may be sent, or returns ctx's error if
+// ctx is done first. A Wait that gives up hands its slot back unless a later
+// one was reserved after it, so canceled queries don't hold up the rest.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := now
+	if l.next.After(now) {
+		at = l.next
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.release(at)
+		return ctx.Err()
+	}
+}
+
+// release gives back the slot reserved at at if it's still the last one.
+func (l *RateLimiter) release(at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.next.Equal(at.Add(l.interval)) {
+		l.next = at
+	}
+}
+
+// rateLimitExchanger waits for its RateLimiter before each query.
+type rateLimitExchanger struct {
+	Exchanger
+	limiter *RateLimiter
+}
+
+func (r rateLimitExchanger) Exchange(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+	if err := r.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return r.Exchanger.Exchange(ctx, msg, address)
+}
@@ -0,0 +1,89 @@
+package dnscheck
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestCheckRateLimit(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	answer := reply(t, "example.com. 300 IN A 192.0.2.1")
+	var mu sync.Mutex
+	var sent []time.Time
+	exchanger := exchangerFunc(func(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+		mu.Lock()
+		sent = append(sent, time.Now())
+		mu.Unlock()
+		return answer(msg), nil
+	})
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:      "example.com",
+		RecordType:  TypeA,
+		Expected:    []string{"192.0.2.1"},
+		Nameservers: []string{"192.0.2.53", "192.0.2.54", "192.0.2.55", "192.0.2.56", "192.0.2.57"},
+		Concurrency: 5,
+		Exchanger:   exchanger,
+		RateLimiter: NewRateLimiter(float64(time.Second / interval)),
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if ok, reason := result.Match(); !ok {
+		t.Fatalf("Match() = false: %s", reason)
+	}
+
+	slices.SortFunc(sent, time.Time.Compare)
+	if len(sent) != 5 {
+		t.Fatalf("sent %d queries, want 5", len(sent))
+	}
+	for i := 1; i < len(sent); i++ {
+		// Allow for timer jitter, but not for queries sent together.
+		if gap := sent[i].Sub(sent[i-1]); gap < interval*3/4 {
+			t.Errorf("query %d sent %s after the previous one, want at least %s", i, gap, interval)
+		}
+	}
+}
+
+func TestRateLimiterCanceled(t *testing.T) {
+	const interval = 200 * time.Millisecond
+	limiter := NewRateLimiter(float64(time.Second / interval))
+	start := time.Now()
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("first Wait() error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > interval/2 {
+		t.Errorf("Wait() returned after %s, want it to stop at the deadline", elapsed)
+	}
+
+	// The canceled Wait's slot is free again, so the next one only waits
+	// out the first.
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("third Wait() error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > interval*3/2 {
+		t.Errorf("third Wait() returned after %s, want about %s", elapsed, interval)
+	}
+}
+
+func TestNewRateLimiterUnlimited(t *testing.T) {
+	limiter := NewRateLimiter(0)
+	if limiter != nil {
+		t.Fatalf("NewRateLimiter(0) = %+v, want nil", limiter)
+	}
+	for range 100 {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait() error: %v", err)
+		}
+	}
+}
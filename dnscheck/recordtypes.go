@@ -0,0 +1,50 @@
+package dnscheck
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// recordTypeInfo describes a supported record type.
+type recordTypeInfo struct {
+	name string
+	// value extracts the string compared against expected values from a
+	// record of this type.
+	value func(dns.RR) string
+}
+
+// recordTypes holds every record type that can be checked. Adding a type
+// here makes it available to ParseRecordType and answer comparison.
+var recordTypes = map[RecordType]recordTypeInfo{
+	TypeA:     {"A", func(rr dns.RR) string { return rr.(*dns.A).A.String() }},
+	TypeAAAA:  {"AAAA", func(rr dns.RR) string { return rr.(*dns.AAAA).AAAA.String() }},
+	TypeCNAME: {"CNAME", host(func(r *dns.CNAME) string { return r.Target })},
+	TypeTXT:   {"TXT", func(rr dns.RR) string { return strings.Join(rr.(*dns.TXT).Txt, "") }},
+	TypeMX:    {"MX", func(rr dns.RR) string { return formatMX(rr.(*dns.MX)) }},
+	TypeNS:    {"NS", host(func(r *dns.NS) string { return r.Ns })},
+	TypeSOA:   {"SOA", func(rr dns.RR) string { return formatSOA(rr.(*dns.SOA)) }},
+	TypePTR:   {"PTR", host(func(r *dns.PTR) string { return r.Ptr })},
+	TypeSRV:   {"SRV", func(rr dns.RR) string { return formatSRV(rr.(*dns.SRV)) }},
+	TypeCAA: {"CAA", func(rr dns.RR) string {
+		r := rr.(*dns.CAA)
+		return formatCAA(r.Flag, r.Tag, r.Value)
+	}},
+	TypeTLSA:   {"TLSA", func(rr dns.RR) string { return formatTLSA(rr.(*dns.TLSA)) }},
+	TypeDS:     {"DS", func(rr dns.RR) string { return formatDS(rr.(*dns.DS)) }},
+	TypeDNSKEY: {"DNSKEY", func(rr dns.RR) string { return formatDNSKEY(rr.(*dns.DNSKEY)) }},
+
+	// Legacy types whose value is a hostname plus a preference or subtype.
+	// Only the hostname is kept, so the other field isn't compared.
+	TypeAFSDB: {"AFSDB", host(func(r *dns.AFSDB) string { return r.Hostname })},
+	TypeRT:    {"RT", host(func(r *dns.RT) string { return r.Host })},
+}
+
+// host returns a value extractor for record type T that returns the
+// hostname selected by field. Hostnames are compared FQDN-aware and
+// case-insensitively by normalizeValue.
+func host[T dns.RR](field func(T) string) func(dns.RR) string {
+	return func(rr dns.RR) string {
+		return field(rr.(T))
+	}
+}
@@ -0,0 +1,29 @@
+package dnscheck
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestHostRecordTypes(t *testing.T) {
+	tests := []struct {
+		rt       RecordType
+		record   string
+		expected []string
+	}{
+		{TypeMX, "example.com. 300 IN MX 10 Mail.Example.com.", []string{"mail.example.com"}},
+		{TypeNS, "example.com. 300 IN NS ns1.example.com.", []string{"NS1.example.com"}},
+		{TypePTR, "25.2.0.192.in-addr.arpa. 300 IN PTR mail.example.com.", []string{"mail.example.com"}},
+		{TypeAFSDB, "example.com. 300 IN AFSDB 1 afs1.example.com.", []string{"AFS1.example.com."}},
+		{TypeRT, "example.com. 300 IN RT 20 relay.example.net.", []string{"relay.example.net"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rt.String(), func(t *testing.T) {
+			values := answerValues([]dns.RR{mustRR(t, tt.record)})
+			if !valuesMatchType(tt.rt, values, tt.expected) {
+				t.Errorf("values %v don't match %v", values, tt.expected)
+			}
+		})
+	}
+}
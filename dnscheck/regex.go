@@ -0,0 +1,69 @@
+package dnscheck
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// compilePatterns compiles every expected value in args, including the
+// per-server overrides, as a regular expression that must match a whole
+// value. The result is keyed by the original pattern.
+func compilePatterns(args CheckArgs) (map[string]*regexp.Regexp, error) {
+	patterns := make(map[string]*regexp.Regexp)
+	compile := func(values []string) error {
+		for _, p := range values {
+			if _, ok := patterns[p]; ok {
+				continue
+			}
+			re, err := regexp.Compile("^(?:" + p + ")$")
+			if err != nil {
+				return fmt.Errorf("invalid expected pattern %q: %w", p, err)
+			}
+			patterns[p] = re
+		}
+		return nil
+	}
+
+	if err := compile(args.Expected); err != nil {
+		return nil, err
+	}
+	for _, values := range args.ExpectedByServer {
+		if err := compile(values); err != nil {
+			return nil, err
+		}
+	}
+	return patterns, nil
+}
+
+// regexValuesMatch reports whether got is non-empty and every value in it
+// matches at least one of patterns. If requireAll is true, every pattern
+// must also match at least one value. A trailing dot on a value is ignored,
+// so hostname patterns needn't account for it.
+func regexValuesMatch(got []string, patterns []*regexp.Regexp, requireAll bool) bool {
+	if len(got) == 0 {
+		return len(patterns) == 0
+	}
+
+	used := make([]bool, len(patterns))
+	for _, v := range got {
+		trimmed := strings.TrimSuffix(v, ".")
+		var ok bool
+		for i, re := range patterns {
+			if re.MatchString(v) || re.MatchString(trimmed) {
+				used[i], ok = true, true
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if requireAll {
+		for _, u := range used {
+			if !u {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package dnscheck
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRegexValuesMatch(t *testing.T) {
+	token := regexp.MustCompile(`^(?:google-site-verification=[A-Za-z0-9_-]+)$`)
+	spf := regexp.MustCompile(`^(?:v=spf1 .*)$`)
+	cname := regexp.MustCompile(`^(?:lb-[0-9]+\.example\.net)$`)
+
+	tests := []struct {
+		name       string
+		got        []string
+		patterns   []*regexp.Regexp
+		requireAll bool
+		want       bool
+	}{
+		{"every value matches", []string{"google-site-verification=abc123", "v=spf1 -all"}, []*regexp.Regexp{token, spf}, false, true},
+		{"unmatched value", []string{"google-site-verification=abc123", "other"}, []*regexp.Regexp{token, spf}, false, false},
+		{"unused pattern allowed", []string{"google-site-verification=abc123"}, []*regexp.Regexp{token, spf}, false, true},
+		{"unused pattern required", []string{"google-site-verification=abc123"}, []*regexp.Regexp{token, spf}, true, false},
+		{"whole value only", []string{"xgoogle-site-verification=abc123"}, []*regexp.Regexp{token}, false, false},
+		{"trailing dot ignored", []string{"lb-3.example.net."}, []*regexp.Regexp{cname}, false, true},
+		{"empty answer", nil, []*regexp.Regexp{token}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := regexValuesMatch(tt.got, tt.patterns, tt.requireAll); got != tt.want {
+				t.Errorf("regexValuesMatch(%q) = %v, want %v", tt.got, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckInvalidPattern(t *testing.T) {
+	_, err := Check(context.Background(), CheckArgs{
+		Domain:     "example.com",
+		RecordType: TypeTXT,
+		Expected:   []string{"google-site-verification=(unclosed"},
+		MatchMode:  MatchRegex,
+		Exchanger:  fakeExchanger{},
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid expected pattern") {
+		t.Errorf("Check() error = %v, want invalid pattern error", err)
+	}
+}
+
+func TestCheckRegexWithReferenceName(t *testing.T) {
+	_, err := Check(context.Background(), CheckArgs{
+		Domain:           "example.com",
+		RecordType:       TypeTXT,
+		ExpectedFromName: "reference.example.com",
+		MatchMode:        MatchRegex,
+		Exchanger:        fakeExchanger{},
+	})
+	if err == nil || !strings.Contains(err.Error(), "can't be used as patterns") {
+		t.Errorf("Check() error = %v, want an error rejecting the reference name", err)
+	}
+}
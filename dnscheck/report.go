@@ -0,0 +1,196 @@
+package dnscheck
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorReset = "\x1b[0m"
+)
+
+// Report writes a human-readable description of the result to w: the
+// Match() reason on the first line, followed by one line per server,
+// identified by nameserver, address and address family. When color is
+// true, matching servers are shown in green and failing servers and the
+// headline in red using ANSI escape codes. Nothing is written if every
+// server matched.
+func (r *CheckResult) Report(w io.Writer, color bool) {
+	matched, reason := r.Match()
+	if matched {
+		return
+	}
+	r.writeReport(w, reason, color)
+}
+
+// Summary returns the report Report writes, without color, for any result:
+// when every server matched, the first line says so, e.g. "example.com: 4 of
+// 4 servers returned the expected A records", and each server is listed as
+// ok.
+func (r *CheckResult) Summary() string {
+	matched, headline := r.Match()
+	if matched {
+		headline = fmt.Sprintf("%s: %d of %d servers returned the expected %s records", r.Domain, len(r.Servers), len(r.Servers), r.RecordType)
+	}
+	var b strings.Builder
+	r.writeReport(&b, headline, false)
+	return b.String()
+}
+
+// writeReport writes headline followed by one line per server.
+func (r *CheckResult) writeReport(w io.Writer, headline string, color bool) {
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + colorReset
+	}
+
+	fmt.Fprintln(w, paint(colorRed, headline))
+	if r.SampledFrom > 0 {
+		fmt.Fprintf(w, "sampled %d of %d servers\n", len(r.Servers), r.SampledFrom)
+	}
+	for _, s := range r.Servers {
+		status, detail := r.serverStatus(s)
+		fmt.Fprintln(w, paint(statusColor(status), s.label()+": "+detail))
+	}
+}
+
+// Server statuses, as shown by ReportTable.
+const (
+	statusMatch    = "match"
+	statusMismatch = "mismatch"
+	statusError    = "error"
+)
+
+// serverStatus returns statusMatch, statusMismatch or statusError for s,
+// with "ok" if it matched, or a description of why it didn't, e.g. "got no
+// records".
+func (r *CheckResult) serverStatus(s ServerResult) (status, detail string) {
+	switch {
+	case s.Error != nil:
+		return statusError, s.Error.Error()
+	case s.SignatureError != nil:
+		return statusMismatch, s.SignatureError.Error()
+	case s.DNSSECError != nil:
+		return statusMismatch, s.DNSSECError.Error()
+	case s.NSTTLError != nil:
+		return statusMismatch, s.NSTTLError.Error()
+	case s.Lame:
+		return statusMismatch, "not authoritative for " + r.Zone
+	case !s.Match && len(s.Values) == 0 && s.Rcode != RcodeSuccess:
+		return statusMismatch, "got " + s.Rcode.String()
+	case !s.Match && len(s.Values) == 0 && s.CNAME != "":
+		return statusMismatch, fmt.Sprintf("got a CNAME to %s and no %s records", s.CNAME, r.RecordType)
+	case !s.Match && len(s.Values) == 0:
+		return statusMismatch, "got no records"
+	case !s.Match && (len(s.Missing) > 0 || len(s.Unexpected) > 0):
+		return statusMismatch, s.diff()
+	case !s.Match:
+		return statusMismatch, "got " + strings.Join(s.Values, ", ")
+	default:
+		return statusMatch, "ok"
+	}
+}
+
+// statusColor returns the color to paint a server with status in.
+func statusColor(status string) string {
+	if status == statusMatch {
+		return colorGreen
+	}
+	return colorRed
+}
+
+// tableValueWidth is the width ReportTable truncates values to.
+const tableValueWidth = 60
+
+// ReportTable writes the result to w as a table with a row for every
+// server, whether or not it matched: its nameservers, the address queried
+// and its family, its status (match, mismatch or error) and, truncated to
+// fit, the values it returned or why it failed. A footer line follows: the
+// Match() reason, or the line Summary starts with if every server matched.
+// When color is true, matching rows are shown in green and the others in
+// red.
+func (r *CheckResult) ReportTable(w io.Writer, color bool) {
+	matched, footer := r.Match()
+	if matched {
+		footer = fmt.Sprintf("%s: %d of %d servers returned the expected %s records", r.Domain, len(r.Servers), len(r.Servers), r.RecordType)
+	}
+
+	// The rows are aligned before they're painted, since tabwriter would
+	// count the escape codes as part of the width.
+	var table strings.Builder
+	tw := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESERVER\tADDRESS\tFAMILY\tSTATUS\tVALUE")
+	statuses := make([]string, len(r.Servers))
+	for i, s := range r.Servers {
+		status, value := r.serverStatus(s)
+		if status == statusMatch {
+			value = strings.Join(s.Values, ", ")
+		}
+		statuses[i] = status
+		nameservers := strings.Join(append([]string{s.Nameserver}, s.OtherNameservers...), ", ")
+		var family string
+		if s.Address != "" {
+			family = s.AddressFamily.String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", nameservers, s.Address, family, status, truncate(value, tableValueWidth))
+	}
+	tw.Flush()
+
+	lines := strings.SplitAfter(table.String(), "\n")
+	fmt.Fprint(w, lines[0])
+	for i, status := range statuses {
+		line := strings.TrimSuffix(lines[i+1], "\n")
+		if color {
+			line = statusColor(status) + line + colorReset
+		}
+		fmt.Fprintln(w, line)
+	}
+	if r.SampledFrom > 0 {
+		fmt.Fprintf(w, "sampled %d of %d servers\n", len(r.Servers), r.SampledFrom)
+	}
+	if color && matched {
+		footer = colorGreen + footer + colorReset
+	} else if color {
+		footer = colorRed + footer + colorReset
+	}
+	fmt.Fprintln(w, footer)
+}
+
+// truncate shortens s to at most width characters, ending it with "..." if
+// anything was cut.
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-3]) + "..."
+}
+
+// label identifies s in a report as its nameservers followed by the
+// address queried, e.g. "ns1.example.com., ns2.example.com. (192.0.2.53)".
+func (s ServerResult) label() string {
+	label := strings.Join(append([]string{s.Nameserver}, s.OtherNameservers...), ", ")
+	if s.Address != "" {
+		label += " (" + s.Address + ", " + s.AddressFamily.String() + ")"
+	}
+	return label
+}
+
+// diff describes s's Missing and Unexpected values, e.g. "missing:
+// 192.0.2.1; unexpected: 192.0.2.9".
+func (s ServerResult) diff() string {
+	var parts []string
+	if len(s.Missing) > 0 {
+		parts = append(parts, "missing: "+strings.Join(s.Missing, ", "))
+	}
+	if len(s.Unexpected) > 0 {
+		parts = append(parts, "unexpected: "+strings.Join(s.Unexpected, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
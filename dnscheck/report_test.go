@@ -0,0 +1,156 @@
+package dnscheck
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	result := &CheckResult{
+		Domain:     "example.com",
+		RecordType: TypeA,
+		Expected:   []string{"192.0.2.1"},
+		Servers: []ServerResult{
+			{Nameserver: "ns1.example.com.", Address: "192.0.2.53", Values: []string{"192.0.2.1"}, Match: true},
+			{Nameserver: "ns2.example.com.", Address: "192.0.2.54", Values: []string{"192.0.2.9"}},
+			{Nameserver: "ns3.example.com.", Error: errors.New("could not resolve nameserver")},
+			{Nameserver: "ns4.example.com.", Address: "192.0.2.55", Values: []string{"192.0.2.9"}, Missing: []string{"192.0.2.1"}, Unexpected: []string{"192.0.2.9"}},
+		},
+	}
+
+	var plain bytes.Buffer
+	result.Report(&plain, false)
+	want := strings.Join([]string{
+		"example.com: 3 of 4 servers returned unexpected A records",
+		"ns1.example.com. (192.0.2.53, IPv4): ok",
+		"ns2.example.com. (192.0.2.54, IPv4): got 192.0.2.9",
+		"ns3.example.com.: could not resolve nameserver",
+		"ns4.example.com. (192.0.2.55, IPv4): missing: 192.0.2.1; unexpected: 192.0.2.9",
+		"",
+	}, "\n")
+	if plain.String() != want {
+		t.Errorf("Report(color=false) =\n%s\nwant\n%s", plain.String(), want)
+	}
+
+	var colored bytes.Buffer
+	result.Report(&colored, true)
+	if !strings.Contains(colored.String(), colorGreen+"ns1.example.com. (192.0.2.53, IPv4): ok"+colorReset) {
+		t.Errorf("Report(color=true) missing green matching server: %q", colored.String())
+	}
+	if !strings.Contains(colored.String(), colorRed+"ns2.example.com. (192.0.2.54, IPv4): got 192.0.2.9"+colorReset) {
+		t.Errorf("Report(color=true) missing red failing server: %q", colored.String())
+	}
+}
+
+func TestReportTable(t *testing.T) {
+	result := &CheckResult{
+		Domain:     "example.com",
+		RecordType: TypeTXT,
+		Expected:   []string{"v=spf1 -all"},
+		Servers: []ServerResult{
+			{Nameserver: "ns1.example.com.", Address: "192.0.2.53", Values: []string{"v=spf1 -all"}, Match: true},
+			{Nameserver: "ns2.example.com.", Address: "192.0.2.54", Values: []string{strings.Repeat("x", 80)}},
+			{Nameserver: "ns3.example.com.", Error: errors.New("could not resolve nameserver")},
+		},
+	}
+
+	var plain bytes.Buffer
+	result.ReportTable(&plain, false)
+	want := strings.Join([]string{
+		"NAMESERVER        ADDRESS     FAMILY  STATUS    VALUE",
+		"ns1.example.com.  192.0.2.53  IPv4    match     v=spf1 -all",
+		"ns2.example.com.  192.0.2.54  IPv4    mismatch  got " + strings.Repeat("x", 53) + "...",
+		"ns3.example.com.                      error     could not resolve nameserver",
+		"example.com: 2 of 3 servers returned unexpected TXT records",
+		"",
+	}, "\n")
+	if plain.String() != want {
+		t.Errorf("ReportTable(color=false) =\n%s\nwant\n%s", plain.String(), want)
+	}
+
+	var colored bytes.Buffer
+	result.ReportTable(&colored, true)
+	if !strings.Contains(colored.String(), colorGreen+"ns1.example.com.  192.0.2.53  IPv4    match     v=spf1 -all"+colorReset) {
+		t.Errorf("ReportTable(color=true) missing green matching row: %q", colored.String())
+	}
+
+	result.Servers = result.Servers[:1]
+	plain.Reset()
+	result.ReportTable(&plain, false)
+	if !strings.HasSuffix(plain.String(), "example.com: 1 of 1 servers returned the expected TXT records\n") {
+		t.Errorf("ReportTable() for a match = %q, want the success footer", plain.String())
+	}
+}
+
+func TestReportEmptyAnswers(t *testing.T) {
+	result := &CheckResult{
+		Domain:     "www.example.com",
+		RecordType: TypeA,
+		Expected:   []string{"192.0.2.1"},
+		Servers: []ServerResult{
+			{Nameserver: "ns1.example.com.", Address: "192.0.2.53", Rcode: RcodeNXDomain},
+			{Nameserver: "ns2.example.com.", Address: "192.0.2.54", Rcode: RcodeServFail},
+			{Nameserver: "ns3.example.com.", Address: "192.0.2.55", Rcode: RcodeNXDomain},
+			{Nameserver: "ns4.example.com.", Address: "192.0.2.56"},
+		},
+	}
+
+	var out bytes.Buffer
+	result.Report(&out, false)
+	want := strings.Join([]string{
+		"www.example.com: 4 of 4 servers returned unexpected A records (1 returned no records, 1 returned SERVFAIL, 2 returned NXDOMAIN)",
+		"ns1.example.com. (192.0.2.53, IPv4): got NXDOMAIN",
+		"ns2.example.com. (192.0.2.54, IPv4): got SERVFAIL",
+		"ns3.example.com. (192.0.2.55, IPv4): got NXDOMAIN",
+		"ns4.example.com. (192.0.2.56, IPv4): got no records",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("Report() =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	if groups := result.Groups(); len(groups) != 3 || groups[0].Rcode != RcodeNXDomain {
+		t.Errorf("Groups() = %+v, want NXDOMAIN, SERVFAIL and NOERROR groups", groups)
+	}
+}
+
+func TestReportMatchedWritesNothing(t *testing.T) {
+	result := &CheckResult{
+		Domain:  "example.com",
+		Servers: []ServerResult{{Nameserver: "ns1.example.com.", Match: true}},
+	}
+	var buf bytes.Buffer
+	result.Report(&buf, true)
+	if buf.Len() != 0 {
+		t.Errorf("Report() for matching result wrote %q, want nothing", buf.String())
+	}
+}
+
+func TestSummary(t *testing.T) {
+	result := &CheckResult{
+		Domain:     "example.com",
+		RecordType: TypeA,
+		Servers: []ServerResult{
+			{Nameserver: "ns1.example.com.", Address: "192.0.2.53", Values: []string{"192.0.2.1"}, Match: true},
+			{Nameserver: "ns2.example.com.", Address: "192.0.2.54", Values: []string{"192.0.2.1"}, Match: true},
+		},
+	}
+	want := strings.Join([]string{
+		"example.com: 2 of 2 servers returned the expected A records",
+		"ns1.example.com. (192.0.2.53, IPv4): ok",
+		"ns2.example.com. (192.0.2.54, IPv4): ok",
+		"",
+	}, "\n")
+	if got := result.Summary(); got != want {
+		t.Errorf("Summary() =\n%s\nwant\n%s", got, want)
+	}
+
+	result.Servers[1] = ServerResult{Nameserver: "ns2.example.com.", Address: "192.0.2.54", Values: []string{"192.0.2.9"}}
+	var report bytes.Buffer
+	result.Report(&report, false)
+	if got := result.Summary(); got != report.String() {
+		t.Errorf("Summary() =\n%s\nwant the same as Report():\n%s", got, report.String())
+	}
+}
@@ -0,0 +1,173 @@
+package dnscheck
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/miekg/dns"
+)
+
+// CacheState describes whether a recursive resolver's answer came from its
+// cache or was freshly fetched from the authoritative servers.
+type CacheState int
+
+const (
+	// CacheUnknown means the state could not be inferred, e.g. because the
+	// authoritative TTL was unavailable or the resolver returned no records.
+	CacheUnknown CacheState = iota
+	// CacheFresh means the resolver returned the full authoritative TTL.
+	CacheFresh
+	// CacheCached means the resolver returned a TTL lower than the
+	// authoritative TTL, so the answer is counting down in its cache.
+	CacheCached
+)
+
+func (c CacheState) String() string {
+	switch c {
+	case CacheFresh:
+		return "fresh"
+	case CacheCached:
+		return "cached"
+	default:
+		return "unknown"
+	}
+}
+
+// ResolverResult holds the answer a recursive resolver returned for a
+// record, along with its observed TTL and the inferred cache state.
+type ResolverResult struct {
+	Resolver         string
+	Values           []string
+	TTL              uint32 // lowest TTL in the resolver's answer
+	AuthoritativeTTL uint32 // TTL served by the authoritative servers
+	Cache            CacheState
+	Match            bool
+	Error            error
+}
+
+// CheckResolvers queries each recursive resolver for args.Domain and
+// args.RecordType and compares its answer against args.Expected. It also
+// fetches the record's TTL from one of the zone's authoritative servers so
+// that each resolver's TTL can be used to infer whether it is serving a
+// cached answer. This distinguishes "the resolver still has the old value
+// cached" from "the authoritative servers haven't updated". Answers are
+// filtered and compared as Check would, following MatchMode, TXTPrefix,
+// SplitTXTStrings and IgnoreMXPreference.
+func CheckResolvers(ctx context.Context, args CheckArgs, resolvers []string) ([]ResolverResult, error) {
+	log := args.logger()
+
+	if args.IgnoreMXPreference {
+		args.Expected = mxHosts(args.Expected)
+	}
+
+	var patterns []*regexp.Regexp
+	if args.MatchMode == MatchRegex {
+		compiled, err := compilePatterns(args)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range args.Expected {
+			patterns = append(patterns, compiled[p])
+		}
+	}
+
+	resolver := args.resolver()
+
+	ex := args.exchanger()
+
+	authTTL, err := authoritativeTTL(ctx, ex, args.hostResolver(), args.AddressFamily, args.Domain, args.port(), args.RecordType, resolver)
+	if err != nil {
+		log.Warn("could not determine authoritative TTL", "domain", args.Domain, "error", err)
+	}
+
+	var results []ResolverResult
+	for _, r := range resolvers {
+		msg := new(dns.Msg)
+		msg.SetQuestion(dns.Fqdn(args.Domain), uint16(args.RecordType))
+		msg.RecursionDesired = true
+
+		log.Info("querying resolver", "resolver", r, "type", args.RecordType)
+		response, err := ex.Exchange(ctx, msg, r)
+		if err != nil {
+			log.Warn("resolver query failed", "resolver", r, "error", err)
+			results = append(results, ResolverResult{
+				Resolver: r,
+				Error:    &QueryError{Address: r, Err: err},
+			})
+			continue
+		}
+
+		records := filterType(response.Answer, args.RecordType)
+		values, _ := args.values(records)
+		ttl, ok := minTTL(records)
+		match := valuesMatchMode(args.MatchMode, args.RecordType, values, args.Expected)
+		if args.MatchMode == MatchRegex {
+			match = regexValuesMatch(values, patterns, args.RequireEveryPattern)
+		}
+		result := ResolverResult{
+			Resolver:         r,
+			Values:           values,
+			TTL:              ttl,
+			AuthoritativeTTL: authTTL,
+			Match:            match,
+		}
+		if ok {
+			result.Cache = inferCacheState(ttl, authTTL)
+		}
+		log.Info("resolver result", "resolver", r, "values", values, "ttl", ttl, "cache", result.Cache, "match", result.Match)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// authoritativeTTL returns the TTL of the record as served by the first
+// authoritative server that answers with records of recordType.
+func authoritativeTTL(ctx context.Context, ex Exchanger, hosts HostResolver, family AddressFamily, domain, port string, recordType RecordType, resolver string) (uint32, error) {
+	d, err := findZone(ctx, ex, domain, resolver)
+	if err != nil {
+		return 0, err
+	}
+	for _, ns := range d.nameservers {
+		addresses, err := resolveNameserver(ctx, hosts, ns, family)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addresses {
+			response, err := queryServer(ctx, ex, addr, port, domain, recordType, false)
+			if err != nil {
+				continue
+			}
+			if ttl, ok := minTTL(filterType(response.Answer, recordType)); ok {
+				return ttl, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no authoritative server returned %s records for %s", recordType, domain)
+}
+
+// minTTL returns the lowest TTL among records, and false if there are none.
+func minTTL(records []dns.RR) (uint32, bool) {
+	if len(records) == 0 {
+		return 0, false
+	}
+	ttl := records[0].Header().Ttl
+	for _, record := range records[1:] {
+		ttl = min(ttl, record.Header().Ttl)
+	}
+	return ttl, true
+}
+
+// inferCacheState compares a resolver's TTL against the authoritative TTL.
+// A resolver serving a cached answer returns a TTL that counts down from
+// the authoritative value, so anything lower indicates a cache hit.
+func inferCacheState(ttl, authoritativeTTL uint32) CacheState {
+	switch {
+	case authoritativeTTL == 0:
+		return CacheUnknown
+	case ttl < authoritativeTTL:
+		return CacheCached
+	default:
+		return CacheFresh
+	}
+}
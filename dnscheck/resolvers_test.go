@@ -0,0 +1,83 @@
+package dnscheck
+
+import (
+	"context"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCheckResolversMatching(t *testing.T) {
+	txt := reply(t,
+		`example.com. 300 IN TXT "v=spf1 -all"`,
+		`example.com. 300 IN TXT "google-site-verification=abc123"`,
+	)
+	exchanger := fakeExchanger{
+		"resolver:53":   reply(t, "example.com. 300 IN NS ns1.example.com."),
+		"192.0.2.53:53": txt,
+		"192.0.2.1:53":  txt,
+	}
+	hosts := fakeHosts{"ns1.example.com.": {"192.0.2.53"}}
+
+	tests := []struct {
+		name string
+		args CheckArgs
+		want bool
+	}{
+		{"exact", CheckArgs{Expected: []string{"v=spf1 -all"}}, false},
+		{"subset", CheckArgs{Expected: []string{"v=spf1 -all"}, MatchMode: MatchSubset}, true},
+		{"regex", CheckArgs{Expected: []string{"v=spf1 .*", "google-.*"}, MatchMode: MatchRegex}, true},
+		{"regex, unmatched value", CheckArgs{Expected: []string{"v=spf1 .*"}, MatchMode: MatchRegex}, false},
+		{"TXT prefix", CheckArgs{Expected: []string{"v=spf1 -all"}, TXTPrefix: "v=spf1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			args.Domain, args.RecordType = "example.com", TypeTXT
+			args.Resolver, args.Exchanger, args.HostResolver = "resolver:53", exchanger, hosts
+			results, err := CheckResolvers(context.Background(), args, []string{"192.0.2.1:53"})
+			if err != nil {
+				t.Fatalf("CheckResolvers() error: %v", err)
+			}
+			if len(results) != 1 || results[0].Match != tt.want {
+				t.Errorf("CheckResolvers() = %+v, want Match %v", results, tt.want)
+			}
+		})
+	}
+}
+
+func TestInferCacheState(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     uint32
+		authTTL uint32
+		want    CacheState
+	}{
+		{"full TTL is fresh", 300, 300, CacheFresh},
+		{"decreased TTL is cached", 120, 300, CacheCached},
+		{"resolver caps TTL above authoritative", 600, 300, CacheFresh},
+		{"unknown authoritative TTL", 120, 0, CacheUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inferCacheState(tt.ttl, tt.authTTL); got != tt.want {
+				t.Errorf("inferCacheState(%d, %d) = %v, want %v", tt.ttl, tt.authTTL, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinTTL(t *testing.T) {
+	if _, ok := minTTL(nil); ok {
+		t.Error("minTTL(nil) ok = true, want false")
+	}
+
+	records := []dns.RR{
+		mustRR(t, "example.com. 300 IN A 192.0.2.1"),
+		mustRR(t, "example.com. 120 IN A 192.0.2.2"),
+	}
+	if ttl, ok := minTTL(records); !ok || ttl != 120 {
+		t.Errorf("minTTL() = %d, %v, want 120, true", ttl, ok)
+	}
+}
@@ -0,0 +1,73 @@
+package dnscheck
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// formatSOA renders an SOA record as
+// "ns mbox serial refresh retry expire minttl".
+func formatSOA(r *dns.SOA) string {
+	return fmt.Sprintf("%s %s %d %d %d %d %d", r.Ns, r.Mbox, r.Serial, r.Refresh, r.Retry, r.Expire, r.Minttl)
+}
+
+// soaSerial returns the serial field of an SOA value produced by formatSOA.
+func soaSerial(value string) (uint32, bool) {
+	fields := strings.Fields(value)
+	if len(fields) != 7 {
+		return 0, false
+	}
+	serial, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(serial), true
+}
+
+// SOASerial returns the serial of the SOA record the server returned, for a
+// check of TypeSOA. It returns false if the server didn't return exactly one
+// SOA record.
+func (s ServerResult) SOASerial() (uint32, bool) {
+	if len(s.Values) != 1 {
+		return 0, false
+	}
+	return soaSerial(s.Values[0])
+}
+
+// normalizeSOA normalizes each field of an SOA value, so that the MNAME and
+// RNAME hostnames compare FQDN-aware and case-insensitively.
+func normalizeSOA(value string) string {
+	fields := strings.Fields(value)
+	for i, f := range fields {
+		fields[i] = normalizeValue(f)
+	}
+	return strings.Join(fields, " ")
+}
+
+// isSerial reports whether value is a bare SOA serial number rather than a
+// full SOA value.
+func isSerial(value string) bool {
+	_, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+	return err == nil
+}
+
+// soaNormalizer returns the normalizer used to compare SOA values against
+// expected. If every expected value is a bare serial number, only serials
+// are compared. This lets a check confirm that every server has loaded the
+// same zone version without spelling out the whole record.
+func soaNormalizer(expected []string) func(string) string {
+	for _, v := range expected {
+		if !isSerial(v) {
+			return normalizeSOA
+		}
+	}
+	return func(value string) string {
+		if serial, ok := soaSerial(value); ok {
+			return strconv.FormatUint(uint64(serial), 10)
+		}
+		return strings.TrimSpace(value)
+	}
+}
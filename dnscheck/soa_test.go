@@ -0,0 +1,38 @@
+package dnscheck
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSOAValues(t *testing.T) {
+	answer := []dns.RR{mustRR(t, "example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 2024010101 7200 3600 1209600 300")}
+	values := answerValues(answer)
+	want := "ns1.example.com. hostmaster.example.com. 2024010101 7200 3600 1209600 300"
+	if len(values) != 1 || values[0] != want {
+		t.Fatalf("answerValues() = %q, want [%q]", values, want)
+	}
+
+	if serial, ok := (ServerResult{Values: values}).SOASerial(); !ok || serial != 2024010101 {
+		t.Errorf("SOASerial() = %d, %v, want 2024010101, true", serial, ok)
+	}
+
+	tests := []struct {
+		name     string
+		expected []string
+		want     bool
+	}{
+		{"serial", []string{"2024010101"}, true},
+		{"old serial", []string{"2024010100"}, false},
+		{"full record", []string{"NS1.example.com hostmaster.example.com 2024010101 7200 3600 1209600 300"}, true},
+		{"full record, different refresh", []string{"ns1.example.com. hostmaster.example.com. 2024010101 3600 3600 1209600 300"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := valuesMatchType(TypeSOA, values, tt.expected); got != tt.want {
+				t.Errorf("valuesMatchType(SOA, %q) = %v, want %v", tt.expected, got, tt.want)
+			}
+		})
+	}
+}
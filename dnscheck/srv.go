@@ -0,0 +1,41 @@
+package dnscheck
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// formatSRV renders an SRV record as "priority weight port target".
+func formatSRV(r *dns.SRV) string {
+	return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, r.Target)
+}
+
+// normalizeSRV puts an SRV value into canonical form: fields separated by
+// single spaces, with the target normalized like other hostnames.
+func normalizeSRV(value string) string {
+	return normalizeHostFields(value)
+}
+
+// srvEndpoint returns the "port target" part of a normalized SRV value.
+func srvEndpoint(value string) string {
+	fields := strings.Fields(normalizeSRV(value))
+	if len(fields) < 2 {
+		return strings.Join(fields, " ")
+	}
+	return strings.Join(fields[len(fields)-2:], " ")
+}
+
+// srvNormalizer returns the normalizer used to compare SRV values against
+// expected. Expected values are either full "priority weight port target"
+// values or, to ignore priority and weight, "port target" pairs. If every
+// expected value is a pair, only ports and targets are compared.
+func srvNormalizer(expected []string) func(string) string {
+	for _, v := range expected {
+		if len(strings.Fields(v)) != 2 {
+			return normalizeSRV
+		}
+	}
+	return srvEndpoint
+}
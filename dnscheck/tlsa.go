@@ -0,0 +1,39 @@
+package dnscheck
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// formatTLSA renders a TLSA record as
+// "usage selector matching-type cert-association-hex".
+func formatTLSA(r *dns.TLSA) string {
+	return fmt.Sprintf("%d %d %d %s", r.Usage, r.Selector, r.MatchingType, strings.ToLower(r.Certificate))
+}
+
+// normalizeTLSA puts a TLSA value into canonical form: the three numeric
+// fields separated by single spaces, followed by the certificate
+// association data lowercased and with any spaces within it removed, as
+// zone files may split long hex strings.
+func normalizeTLSA(value string) string {
+	return normalizeKeyData(value, true)
+}
+
+// normalizeKeyData normalizes the values of record types laid out as three
+// numeric fields followed by key or digest data, such as TLSA, DS and
+// DNSKEY: the numeric fields are separated by single spaces and any spaces
+// within the data are removed. The data is lowercased if lower is set,
+// which suits hex but not base64.
+func normalizeKeyData(value string, lower bool) string {
+	fields := strings.Fields(value)
+	if len(fields) <= 3 {
+		return strings.Join(fields, " ")
+	}
+	data := strings.Join(fields[3:], "")
+	if lower {
+		data = strings.ToLower(data)
+	}
+	return strings.Join(fields[:3], " ") + " " + data
+}
@@ -0,0 +1,148 @@
+package dnscheck
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// TraceStep is one DNS query sent, or one nameserver hostname looked up,
+// during a Check with CheckArgs.Trace or CheckArgs.OnTrace set.
+type TraceStep struct {
+	Time     time.Time     // when the query was sent
+	Duration time.Duration // how long it took to answer or fail
+	Server   string        // address queried; empty for a hostname lookup
+	Name     string        // name queried or hostname looked up
+	Type     string        // type queried, e.g. "NS"; empty for a hostname lookup
+	Rcode    Rcode
+
+	// Answer, Authority and Additional hold the records in each section
+	// of the response, in zone file format. For a hostname lookup, Answer
+	// holds the addresses found.
+	Answer     []string
+	Authority  []string
+	Additional []string
+
+	Err error
+}
+
+// String formats the step as a summary line, e.g.
+// "resolver:53 example.com. NS: NOERROR in 12ms", followed by one indented
+// line per record.
+func (s TraceStep) String() string {
+	var b strings.Builder
+	if s.Server == "" {
+		fmt.Fprintf(&b, "lookup %s: ", s.Name)
+	} else {
+		fmt.Fprintf(&b, "%s %s %s: ", s.Server, s.Name, s.Type)
+	}
+	switch {
+	case s.Err != nil:
+		fmt.Fprintf(&b, "error: %v", s.Err)
+	case s.Server == "":
+		b.WriteString(strings.Join(s.Answer, ", "))
+	default:
+		b.WriteString(s.Rcode.String())
+	}
+	fmt.Fprintf(&b, " in %s\n", s.Duration.Round(time.Millisecond))
+	if s.Server == "" {
+		return b.String()
+	}
+	for _, section := range []struct {
+		name    string
+		records []string
+	}{
+		{"answer", s.Answer},
+		{"authority", s.Authority},
+		{"additional", s.Additional},
+	} {
+		for _, record := range section.records {
+			fmt.Fprintf(&b, "  %s: %s\n", section.name, record)
+		}
+	}
+	return b.String()
+}
+
+// tracer collects the steps of one Check, passing each to onStep as it
+// completes and, if record is set, keeping them for CheckResult.Trace.
+type tracer struct {
+	mu     sync.Mutex
+	onStep func(TraceStep)
+	record bool
+	steps  []TraceStep
+}
+
+func (t *tracer) add(step TraceStep) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.record {
+		t.steps = append(t.steps, step)
+	}
+	if t.onStep != nil {
+		t.onStep(step)
+	}
+}
+
+// traceExchanger records every query it passes on in a tracer.
+type traceExchanger struct {
+	Exchanger
+	t *tracer
+}
+
+func (e traceExchanger) Exchange(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+	start := time.Now()
+	response, err := e.Exchanger.Exchange(ctx, msg, address)
+	step := TraceStep{
+		Time:     start,
+		Duration: time.Since(start),
+		Server:   address,
+		Err:      err,
+	}
+	if len(msg.Question) > 0 {
+		step.Name = msg.Question[0].Name
+		step.Type = dns.TypeToString[msg.Question[0].Qtype]
+	}
+	if response != nil {
+		step.Rcode = Rcode(response.Rcode)
+		step.Answer = traceRecords(response.Answer)
+		step.Authority = traceRecords(response.Ns)
+		step.Additional = traceRecords(response.Extra)
+	}
+	e.t.add(step)
+	return response, err
+}
+
+// traceRecords formats records in zone file format, leaving out the OPT
+// pseudo-record.
+func traceRecords(records []dns.RR) []string {
+	var formatted []string
+	for _, record := range records {
+		if _, ok := record.(*dns.OPT); !ok {
+			formatted = append(formatted, record.String())
+		}
+	}
+	return formatted
+}
+
+// traceHosts records every hostname lookup it passes on in a tracer.
+type traceHosts struct {
+	HostResolver
+	t *tracer
+}
+
+func (h traceHosts) LookupHost(ctx context.Context, host string) ([]string, error) {
+	start := time.Now()
+	addresses, err := h.HostResolver.LookupHost(ctx, host)
+	h.t.add(TraceStep{
+		Time:     start,
+		Duration: time.Since(start),
+		Name:     host,
+		Answer:   addresses,
+		Err:      err,
+	})
+	return addresses, err
+}
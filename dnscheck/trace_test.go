@@ -0,0 +1,78 @@
+package dnscheck
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckTrace(t *testing.T) {
+	exchanger := fakeExchanger{
+		"resolver:53":   reply(t, "example.com. 300 IN NS ns1.example.com."),
+		"192.0.2.53:53": reply(t, "example.com. 300 IN A 192.0.2.1"),
+	}
+	var streamed []TraceStep
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:       "example.com",
+		RecordType:   TypeA,
+		Expected:     []string{"192.0.2.1"},
+		Resolver:     "resolver:53",
+		Exchanger:    exchanger,
+		HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.53"}},
+		Trace:        true,
+		OnTrace:      func(step TraceStep) { streamed = append(streamed, step) },
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+
+	want := []struct{ server, name, typ, answer string }{
+		{"resolver:53", "example.com.", "NS", "ns1.example.com."},
+		{"", "ns1.example.com.", "", "192.0.2.53"},
+		{"192.0.2.53:53", "example.com.", "A", "192.0.2.1"},
+	}
+	if len(result.Trace) != len(want) || len(streamed) != len(want) {
+		t.Fatalf("Trace = %v (%d streamed), want %d steps", result.Trace, len(streamed), len(want))
+	}
+	for i, w := range want {
+		step := result.Trace[i]
+		if step.Server != w.server || step.Name != w.name || step.Type != w.typ || len(step.Answer) != 1 || !strings.HasSuffix(step.Answer[0], w.answer) {
+			t.Errorf("Trace[%d] = %+v, want %s %s %s answered with %s", i, step, w.server, w.name, w.typ, w.answer)
+		}
+	}
+
+	// A failing check's steps are streamed even though no result is
+	// returned.
+	streamed = nil
+	_, err = Check(context.Background(), CheckArgs{
+		Domain:     "example.com",
+		RecordType: TypeA,
+		Expected:   []string{"192.0.2.1"},
+		Resolver:   "unreachable:53",
+		Exchanger:  exchanger,
+		OnTrace:    func(step TraceStep) { streamed = append(streamed, step) },
+	})
+	if err == nil || len(streamed) == 0 || streamed[0].Err == nil {
+		t.Errorf("Check() error = %v, streamed %v; want the failed NS lookup streamed", err, streamed)
+	}
+}
+
+func TestTraceStepString(t *testing.T) {
+	step := TraceStep{
+		Server:    "resolver:53",
+		Name:      "www.example.com.",
+		Type:      "NS",
+		Duration:  12 * time.Millisecond,
+		Authority: []string{"example.com.\t300\tIN\tSOA\tns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300"},
+	}
+	want := "resolver:53 www.example.com. NS: NOERROR in 12ms\n  authority: example.com.\t300\tIN\tSOA\tns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300\n"
+	if got := step.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	lookup := TraceStep{Name: "ns1.example.com.", Answer: []string{"192.0.2.53", "192.0.2.54"}, Duration: time.Millisecond}
+	if got, want := lookup.String(), "lookup ns1.example.com.: 192.0.2.53, 192.0.2.54 in 1ms\n"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
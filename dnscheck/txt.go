@@ -0,0 +1,78 @@
+package dnscheck
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// maxUDPSize is the largest response a client without EDNS(0) accepts
+	// over UDP (RFC 1035 section 4.2.1). Larger responses are truncated and
+	// must be retried over TCP, which some clients and networks don't do.
+	maxUDPSize = 512
+
+	// txtStringWarnLen is the character-string length at which a TXT
+	// string is close enough to the 255-byte limit to be worth flagging.
+	txtStringWarnLen = 250
+)
+
+// txtSizeWarnings returns a warning for each TXT record in answer with a
+// character-string near the 255-byte limit, and one if the response would
+// not fit in a plain 512-byte UDP message.
+func txtSizeWarnings(response *dns.Msg, answer []dns.RR) []string {
+	var warnings []string
+	for _, record := range answer {
+		txt, ok := record.(*dns.TXT)
+		if !ok {
+			continue
+		}
+		for _, s := range txt.Txt {
+			if len(s) >= txtStringWarnLen {
+				warnings = append(warnings, fmt.Sprintf("TXT record of %d bytes has a %d-byte string near the 255-byte limit", txtSize(txt), len(s)))
+			}
+		}
+	}
+	if size := response.Len(); size > maxUDPSize {
+		warnings = append(warnings, fmt.Sprintf("response is %d bytes, larger than the %d bytes that fit in UDP without EDNS", size, maxUDPSize))
+	}
+	return warnings
+}
+
+// hasTXTPrefix reports whether record is a TXT record whose value, its
+// strings concatenated, starts with prefix, ignoring case.
+func hasTXTPrefix(record dns.RR, prefix string) bool {
+	txt, ok := record.(*dns.TXT)
+	if !ok {
+		return false
+	}
+	value := strings.Join(txt.Txt, "")
+	return len(value) >= len(prefix) && strings.EqualFold(value[:len(prefix)], prefix)
+}
+
+// txtStrings returns each character-string of the TXT records in answer as
+// a separate value, with the TTL of its record.
+func txtStrings(answer []dns.RR) ([]string, []uint32) {
+	var values []string
+	var ttls []uint32
+	for _, record := range answer {
+		if txt, ok := record.(*dns.TXT); ok {
+			for _, s := range txt.Txt {
+				values = append(values, s)
+				ttls = append(ttls, txt.Hdr.Ttl)
+			}
+		}
+	}
+	return values, ttls
+}
+
+// txtSize returns the size of a TXT record's RDATA: each character-string
+// plus its one-byte length prefix.
+func txtSize(txt *dns.TXT) int {
+	var size int
+	for _, s := range txt.Txt {
+		size += len(s) + 1
+	}
+	return size
+}
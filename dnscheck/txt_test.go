@@ -0,0 +1,151 @@
+package dnscheck
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestTXTSizeWarnings(t *testing.T) {
+	short := mustRR(t, `example.com. 300 IN TXT "v=spf1 -all"`)
+	long := mustRR(t, `example.com. 300 IN TXT "`+strings.Repeat("a", 252)+`"`)
+
+	tests := []struct {
+		name   string
+		answer []dns.RR
+		want   []string
+	}{
+		{"small", []dns.RR{short}, nil},
+		{"long string", []dns.RR{long}, []string{
+			"TXT record of 253 bytes has a 252-byte string near the 255-byte limit",
+		}},
+		{"too large for UDP", []dns.RR{long, long}, []string{
+			"TXT record of 253 bytes has a 252-byte string near the 255-byte limit",
+			"TXT record of 253 bytes has a 252-byte string near the 255-byte limit",
+			"response is 581 bytes, larger than the 512 bytes that fit in UDP without EDNS",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := new(dns.Msg)
+			response.SetQuestion("example.com.", dns.TypeTXT)
+			response.Answer = tt.answer
+			got := txtSizeWarnings(response, tt.answer)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("txtSizeWarnings() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSplitTXTStrings(t *testing.T) {
+	exchanger := fakeExchanger{
+		"resolver:53":   reply(t, "example.com. 300 IN NS ns1.example.com."),
+		"192.0.2.53:53": reply(t, `example.com. 300 IN TXT "first" "second"`),
+	}
+	for _, tt := range []struct {
+		split    bool
+		expected []string
+	}{
+		{false, []string{"firstsecond"}},
+		{true, []string{"first", "second"}},
+	} {
+		result, err := Check(context.Background(), CheckArgs{
+			Domain:          "example.com",
+			RecordType:      TypeTXT,
+			Expected:        tt.expected,
+			SplitTXTStrings: tt.split,
+			Resolver:        "resolver:53",
+			Exchanger:       exchanger,
+			HostResolver:    fakeHosts{"ns1.example.com.": {"192.0.2.53"}},
+		})
+		if err != nil {
+			t.Fatalf("Check() error: %v", err)
+		}
+		if s := result.Servers[0]; !s.Match || len(s.TTLs) != len(s.Values) {
+			t.Errorf("SplitTXTStrings=%v: server = %+v, want a match on %v with a TTL per value", tt.split, s, tt.expected)
+		}
+	}
+}
+
+func TestCheckTXTPrefix(t *testing.T) {
+	records := []string{
+		`example.com. 300 IN TXT "google-site-verification=abc123"`,
+		`example.com. 300 IN TXT "v=spf1 include:_spf.example.net " "-all"`,
+	}
+	for _, tt := range []struct {
+		name  string
+		extra string
+		want  bool
+	}{
+		{"one SPF record", "", true},
+		{"second SPF record, in another case", `example.com. 300 IN TXT "V=SPF1 include:_spf.example.net -all"`, false},
+		{"other TXT record", `example.com. 300 IN TXT "v=DMARC1; p=none"`, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			answer := records
+			if tt.extra != "" {
+				answer = append(answer[:len(answer):len(answer)], tt.extra)
+			}
+			result, err := Check(context.Background(), CheckArgs{
+				Domain:     "example.com",
+				RecordType: TypeTXT,
+				Expected:   []string{"v=spf1 include:_spf.example.net -all"},
+				TXTPrefix:  "v=spf1",
+				Resolver:   "resolver:53",
+				Exchanger: fakeExchanger{
+					"resolver:53":   reply(t, "example.com. 300 IN NS ns1.example.com."),
+					"192.0.2.53:53": reply(t, answer...),
+				},
+				HostResolver: fakeHosts{"ns1.example.com.": {"192.0.2.53"}},
+			})
+			if err != nil {
+				t.Fatalf("Check() error: %v", err)
+			}
+			if s := result.Servers[0]; s.Match != tt.want {
+				t.Errorf("Match = %v with values %q, want %v", s.Match, s.Values, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTXTPrefixExpectedFromName(t *testing.T) {
+	ns := reply(t, "example.com. 300 IN NS ns1.example.com.")
+	reference := reply(t,
+		`template.example.net. 300 IN TXT "v=spf1 include:_spf.example.net -all"`,
+		`template.example.net. 300 IN TXT "google-site-verification=xyz789"`,
+	)
+	exchanger := fakeExchanger{
+		"resolver:53": func(msg *dns.Msg) *dns.Msg {
+			if msg.Question[0].Qtype == dns.TypeNS {
+				return ns(msg)
+			}
+			return reference(msg)
+		},
+		"192.0.2.53:53": reply(t,
+			`example.com. 300 IN TXT "v=spf1 include:_spf.example.net -all"`,
+			`example.com. 300 IN TXT "google-site-verification=abc123"`,
+		),
+	}
+	result, err := Check(context.Background(), CheckArgs{
+		Domain:           "example.com",
+		RecordType:       TypeTXT,
+		ExpectedFromName: "template.example.net",
+		TXTPrefix:        "v=spf1",
+		Resolver:         "resolver:53",
+		Exchanger:        exchanger,
+		HostResolver:     fakeHosts{"ns1.example.com.": {"192.0.2.53"}},
+	})
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if want := []string{"v=spf1 include:_spf.example.net -all"}; !slices.Equal(result.Expected, want) {
+		t.Errorf("Expected = %q, want only the reference name's SPF record %q", result.Expected, want)
+	}
+	if ok, reason := result.Match(); !ok {
+		t.Errorf("Match() = false, %q", reason)
+	}
+}
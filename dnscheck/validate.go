@@ -0,0 +1,180 @@
+package dnscheck
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSSECStatus is the outcome of validating a server's answer when
+// CheckArgs.ValidateDNSSEC is enabled.
+type DNSSECStatus int
+
+const (
+	// DNSSECNotValidated means validation was not requested, the query
+	// failed, or the answer had no records of the requested type to
+	// validate. Denial of existence is not validated.
+	DNSSECNotValidated DNSSECStatus = iota
+	// DNSSECSecure means the answer's RRSIG verified with a DNSKEY that is
+	// itself signed by a key matching the zone's DS records.
+	DNSSECSecure
+	// DNSSECBogus means a signature was missing, expired or didn't verify.
+	// ServerResult.DNSSECError describes why.
+	DNSSECBogus
+)
+
+func (s DNSSECStatus) String() string {
+	switch s {
+	case DNSSECNotValidated:
+		return "not validated"
+	case DNSSECSecure:
+		return "secure"
+	case DNSSECBogus:
+		return "bogus"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", int(s))
+	}
+}
+
+// fetchDS returns the zone's DS records from the recursive resolver. The
+// resolver is trusted for them, so validation is anchored at the parent zone
+// rather than the root.
+func fetchDS(ctx context.Context, ex Exchanger, zone, resolver string) ([]*dns.DS, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(zone, dns.TypeDS)
+	msg.RecursionDesired = true
+	msg.SetEdns0(ednsBufferSize, true)
+
+	response, err := ex.Exchange(ctx, msg, resolver)
+	if err != nil {
+		return nil, fmt.Errorf("DS lookup for %s: %w", zone, err)
+	}
+	var ds []*dns.DS
+	for _, record := range response.Answer {
+		if r, ok := record.(*dns.DS); ok && strings.EqualFold(r.Hdr.Name, zone) {
+			ds = append(ds, r)
+		}
+	}
+	if len(ds) == 0 {
+		return nil, fmt.Errorf("no DS records for %s: the zone is unsigned or its delegation is insecure", zone)
+	}
+	return ds, nil
+}
+
+// validateDNSSEC validates the records of the checked type in response,
+// which addr returned, against the zone's DNSKEY set as served by addr.
+func (c *checkRun) validateDNSSEC(ctx context.Context, addr string, response *dns.Msg) (DNSSECStatus, error) {
+	owner := dns.Fqdn(c.args.Domain)
+	rrset := ownerRecords(response.Answer, owner, uint16(c.args.RecordType))
+	if len(rrset) == 0 {
+		return DNSSECNotValidated, nil
+	}
+
+	keys, err := c.zoneKeys(ctx, addr)
+	if err != nil {
+		return DNSSECBogus, err
+	}
+	if err := verifyRRset(rrset, response.Answer, keys, c.zone, time.Now()); err != nil {
+		return DNSSECBogus, err
+	}
+	return DNSSECSecure, nil
+}
+
+// zoneKeys queries addr for the zone's DNSKEY set and returns it once it is
+// verified by a key matching the DS records.
+func (c *checkRun) zoneKeys(ctx context.Context, addr string) ([]*dns.DNSKEY, error) {
+	response, err := queryServer(ctx, c.exchanger, addr, c.args.port(), c.zone, RecordType(dns.TypeDNSKEY), true)
+	if err != nil {
+		return nil, fmt.Errorf("DNSKEY query failed: %w", err)
+	}
+
+	rrset := ownerRecords(response.Answer, c.zone, dns.TypeDNSKEY)
+	var keys, trusted []*dns.DNSKEY
+	for _, record := range rrset {
+		key := record.(*dns.DNSKEY)
+		keys = append(keys, key)
+		if matchesDS(key, c.ds) {
+			trusted = append(trusted, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no DNSKEY records for %s", c.zone)
+	}
+	if len(trusted) == 0 {
+		return nil, fmt.Errorf("no DNSKEY for %s matches its DS records", c.zone)
+	}
+	if err := verifyRRset(rrset, response.Answer, trusted, c.zone, time.Now()); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// matchesDS reports whether key's digest matches any of the DS records.
+func matchesDS(key *dns.DNSKEY, ds []*dns.DS) bool {
+	for _, d := range ds {
+		if key.KeyTag() != d.KeyTag || key.Algorithm != d.Algorithm {
+			continue
+		}
+		if computed := key.ToDS(d.DigestType); computed != nil && strings.EqualFold(computed.Digest, d.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyRRset checks that one of the RRSIGs in answer covering rrset was made
+// by the zone with one of keys, is currently valid, and verifies.
+func verifyRRset(rrset, answer []dns.RR, keys []*dns.DNSKEY, zone string, now time.Time) error {
+	header := rrset[0].Header()
+	name := fmt.Sprintf("%s %s", header.Name, dns.TypeToString[header.Rrtype])
+
+	var reasons []string
+	for _, record := range ownerRecords(answer, header.Name, dns.TypeRRSIG) {
+		sig := record.(*dns.RRSIG)
+		if sig.TypeCovered != header.Rrtype {
+			continue
+		}
+		if !strings.EqualFold(sig.SignerName, zone) {
+			reasons = append(reasons, fmt.Sprintf("RRSIG signed by %s, not %s", sig.SignerName, zone))
+			continue
+		}
+		if !sig.ValidityPeriod(now) {
+			reasons = append(reasons, fmt.Sprintf("RRSIG with key tag %d is expired or not yet valid", sig.KeyTag))
+			continue
+		}
+		key := findKey(keys, sig)
+		if key == nil {
+			reasons = append(reasons, fmt.Sprintf("no DNSKEY with key tag %d", sig.KeyTag))
+			continue
+		}
+		if err := sig.Verify(key, rrset); err != nil {
+			reasons = append(reasons, fmt.Sprintf("RRSIG with key tag %d does not verify: %v", sig.KeyTag, err))
+			continue
+		}
+		return nil
+	}
+	if len(reasons) == 0 {
+		return fmt.Errorf("missing RRSIG for %s", name)
+	}
+	return fmt.Errorf("invalid RRSIG for %s: %s", name, strings.Join(reasons, "; "))
+}
+
+// findKey returns the key in keys that could have made sig, or nil.
+func findKey(keys []*dns.DNSKEY, sig *dns.RRSIG) *dns.DNSKEY {
+	for _, key := range keys {
+		if key.KeyTag() == sig.KeyTag && key.Algorithm == sig.Algorithm {
+			return key
+		}
+	}
+	return nil
+}
+
+// ownerRecords returns the records in answer owned by name with type rrtype.
+func ownerRecords(answer []dns.RR, name string, rrtype uint16) []dns.RR {
+	return filterAnswer(answer, func(record dns.RR) bool {
+		return record.Header().Rrtype == rrtype && strings.EqualFold(record.Header().Name, name)
+	})
+}
@@ -0,0 +1,158 @@
+package dnscheck
+
+import (
+	"context"
+	"crypto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// testKey is a zone signing key for example.com.
+type testKey struct {
+	dnskey *dns.DNSKEY
+	signer crypto.Signer
+}
+
+func newTestKey(t *testing.T) testKey {
+	t.Helper()
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	private, err := key.Generate(256)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	return testKey{key, private.(crypto.Signer)}
+}
+
+// sign returns the text form of an RRSIG by k over the records.
+func (k testKey) sign(t *testing.T, records ...string) string {
+	t.Helper()
+	var rrset []dns.RR
+	for _, s := range records {
+		rrset = append(rrset, mustRR(t, s))
+	}
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrset[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 300},
+		KeyTag:     k.dnskey.KeyTag(),
+		SignerName: "example.com.",
+		Algorithm:  k.dnskey.Algorithm,
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+	}
+	if err := sig.Sign(k.signer, rrset); err != nil {
+		t.Fatalf("Sign() error: %v", err)
+	}
+	return sig.String()
+}
+
+func TestCheckValidateDNSSEC(t *testing.T) {
+	key := newTestKey(t)
+	other := newTestKey(t)
+	const a = "example.com. 300 IN A 192.0.2.1"
+
+	tests := []struct {
+		name       string
+		ds         *dns.DS
+		answer     []string
+		wantStatus DNSSECStatus
+		wantErr    string
+	}{
+		{
+			name:       "valid",
+			ds:         key.dnskey.ToDS(dns.SHA256),
+			answer:     []string{a, key.sign(t, a)},
+			wantStatus: DNSSECSecure,
+		},
+		{
+			name:       "signature over different data",
+			ds:         key.dnskey.ToDS(dns.SHA256),
+			answer:     []string{a, key.sign(t, "example.com. 300 IN A 192.0.2.2")},
+			wantStatus: DNSSECBogus,
+			wantErr:    "does not verify",
+		},
+		{
+			name:       "missing signature",
+			ds:         key.dnskey.ToDS(dns.SHA256),
+			answer:     []string{a},
+			wantStatus: DNSSECBogus,
+			wantErr:    "missing RRSIG",
+		},
+		{
+			name:       "DNSKEY doesn't match DS",
+			ds:         other.dnskey.ToDS(dns.SHA256),
+			answer:     []string{a, key.sign(t, a)},
+			wantStatus: DNSSECBogus,
+			wantErr:    "matches its DS",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := reply(t, "example.com. 300 IN NS ns1.example.com.")
+			ds := reply(t, tt.ds.String())
+			keys := reply(t, key.dnskey.String(), key.sign(t, key.dnskey.String()))
+			answer := reply(t, tt.answer...)
+			exchanger := fakeExchanger{
+				"resolver:53": func(msg *dns.Msg) *dns.Msg {
+					if msg.Question[0].Qtype == dns.TypeDS {
+						return ds(msg)
+					}
+					return ns(msg)
+				},
+				"192.0.2.53:53": func(msg *dns.Msg) *dns.Msg {
+					if msg.Question[0].Qtype == dns.TypeDNSKEY {
+						return keys(msg)
+					}
+					return answer(msg)
+				},
+			}
+
+			result, err := Check(context.Background(), CheckArgs{
+				Domain:         "example.com",
+				RecordType:     TypeA,
+				Expected:       []string{"192.0.2.1"},
+				ValidateDNSSEC: true,
+				Resolver:       "resolver:53",
+				Exchanger:      exchanger,
+				HostResolver:   fakeHosts{"ns1.example.com.": {"192.0.2.53"}},
+			})
+			if err != nil {
+				t.Fatalf("Check() error: %v", err)
+			}
+			s := result.Servers[0]
+			if s.DNSSECStatus != tt.wantStatus {
+				t.Errorf("DNSSECStatus = %v, want %v (error %v)", s.DNSSECStatus, tt.wantStatus, s.DNSSECError)
+			}
+			if s.Match != (tt.wantErr == "") {
+				t.Errorf("Match = %v, want %v", s.Match, tt.wantErr == "")
+			}
+			if tt.wantErr != "" && (s.DNSSECError == nil || !strings.Contains(s.DNSSECError.Error(), tt.wantErr)) {
+				t.Errorf("DNSSECError = %v, want it to contain %q", s.DNSSECError, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckValidateDNSSECUnsignedZone(t *testing.T) {
+	exchanger := fakeExchanger{
+		"resolver:53": reply(t, "example.com. 300 IN NS ns1.example.com."),
+	}
+	_, err := Check(context.Background(), CheckArgs{
+		Domain:         "example.com",
+		RecordType:     TypeA,
+		Expected:       []string{"192.0.2.1"},
+		ValidateDNSSEC: true,
+		Resolver:       "resolver:53",
+		Exchanger:      exchanger,
+		HostResolver:   fakeHosts{},
+	})
+	if err == nil || !strings.Contains(err.Error(), "no DS records") {
+		t.Errorf("Check() error = %v, want no DS records", err)
+	}
+}
@@ -0,0 +1,163 @@
+package dnscheck
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// DefaultWatchInterval is the polling interval used when WatchArgs.Interval
+// is zero.
+const DefaultWatchInterval = 30 * time.Second
+
+// WatchArgs holds the parameters for Watch.
+type WatchArgs struct {
+	Check    CheckArgs
+	Interval time.Duration // defaults to DefaultWatchInterval if zero
+
+	// ExitOnRegression stops watching as soon as a server that matched in
+	// an earlier round no longer matches, which usually means a server
+	// rolled back or a bad deploy went out. The regressed servers are
+	// reported in WatchResult.Regressed. Watch also keeps polling after the
+	// check converges, until ctx is done, so that it guards against
+	// flapping records.
+	ExitOnRegression bool
+
+	// Milestones are fractions of servers (0 < m <= 1), e.g. 0.5 and 1, at
+	// which to record a Milestone the first time that fraction of servers
+	// match. OnMilestone, if set, is called as each one is reached.
+	Milestones  []float64
+	OnMilestone func(Milestone)
+
+	// StopAt, if positive, ends the watch as soon as this fraction of
+	// servers match rather than waiting for all of them.
+	StopAt float64
+
+	// OnRound, if set, is called after every round with its result, or
+	// with the error if Check failed, e.g. to print progress.
+	OnRound func(*CheckResult, error)
+}
+
+// Milestone records when a fraction of servers first matched.
+type Milestone struct {
+	Threshold float64       // fraction from WatchArgs.Milestones
+	Matched   int           // servers matching when it was reached
+	Total     int           // servers checked in that round
+	Elapsed   time.Duration // time since Watch started
+}
+
+// WatchResult holds the outcome of Watch.
+type WatchResult struct {
+	Result    *CheckResult   // result of the last completed round
+	Rounds    int            // number of checks run
+	Converged bool           // whether the last completed round matched, or reached StopAt
+	Regressed []ServerResult // servers that regressed, if watching stopped because of it
+
+	// Milestones are the milestones reached, in the order they were reached.
+	Milestones []Milestone
+}
+
+// Watch runs Check repeatedly, every Interval, until every server matches or
+// ctx is done (but see WatchArgs.ExitOnRegression). Rounds in which Check
+// itself fails, e.g. because nameserver discovery errors, are retried on the
+// next interval. When ctx is done while waiting for the next round, Watch
+// returns immediately with the last completed round. An error is returned
+// only if ctx ends before any round completed.
+func Watch(ctx context.Context, args WatchArgs) (*WatchResult, error) {
+	interval := args.Interval
+	if interval == 0 {
+		interval = DefaultWatchInterval
+	}
+
+	start := time.Now()
+	pending := slices.Sorted(slices.Values(args.Milestones))
+	w := &WatchResult{}
+	matched := make(map[serverKey]bool)
+	for {
+		result, err := Check(ctx, args.Check)
+		w.Rounds++
+		if args.OnRound != nil {
+			args.OnRound(result, err)
+		}
+		if err == nil {
+			w.Result = result
+			w.Converged, _ = result.Match()
+
+			fraction, count, total := matchFraction(result)
+			for len(pending) > 0 && fraction >= pending[0] {
+				m := Milestone{Threshold: pending[0], Matched: count, Total: total, Elapsed: time.Since(start)}
+				w.Milestones = append(w.Milestones, m)
+				if args.OnMilestone != nil {
+					args.OnMilestone(m)
+				}
+				pending = pending[1:]
+			}
+
+			if args.ExitOnRegression {
+				if regressed := regressions(result, matched); len(regressed) > 0 {
+					w.Regressed = regressed
+					return w, nil
+				}
+			}
+			if args.StopAt > 0 && fraction >= args.StopAt {
+				w.Converged = true
+				return w, nil
+			}
+			if w.Converged && !args.ExitOnRegression {
+				return w, nil
+			}
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if w.Result == nil {
+				if err != nil {
+					return nil, err
+				}
+				return nil, ctx.Err()
+			}
+			return w, nil
+		case <-timer.C:
+		}
+	}
+}
+
+// matchFraction returns the fraction of result's servers that match, along
+// with the count of matching servers and the total. The fraction is zero if
+// there are no servers.
+func matchFraction(result *CheckResult) (float64, int, int) {
+	var count int
+	for _, s := range result.Servers {
+		if s.Match {
+			count++
+		}
+	}
+	total := len(result.Servers)
+	if total == 0 {
+		return 0, 0, 0
+	}
+	return float64(count) / float64(total), count, total
+}
+
+// serverKey identifies a server across rounds.
+type serverKey struct {
+	nameserver string
+	address    string
+}
+
+// regressions returns the servers in result that don't match but did in an
+// earlier round, and records the servers that match now in matched.
+func regressions(result *CheckResult, matched map[serverKey]bool) []ServerResult {
+	var regressed []ServerResult
+	for _, s := range result.Servers {
+		key := serverKey{s.Nameserver, s.Address}
+		if s.Match {
+			matched[key] = true
+		} else if matched[key] {
+			regressed = append(regressed, s)
+		}
+	}
+	return regressed
+}
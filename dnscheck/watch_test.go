@@ -0,0 +1,171 @@
+package dnscheck
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestWatchExitOnRegression(t *testing.T) {
+	good := reply(t, "example.com. 300 IN A 192.0.2.100")
+	bad := reply(t, "example.com. 300 IN A 192.0.2.99")
+
+	// ns2 matches in the second round, then rolls back in the third.
+	var rounds int
+	exchanger := fakeExchanger{
+		"resolver:53": func(msg *dns.Msg) *dns.Msg {
+			rounds++
+			return reply(t,
+				"example.com. 300 IN NS ns1.example.com.",
+				"example.com. 300 IN NS ns2.example.com.",
+			)(msg)
+		},
+		"192.0.2.1:53": good,
+		"192.0.2.2:53": func(msg *dns.Msg) *dns.Msg {
+			if rounds == 2 {
+				return good(msg)
+			}
+			return bad(msg)
+		},
+	}
+	hosts := fakeHosts{
+		"ns1.example.com.": {"192.0.2.1"},
+		"ns2.example.com.": {"192.0.2.2"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	w, err := Watch(ctx, WatchArgs{
+		Check: CheckArgs{
+			Domain:       "example.com",
+			RecordType:   TypeA,
+			Expected:     []string{"192.0.2.100"},
+			Resolver:     "resolver:53",
+			Exchanger:    exchanger,
+			HostResolver: hosts,
+		},
+		Interval:         time.Millisecond,
+		ExitOnRegression: true,
+	})
+	if err != nil {
+		t.Fatalf("Watch() error: %v", err)
+	}
+	if w.Rounds != 3 || w.Converged {
+		t.Errorf("Watch() = %d rounds, converged %v, want 3 rounds, not converged", w.Rounds, w.Converged)
+	}
+	if len(w.Regressed) != 1 || w.Regressed[0].Nameserver != "ns2.example.com." {
+		t.Errorf("Regressed = %+v, want only ns2.example.com.", w.Regressed)
+	}
+}
+
+func TestWatchMilestones(t *testing.T) {
+	good := reply(t, "example.com. 300 IN A 192.0.2.100")
+	bad := reply(t, "example.com. 300 IN A 192.0.2.99")
+
+	// Server i starts matching in round i.
+	var rounds int
+	exchanger := fakeExchanger{
+		"resolver:53": func(msg *dns.Msg) *dns.Msg {
+			rounds++
+			return reply(t,
+				"example.com. 300 IN NS ns1.example.com.",
+				"example.com. 300 IN NS ns2.example.com.",
+				"example.com. 300 IN NS ns3.example.com.",
+				"example.com. 300 IN NS ns4.example.com.",
+			)(msg)
+		},
+	}
+	hosts := fakeHosts{}
+	for i := 1; i <= 4; i++ {
+		addr := fmt.Sprintf("192.0.2.%d", i)
+		hosts[fmt.Sprintf("ns%d.example.com.", i)] = []string{addr}
+		exchanger[addr+":53"] = func(msg *dns.Msg) *dns.Msg {
+			if rounds >= i {
+				return good(msg)
+			}
+			return bad(msg)
+		}
+	}
+	check := CheckArgs{
+		Domain:       "example.com",
+		RecordType:   TypeA,
+		Expected:     []string{"192.0.2.100"},
+		Resolver:     "resolver:53",
+		Exchanger:    exchanger,
+		HostResolver: hosts,
+	}
+
+	var fired []float64
+	w, err := Watch(context.Background(), WatchArgs{
+		Check:       check,
+		Interval:    time.Millisecond,
+		Milestones:  []float64{1, 0.5},
+		OnMilestone: func(m Milestone) { fired = append(fired, m.Threshold) },
+	})
+	if err != nil {
+		t.Fatalf("Watch() error: %v", err)
+	}
+	if !w.Converged || w.Rounds != 4 {
+		t.Errorf("Watch() = %d rounds, converged %v, want 4 rounds, converged", w.Rounds, w.Converged)
+	}
+	if !slices.Equal(fired, []float64{0.5, 1}) {
+		t.Errorf("OnMilestone called with %v, want [0.5 1]", fired)
+	}
+	if len(w.Milestones) != 2 || w.Milestones[0].Matched != 2 || w.Milestones[0].Total != 4 {
+		t.Errorf("Milestones = %+v", w.Milestones)
+	}
+
+	rounds = 0
+	w, err = Watch(context.Background(), WatchArgs{Check: check, Interval: time.Millisecond, StopAt: 0.75})
+	if err != nil {
+		t.Fatalf("Watch() error: %v", err)
+	}
+	if !w.Converged || w.Rounds != 3 {
+		t.Errorf("Watch() with StopAt = %d rounds, converged %v, want 3 rounds, converged", w.Rounds, w.Converged)
+	}
+}
+
+func TestWatchCancel(t *testing.T) {
+	exchanger := fakeExchanger{
+		"resolver:53":  reply(t, "example.com. 300 IN NS ns1.example.com."),
+		"192.0.2.1:53": reply(t, "example.com. 300 IN A 192.0.2.99"),
+	}
+	hosts := fakeHosts{"ns1.example.com.": {"192.0.2.1"}}
+
+	// Cancelling during the first round must not wait out the interval.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls int
+	start := time.Now()
+	w, err := Watch(ctx, WatchArgs{
+		Check: CheckArgs{
+			Domain:       "example.com",
+			RecordType:   TypeA,
+			Expected:     []string{"192.0.2.100"},
+			Resolver:     "resolver:53",
+			Exchanger:    exchanger,
+			HostResolver: hosts,
+		},
+		Interval: time.Hour,
+		OnRound: func(result *CheckResult, err error) {
+			calls++
+			if err != nil {
+				t.Errorf("OnRound error: %v", err)
+			}
+			cancel()
+		},
+	})
+	if err != nil {
+		t.Fatalf("Watch() error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Watch() took %s after cancellation", elapsed)
+	}
+	if w.Rounds != 1 || calls != 1 || w.Converged || w.Result == nil {
+		t.Errorf("Watch() = %d rounds, %d OnRound calls, converged %v, want 1 round, not converged", w.Rounds, calls, w.Converged)
+	}
+}
@@ -1,42 +1,315 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/jacob2161/addled/dnscheck"
 )
 
+// Exit codes, so that scripts can tell a check that ran and failed, e.g.
+// because records haven't propagated yet, from one that couldn't run.
+const (
+	exitOK       = 0 // every check passed
+	exitMismatch = 1 // a check ran and failed
+	exitUsage    = 2 // invalid flags or arguments, or an unreadable input file
+	exitError    = 3 // a check couldn't run, e.g. the nameservers couldn't be found
+)
+
 func main() {
-	var recordType, name, expect string
-	var timeout time.Duration
-	var verbose bool
-	flag.StringVar(&recordType, "type", "", "DNS record type (A, AAAA, CNAME, TXT, MX)")
-	flag.StringVar(&name, "name", "", "domain name to check")
-	flag.StringVar(&expect, "expect", "", "expected record value(s), comma-separated")
-	flag.DurationVar(&timeout, "timeout", 5*time.Second, "timeout for the entire check")
-	flag.BoolVar(&verbose, "verbose", false, "enable verbose logging")
-	flag.Parse()
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) > 0 && args[0] == "audit" {
+		return runAudit(args[1:], stdout, stderr)
+	}
+	if len(args) > 0 && args[0] == "serve" {
+		return runServe(args[1:], stderr)
+	}
+
+	flags := flag.NewFlagSet("addled", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	var recordType, expect, expectJSON, apexCNAME, colorMode, acceptRcode, checkResolvers, crossCheck, batch, expectFromName, milestones, matchMode, resolver, family, expectFile, namesFile, txtPrefix string
+	var timeout, queryTimeout, minNSTTL, batchTimeout time.Duration
+	var qps float64
+	var localPort, port, maxServers, stopAt, concurrency, batchConcurrency, retries int
+	var verbose, systemResolver, checkSignatures, validateDNSSEC, dnssec, influx, detectSpoofing, forceTCP, watch, exitOnRegression, printDig, checkTXTSize, splitTXT, group, everyPattern, jsonOutput, quiet, expectFromPrimary, trace, ignoreMXPreference, plan, table bool
+	var interval time.Duration
+	flags.StringVar(&recordType, "type", "", "DNS record type (A, AAAA, CNAME, TXT, MX, NS, SOA, PTR, SRV, CAA, TLSA, DS, DNSKEY, AFSDB, RT), or several comma-separated with expected values as TYPE=VALUE")
+	var names []string
+	flags.Func("name", "domain name to check (repeatable)", func(value string) error {
+		names = append(names, value)
+		return nil
+	})
+	flags.StringVar(&namesFile, "names-file", "", "check every domain name listed in this file, one per line")
+	flags.StringVar(&expect, "expect", "", "expected record value(s), comma-separated")
+	flags.StringVar(&expectJSON, "expect-json", "", "expected record value(s) as a JSON array of strings")
+	flags.StringVar(&expectFile, "expect-file", "", "read expected record value(s) from this file, one per line (blank lines and # comments are ignored)")
+	flags.BoolVar(&expectFromPrimary, "expect-from-primary", false, "expect the records the zone's primary nameserver (the SOA MNAME) returns, to check that every server is in sync with it")
+	flags.StringVar(&expectFromName, "expect-from-name", "", "expect the records this name resolves to, e.g. a load balancer hostname")
+	var requireCAA []string
+	flags.Func("require-caa", "CAA property that every server must return, as \"TAG VALUE\" (repeatable)", func(value string) error {
+		requireCAA = append(requireCAA, value)
+		return nil
+	})
+	var nameservers []string
+	flags.Func("ns", "check this nameserver, a hostname or IP address, instead of the zone's (repeatable, or comma-separated)", func(value string) error {
+		nameservers = append(nameservers, splitExpected(value)...)
+		return nil
+	})
+	expectedByServer := make(map[string][]string)
+	flags.Func("expect-server", "expected value(s) for one nameserver or address, as SERVER=VALUE[,VALUE...] (repeatable)", func(value string) error {
+		server, values, ok := strings.Cut(value, "=")
+		if !ok || server == "" {
+			return fmt.Errorf("expected SERVER=VALUE[,VALUE...]")
+		}
+		expectedByServer[server] = splitExpected(values)
+		return nil
+	})
+	flags.DurationVar(&timeout, "timeout", 5*time.Second, "timeout for the entire check")
+	flags.IntVar(&retries, "retries", 0, "retry each server's query this many times after an error or an unexpectedly empty answer")
+	flags.DurationVar(&queryTimeout, "query-timeout", 0, "timeout for each individual query, so one slow server can't use up --timeout (0 for none)")
+	flags.BoolVar(&verbose, "verbose", false, "enable verbose logging")
+	flags.BoolVar(&dnssec, "dnssec", false, "set the DNSSEC OK bit on every query and include returned RRSIGs in --json and --verbose output")
+	flags.BoolVar(&validateDNSSEC, "validate-dnssec", false, "validate each answer's RRSIG against the zone's DNSKEY and DS records and fail bogus servers")
+	flags.BoolVar(&checkSignatures, "check-signatures", false, "require each server to return a consistent RRSIG (signed zones only)")
+	flags.BoolVar(&checkTXTSize, "check-txt-size", false, "warn about TXT records near the 255-byte string limit or too large for a 512-byte UDP response")
+	flags.StringVar(&txtPrefix, "txt-prefix", "", "only compare TXT records starting with this prefix, e.g. v=spf1 (case-insensitive)")
+	flags.BoolVar(&ignoreMXPreference, "ignore-mx-preference", false, "compare only the hosts of MX records, not their preferences")
+	flags.BoolVar(&splitTXT, "split-txt", false, "compare each string of a TXT record as a separate value instead of joining them")
+	flags.StringVar(&matchMode, "match", "exact", "how to compare values with --expect (exact, subset, absent, regex)")
+	flags.BoolVar(&everyPattern, "require-every-pattern", false, "with --match regex, require every pattern to match at least one value")
+	flags.StringVar(&apexCNAME, "apex-cname", "warn", "how to handle a CNAME at the zone apex (warn, error, follow)")
+	flags.DurationVar(&minNSTTL, "min-ns-ttl", 0, "fail servers whose NS records have a TTL below this minimum")
+	flags.IntVar(&localPort, "local-port", 0, "local source port for DNS queries (0 for ephemeral)")
+	flags.BoolVar(&forceTCP, "tcp", false, "send every query over TCP instead of trying UDP first, for networks that mangle UDP DNS")
+	flags.IntVar(&port, "port", 53, "port to query the authoritative nameservers on")
+	flags.StringVar(&family, "family", "ipv4", "which nameserver addresses to query (ipv4, ipv6, both)")
+	flags.IntVar(&concurrency, "concurrency", dnscheck.DefaultConcurrency, "number of server addresses to query at once")
+	flags.Float64Var(&qps, "qps", 0, "send at most this many queries per second, across all servers and domains checked at once (0 for no limit)")
+	flags.IntVar(&maxServers, "max-servers", 0, "query at most this many server addresses, sampled across nameservers (0 for all)")
+	flags.StringVar(&acceptRcode, "accept-rcode", "", "response codes to accept as a pass when the answer is empty, comma-separated (e.g. REFUSED)")
+	flags.BoolVar(&influx, "influx", false, "print results to stdout as InfluxDB line protocol")
+	flags.BoolVar(&jsonOutput, "json", false, "print the full result to stdout as JSON")
+	flags.BoolVar(&quiet, "quiet", false, "on failure, print only the one-line reason, and nothing on success; rely on the exit code")
+	flags.StringVar(&resolver, "resolver", "", "recursive resolver for nameserver discovery, as host:port, tls://host[:port] for DNS over TLS, or an https:// URL for DNS over HTTPS; list several, comma-separated, to fall back to the next when one fails (default "+dnscheck.DefaultResolver+")")
+	flags.BoolVar(&systemResolver, "system-resolver", false, "unless --resolver is set, use the first nameserver in /etc/resolv.conf for nameserver discovery")
+	flags.StringVar(&checkResolvers, "check-resolvers", "", "check these recursive resolvers instead of the authoritative servers, comma-separated host:port")
+	flags.StringVar(&crossCheck, "cross-check-resolvers", "", "also ask these recursive resolvers for the NS records and fail unless they agree, comma-separated host:port")
+	flags.BoolVar(&detectSpoofing, "detect-spoofing", false, "report responses whose ID or question don't match the query as possible spoofing")
+	flags.BoolVar(&trace, "trace", false, "print every query sent and nameserver looked up, with the records returned, to stderr")
+	flags.BoolVar(&plan, "plan", false, "find and resolve the nameservers and print the addresses that would be queried, without querying them")
+	flags.BoolVar(&printDig, "print-dig", false, "print the equivalent dig command for every query to stderr")
+	flags.BoolVar(&group, "group", false, "on failure, group servers by the answer they returned")
+	flags.BoolVar(&table, "table", false, "print every server's status and values as a table, whether or not the check passed")
+	flags.StringVar(&colorMode, "color", "auto", "colorize output (auto, always, never)")
+	flags.StringVar(&batch, "batch", "", "check every domain and record type listed in this file instead of --type and --name, each with --timeout")
+	flags.IntVar(&batchConcurrency, "batch-concurrency", 4, "number of domains to check at once with --batch or several domain names")
+	flags.DurationVar(&batchTimeout, "batch-timeout", 0, "deadline for the whole --batch run or several domain names, after which remaining checks are skipped (0 for none)")
+	flags.BoolVar(&watch, "watch", false, "re-check every --interval until all servers match or --timeout expires")
+	flags.DurationVar(&interval, "interval", dnscheck.DefaultWatchInterval, "polling interval for --watch")
+	flags.StringVar(&milestones, "milestones", "", "with --watch, log when these percentages of servers match, comma-separated (e.g. 50,90,100)")
+	flags.IntVar(&stopAt, "stop-at", 0, "with --watch, succeed once this percentage of servers match (0 for all)")
+	flags.BoolVar(&exitOnRegression, "exit-on-regression", false, "with --watch, keep polling after convergence and fail as soon as a matching server stops matching")
+	if err := flags.Parse(args); err != nil {
+		return parseError(err)
+	}
+
+	var rt dnscheck.RecordType
+	var recordTypes []dnscheck.RecordType
+	var name string
+	var discover, multi, multiType bool
+	if batch != "" {
+		var conflicts []string
+		flags.Visit(func(f *flag.Flag) {
+			if batchConflicts[f.Name] {
+				conflicts = append(conflicts, "--"+f.Name)
+			}
+		})
+		if len(conflicts) > 0 {
+			fmt.Fprintf(stderr, "--batch can't be used with %s\n", strings.Join(conflicts, ", "))
+			return exitUsage
+		}
+	} else {
+		if namesFile != "" {
+			values, err := readLines(namesFile)
+			if err != nil {
+				fmt.Fprintf(stderr, "%v\n", err)
+				return exitUsage
+			}
+			if len(values) == 0 {
+				fmt.Fprintf(stderr, "invalid --names-file: %s has no names\n", namesFile)
+				return exitUsage
+			}
+			names = append(names, values...)
+		}
+
+		if recordType == "" || len(names) == 0 {
+			fmt.Fprintf(stderr, "usage: addled --type TYPE --name NAME [--expect VALUE[,VALUE...]]\n")
+			return exitUsage
+		}
+		discover = expect == "" && expectJSON == "" && expectFile == "" && expectFromName == "" && !expectFromPrimary && len(requireCAA) == 0 && len(expectedByServer) == 0
+		if discover && watch {
+			fmt.Fprintf(stderr, "--watch requires expected values, e.g. --expect\n")
+			return exitUsage
+		}
+
+		multi = len(names) > 1
+		if multi && (discover || watch || influx || jsonOutput || checkResolvers != "") {
+			fmt.Fprintf(stderr, "several domain names can't be used with --watch, --influx, --json or --check-resolvers, or without expected values\n")
+			return exitUsage
+		}
+
+		for _, value := range splitExpected(recordType) {
+			t, err := dnscheck.ParseRecordType(value)
+			if err != nil {
+				fmt.Fprintf(stderr, "%v\n", err)
+				return exitUsage
+			}
+			recordTypes = append(recordTypes, t)
+		}
+		rt = recordTypes[0]
+		multiType = len(recordTypes) > 1
+		if multiType && (multi || discover || watch || influx || jsonOutput || checkResolvers != "" || expectFromName != "" || expectFromPrimary || len(requireCAA) > 0 || len(expectedByServer) > 0) {
+			fmt.Fprintf(stderr, "several record types can't be used with several domain names, --watch, --influx, --json, --check-resolvers, --expect-from-name, --expect-from-primary, --require-caa or --expect-server, or without expected values\n")
+			return exitUsage
+		}
+		if multiType && slices.Contains(recordTypes, dnscheck.TypePTR) {
+			fmt.Fprintf(stderr, "PTR can't be checked together with other record types\n")
+			return exitUsage
+		}
+		var err error
+		for i := range names {
+			if rt == dnscheck.TypePTR {
+				names[i] = dnscheck.ReverseName(strings.TrimSpace(names[i]))
+			}
+			if names[i], err = dnscheck.NormalizeDomain(names[i]); err != nil {
+				fmt.Fprintf(stderr, "%v\n", err)
+				return exitUsage
+			}
+		}
+		name = names[0]
+	}
 
-	if recordType == "" || name == "" || expect == "" {
-		fmt.Fprintf(os.Stderr, "usage: addled --type TYPE --name NAME --expect VALUE[,VALUE...]\n")
-		os.Exit(1)
+	if influx && jsonOutput {
+		fmt.Fprintf(stderr, "--influx and --json can't be used together\n")
+		return exitUsage
+	}
+	if checkResolvers != "" && (expectFromName != "" || expectFromPrimary || len(requireCAA) > 0 || len(expectedByServer) > 0 || len(nameservers) > 0) {
+		fmt.Fprintf(stderr, "--check-resolvers can't be used with --expect-from-name, --expect-from-primary, --require-caa, --expect-server or --ns\n")
+		return exitUsage
+	}
+	if plan && (multi || multiType || watch || influx || jsonOutput || quiet || checkResolvers != "") {
+		fmt.Fprintf(stderr, "--plan can't be used with several domain names or record types, --watch, --influx, --json, --quiet or --check-resolvers\n")
+		return exitUsage
+	}
+	if table && (multi || discover || influx || jsonOutput || quiet || group || checkResolvers != "") {
+		fmt.Fprintf(stderr, "--table can't be used with several domain names, --influx, --json, --quiet, --group or --check-resolvers, or without expected values\n")
+		return exitUsage
+	}
+	if quiet && (influx || jsonOutput || verbose || trace) {
+		fmt.Fprintf(stderr, "--quiet can't be used with --influx, --json, --verbose or --trace\n")
+		return exitUsage
 	}
 
-	rt, err := dnscheck.ParseRecordType(recordType)
+	if qps < 0 {
+		fmt.Fprintf(stderr, "invalid --qps: %g\n", qps)
+		return exitUsage
+	}
+	if localPort < 0 || localPort > 65535 {
+		fmt.Fprintf(stderr, "invalid --local-port: %d\n", localPort)
+		return exitUsage
+	}
+	if port < 1 || port > 65535 {
+		fmt.Fprintf(stderr, "invalid --port: %d\n", port)
+		return exitUsage
+	}
+
+	color, err := useColor(colorMode, stderr)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(stderr, "%v\n", err)
+		return exitUsage
 	}
 
-	expected := strings.Split(expect, ",")
-	for i := range expected {
-		expected[i] = strings.TrimSpace(expected[i])
+	apexPolicy, err := parseApexCNAMEPolicy(apexCNAME)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return exitUsage
+	}
+
+	mode, err := parseMatchMode(matchMode)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return exitUsage
+	}
+	addressFamily, err := parseFamily(family)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return exitUsage
+	}
+
+	var acceptRcodes []dnscheck.Rcode
+	if acceptRcode != "" {
+		for _, value := range strings.Split(acceptRcode, ",") {
+			rcode, err := dnscheck.ParseRcode(strings.TrimSpace(value))
+			if err != nil {
+				fmt.Fprintf(stderr, "%v\n", err)
+				return exitUsage
+			}
+			acceptRcodes = append(acceptRcodes, rcode)
+		}
+	}
+
+	var expected []string
+	if expect != "" {
+		expected = append(expected, splitExpected(expect)...)
+	}
+	if expectJSON != "" {
+		values, err := parseExpectedJSON(expectJSON)
+		if err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return exitUsage
+		}
+		expected = append(expected, values...)
+	}
+	if expectFile != "" {
+		values, err := readLines(expectFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return exitUsage
+		}
+		if len(values) == 0 {
+			// An empty file is more likely a mistake than an expectation
+			// of no records.
+			fmt.Fprintf(stderr, "invalid --expect-file: %s has no values\n", expectFile)
+			return exitUsage
+		}
+		expected = append(expected, values...)
+	}
+	var expectedByType map[dnscheck.RecordType][]string
+	if multiType {
+		expectedByType, err = parseExpectedByType(expected, recordTypes)
+		if err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return exitUsage
+		}
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -44,34 +317,844 @@ func main() {
 
 	var logger *slog.Logger
 	if verbose {
-		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		logger = slog.New(slog.NewTextHandler(stderr, nil))
 	}
 
-	result, err := dnscheck.Check(ctx, dnscheck.CheckArgs{
-		Domain:     name,
-		RecordType: rt,
-		Expected:   expected,
-		Logger:     logger,
-	})
+	resolvers := splitExpected(resolver)
+	checkArgs := dnscheck.CheckArgs{
+		Domain:              name,
+		RecordType:          rt,
+		Expected:            expected,
+		ExpectedFromName:    expectFromName,
+		ExpectedFromPrimary: expectFromPrimary,
+		Resolver:            resolvers[0],
+		FallbackResolvers:   resolvers[1:],
+		SystemResolver:      systemResolver,
+		Logger:              logger,
+		CheckSignatures:     checkSignatures,
+		DNSSEC:              dnssec,
+		ValidateDNSSEC:      validateDNSSEC,
+		CheckTXTSize:        checkTXTSize,
+		SplitTXTStrings:     splitTXT,
+		TXTPrefix:           txtPrefix,
+		IgnoreMXPreference:  ignoreMXPreference,
+		ApexCNAME:           apexPolicy,
+		MatchMode:           mode,
+		RequireEveryPattern: everyPattern,
+		Retries:             retries,
+		PerQueryTimeout:     queryTimeout,
+		AddressFamily:       addressFamily,
+		LocalPort:           localPort,
+		ForceTCP:            forceTCP,
+		Port:                strconv.Itoa(port),
+		MinNSTTL:            minNSTTL,
+		AcceptRcodes:        acceptRcodes,
+		DetectSpoofing:      detectSpoofing,
+		MaxServers:          maxServers,
+		Concurrency:         concurrency,
+		RequireCAA:          requireCAA,
+		Nameservers:         nameservers,
+		RateLimiter:         dnscheck.NewRateLimiter(qps),
+	}
+	if len(expectedByServer) > 0 {
+		checkArgs.ExpectedByServer = expectedByServer
+	}
+	if printDig {
+		// Commands for queries sent concurrently must not interleave.
+		checkArgs.DigOutput = &lockedWriter{w: stderr}
+	}
+	if trace {
+		// Several names are checked concurrently, each with its own trace.
+		var mu sync.Mutex
+		checkArgs.OnTrace = func(step dnscheck.TraceStep) {
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprint(stderr, step)
+		}
+	}
+	if crossCheck != "" {
+		checkArgs.CrossCheckResolvers = splitExpected(crossCheck)
+	}
+	if watch || multi {
+		// Delegations rarely change between rounds or across names.
+		checkArgs.Cache = new(dnscheck.Cache)
+	}
+
+	report := func(result *dnscheck.CheckResult) {
+		if quiet {
+			_, reason := result.Match()
+			fmt.Fprintln(stderr, reason)
+			return
+		}
+		switch {
+		case table:
+			result.ReportTable(stderr, color)
+		case group:
+			result.ReportGroups(stderr, color)
+		default:
+			result.Report(stderr, color)
+		}
+	}
+
+	if batch != "" {
+		return runBatch(batch, checkArgs, timeout, batchTimeout, batchConcurrency, quiet, report, stderr)
+	}
+
+	if multi {
+		checks := make([]dnscheck.CheckArgs, len(names))
+		for i, name := range names {
+			checks[i] = checkArgs
+			checks[i].Domain = name
+			if err := checks[i].Validate(); err != nil {
+				fmt.Fprintf(stderr, "%v\n", err)
+				return exitUsage
+			}
+		}
+		return runChecks(checks, timeout, batchTimeout, batchConcurrency, quiet, report, stderr)
+	}
+
+	if err := checkArgs.Validate(); err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return exitUsage
+	}
+
+	if plan {
+		return runPlan(ctx, checkArgs, stdout, stderr)
+	}
+
+	if checkResolvers != "" {
+		return runResolverCheck(ctx, checkArgs, splitExpected(checkResolvers), stdout, stderr)
+	}
+
+	if multiType {
+		result, err := dnscheck.CheckMulti(ctx, checkArgs, expectedByType)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %v\n", err)
+			return exitError
+		}
+		code := exitOK
+		for _, result := range result.Results {
+			if matched, _ := result.Match(); !matched {
+				report(result)
+				code = exitMismatch
+			} else if table {
+				result.ReportTable(stderr, color)
+			} else if verbose {
+				fmt.Fprint(stderr, result.Summary())
+			}
+		}
+		return code
+	}
+
+	if watch {
+		thresholds, err := parsePercentages(milestones)
+		if err != nil {
+			fmt.Fprintf(stderr, "invalid --milestones: %v\n", err)
+			return exitUsage
+		}
+		if stopAt < 0 || stopAt > 100 {
+			fmt.Fprintf(stderr, "invalid --stop-at: %d\n", stopAt)
+			return exitUsage
+		}
+		return runWatch(ctx, dnscheck.WatchArgs{
+			Check:            checkArgs,
+			Interval:         interval,
+			ExitOnRegression: exitOnRegression,
+			Milestones:       thresholds,
+			OnMilestone: func(m dnscheck.Milestone) {
+				if quiet {
+					return
+				}
+				fmt.Fprintf(stderr, "T+%s: %.0f%% of servers updated (%d of %d)\n", m.Elapsed.Round(time.Second), m.Threshold*100, m.Matched, m.Total)
+			},
+			StopAt: float64(stopAt) / 100,
+			OnRound: func(result *dnscheck.CheckResult, err error) {
+				switch {
+				case quiet:
+				case err != nil:
+					fmt.Fprintf(stderr, "error: %v (retrying in %s)\n", err, interval)
+				default:
+					fmt.Fprintln(stderr, progress(result))
+				}
+			},
+		}, stderr, report)
+	}
+
+	result, err := dnscheck.Check(ctx, checkArgs)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		// Monitoring that reads --json still gets what was found.
+		if jsonOutput && result != nil {
+			writeJSON(stdout, result)
+		}
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitError
 	}
 
+	if influx {
+		fmt.Fprint(stdout, result.LineProtocol(time.Now()))
+		if matched, _ := result.Match(); !matched {
+			return exitMismatch
+		}
+		return exitOK
+	}
+
+	if jsonOutput {
+		if err := writeJSON(stdout, result); err != nil {
+			fmt.Fprintf(stderr, "error: %v\n", err)
+			return exitError
+		}
+		if matched, _ := result.Match(); !matched {
+			return exitMismatch
+		}
+		return exitOK
+	}
+
+	if discover {
+		return printDiscovery(result, quiet, stdout, stderr)
+	}
+
+	if !quiet {
+		for _, s := range result.Servers {
+			if s.ApexCNAME != "" && s.Error == nil {
+				fmt.Fprintf(stderr, "warning: %s (%s): CNAME at zone apex pointing to %s\n", s.Nameserver, s.Address, s.ApexCNAME)
+			}
+			for _, w := range s.TXTSizeWarnings {
+				fmt.Fprintf(stderr, "warning: %s (%s): %s\n", s.Nameserver, s.Address, w)
+			}
+		}
+	}
+
+	if matched, _ := result.Match(); !matched {
+		report(result)
+		return exitMismatch
+	}
+	if table {
+		result.ReportTable(stderr, color)
+	} else if verbose {
+		fmt.Fprint(stderr, result.Summary())
+	}
+	return exitOK
+}
+
+// parseError returns the exit code for an error from flag.FlagSet.Parse,
+// which has already printed it: exitOK for --help and exitUsage otherwise.
+func parseError(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitUsage
+}
+
+// batchConflicts are the flags that can't be used with --batch: those that
+// describe a single check, which the batch file replaces, and those that
+// select another mode. The other flags apply to every check in the batch.
+var batchConflicts = map[string]bool{
+	"type":                true,
+	"name":                true,
+	"expect":              true,
+	"expect-json":         true,
+	"expect-file":         true,
+	"expect-server":       true,
+	"names-file":          true,
+	"expect-from-name":    true,
+	"expect-from-primary": true,
+	"require-caa":         true,
+	"check-resolvers":     true,
+	"watch":               true,
+	"interval":            true,
+	"exit-on-regression":  true,
+	"milestones":          true,
+	"stop-at":             true,
+	"influx":              true,
+	"json":                true,
+	"plan":                true,
+	"table":               true,
+}
+
+// printDiscovery prints a table of the answer each server returned when no
+// expected values were given. It returns exitMismatch if any server failed,
+// including checks such as --validate-dnssec, or the servers disagree. With
+// quiet, it prints only the reason for a failure.
+func printDiscovery(result *dnscheck.CheckResult, quiet bool, stdout, stderr io.Writer) int {
 	matched, reason := result.Match()
+	consistent, answers := result.Consistent()
+	if quiet {
+		switch {
+		case !matched:
+			fmt.Fprintln(stderr, reason)
+			return exitMismatch
+		case !consistent:
+			fmt.Fprintf(stderr, "%s: servers disagree, %d distinct answers\n", result.Domain, len(answers))
+			return exitMismatch
+		}
+		return exitOK
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESERVER\tADDRESS\tANSWER")
+	for _, s := range result.Servers {
+		var answer string
+		switch {
+		case s.Error != nil:
+			answer = "error: " + s.Error.Error()
+		case len(s.Values) > 0:
+			answer = strings.Join(s.Values, ", ")
+		case s.Rcode != dnscheck.RcodeSuccess:
+			answer = s.Rcode.String()
+		default:
+			answer = "no records"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Nameserver, s.Address, answer)
+	}
+	tw.Flush()
+
+	status := exitOK
 	if !matched {
-		fmt.Fprintln(os.Stderr, reason)
-		for _, s := range result.Servers {
+		status = exitMismatch
+	}
+	if !consistent {
+		fmt.Fprintf(stderr, "%s: servers disagree, %d distinct answers\n", result.Domain, len(answers))
+		status = exitMismatch
+	}
+	return status
+}
+
+// runPlan prints the nameservers and addresses a check would query. The
+// exit status is exitMismatch if any nameserver couldn't be resolved.
+func runPlan(ctx context.Context, args dnscheck.CheckArgs, stdout, stderr io.Writer) int {
+	plan, err := dnscheck.Plan(ctx, args)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	if plan.Zone != "" {
+		fmt.Fprintf(stdout, "zone %s, %d nameservers\n", plan.Zone, len(plan.Nameservers))
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESERVER\tADDRESS")
+	status := exitOK
+	for _, s := range plan.Servers {
+		nameservers := strings.Join(append([]string{s.Nameserver}, s.OtherNameservers...), ", ")
+		address := s.Address
+		if s.Err != nil {
+			address = "error: " + s.Err.Error()
+			status = exitMismatch
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", nameservers, address)
+	}
+	tw.Flush()
+	if plan.SampledFrom > 0 {
+		fmt.Fprintf(stdout, "sampled %d of %d addresses\n", len(plan.Servers), plan.SampledFrom)
+	}
+	return status
+}
+
+// runBatch checks every entry in a batch file with the options in base, as
+// runChecks does.
+func runBatch(path string, base dnscheck.CheckArgs, timeout, batchTimeout time.Duration, concurrency int, quiet bool, report func(*dnscheck.CheckResult), stderr io.Writer) int {
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return exitUsage
+	}
+	checks, err := dnscheck.ParseBatch(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", path, err)
+		return exitUsage
+	}
+
+	for i, entry := range checks {
+		args := base
+		args.Domain, args.RecordType, args.Expected = entry.Domain, entry.RecordType, entry.Expected
+		checks[i] = args
+	}
+	return runChecks(checks, timeout, batchTimeout, concurrency, quiet, report, stderr)
+}
+
+// runChecks runs checks, up to concurrency at once and each with its own
+// timeout, and reports them with reportBatch. If batchTimeout is positive,
+// checks that haven't started when it expires are skipped and reported as
+// not run.
+func runChecks(checks []dnscheck.CheckArgs, timeout, batchTimeout time.Duration, concurrency int, quiet bool, report func(*dnscheck.CheckResult), stderr io.Writer) int {
+	ctx := context.Background()
+	if batchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, batchTimeout)
+		defer cancel()
+	}
+
+	return reportBatch(dnscheck.CheckBatchConcurrent(ctx, checks, timeout, concurrency), quiet, report, stderr)
+}
+
+// reportBatch prints a line for each check in a batch that wasn't run or
+// returned an error, passes each one that failed to report, and ends with a
+// summary unless every check passed or quiet is set. It returns exitMismatch
+// if any check ran and failed, exitError if the others returned an error or
+// weren't run, and exitOK if every check passed.
+func reportBatch(results []dnscheck.BatchResult, quiet bool, report func(*dnscheck.CheckResult), stderr io.Writer) int {
+	counts := make(map[dnscheck.BatchStatus]int)
+	var mismatched int
+	for _, r := range results {
+		counts[r.Status]++
+		switch {
+		case r.Status == dnscheck.BatchNotRun:
+			fmt.Fprintf(stderr, "not run: %s %s\n", r.Args.Domain, r.Args.RecordType)
+		case r.Error != nil:
+			fmt.Fprintf(stderr, "error: %s %s: %v\n", r.Args.Domain, r.Args.RecordType, r.Error)
+		case r.Status == dnscheck.BatchFailed:
+			mismatched++
+			report(r.Result)
+		}
+	}
+
+	if counts[dnscheck.BatchPassed] == len(results) {
+		return exitOK
+	}
+	if !quiet {
+		fmt.Fprintf(stderr, "%d passed, %d failed, %d not run\n", counts[dnscheck.BatchPassed], counts[dnscheck.BatchFailed], counts[dnscheck.BatchNotRun])
+	}
+	if mismatched > 0 {
+		return exitMismatch
+	}
+	return exitError
+}
+
+// parsePercentages parses a comma-separated list of percentages such as
+// "50,100" into fractions.
+func parsePercentages(value string) ([]float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var fractions []float64
+	for _, p := range splitExpected(value) {
+		n, err := strconv.ParseFloat(strings.TrimSuffix(p, "%"), 64)
+		if err != nil || n <= 0 || n > 100 {
+			return nil, fmt.Errorf("%q is not a percentage between 0 and 100", p)
+		}
+		fractions = append(fractions, n/100)
+	}
+	return fractions, nil
+}
+
+// runWatch polls until the check converges or ctx expires. With
+// ExitOnRegression it instead polls until ctx expires and fails early if any
+// server that matched stops matching.
+func runWatch(ctx context.Context, args dnscheck.WatchArgs, stderr io.Writer, report func(*dnscheck.CheckResult)) int {
+	w, err := dnscheck.Watch(ctx, args)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	if len(w.Regressed) > 0 {
+		for _, s := range w.Regressed {
+			if s.Error != nil {
+				fmt.Fprintf(stderr, "regressed: %s (%s): %v\n", s.Nameserver, s.Address, s.Error)
+			} else {
+				fmt.Fprintf(stderr, "regressed: %s (%s): got [%s]\n", s.Nameserver, s.Address, strings.Join(s.Values, ", "))
+			}
+		}
+		return exitMismatch
+	}
+	if !w.Converged {
+		report(w.Result)
+		return exitMismatch
+	}
+	return exitOK
+}
+
+// progress describes how many of result's servers match, e.g. "3 of 6
+// servers match".
+func progress(result *dnscheck.CheckResult) string {
+	var matched int
+	for _, s := range result.Servers {
+		if s.Match {
+			matched++
+		}
+	}
+	return fmt.Sprintf("%d of %d servers match", matched, len(result.Servers))
+}
+
+// runAudit implements the "audit" subcommand, which reports reachable,
+// unreachable, and lame nameservers for a domain without expected values.
+func runAudit(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("addled audit", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	var name string
+	var timeout time.Duration
+	var checkPrimary bool
+	flags.StringVar(&name, "name", "", "domain name to audit")
+	flags.BoolVar(&checkPrimary, "check-primary", false, "also check that the SOA MNAME answers authoritatively with the highest serial")
+	flags.DurationVar(&timeout, "timeout", 5*time.Second, "timeout for the entire audit")
+	if err := flags.Parse(args); err != nil {
+		return parseError(err)
+	}
+	if name == "" {
+		fmt.Fprintf(stderr, "usage: addled audit --name NAME\n")
+		return exitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	audit, err := dnscheck.AuditDelegation(ctx, name)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	for _, s := range audit.Servers {
+		label := s.Nameserver
+		if s.Address != "" {
+			label += " (" + s.Address + ")"
+		}
+		if s.Error != nil {
+			fmt.Fprintf(stdout, "%s: %s: %v\n", label, s.Status, s.Error)
+		} else {
+			fmt.Fprintf(stdout, "%s: %s, serial %d\n", label, s.Status, s.Serial)
+		}
+	}
+	for _, s := range audit.DivergentNS() {
+		fmt.Fprintf(stdout, "%s (%s): NS set differs from majority: %s\n", s.Nameserver, s.Address, strings.Join(s.NS, ", "))
+	}
+
+	status := exitOK
+	if healthy, reason := audit.Healthy(); !healthy {
+		fmt.Fprintln(stderr, reason)
+		status = exitMismatch
+	}
+
+	if checkPrimary {
+		primary, err := dnscheck.AuditPrimary(ctx, audit)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %v\n", err)
+			return exitError
+		}
+		for _, s := range primary.Servers {
 			label := s.Nameserver
 			if s.Address != "" {
 				label += " (" + s.Address + ")"
 			}
 			if s.Error != nil {
-				fmt.Fprintf(os.Stderr, "%s: %v\n", label, s.Error)
-			} else if !s.Match {
-				fmt.Fprintf(os.Stderr, "%s: got %s\n", label, strings.Join(s.Values, ", "))
+				fmt.Fprintf(stdout, "primary %s: %s: %v\n", label, s.Status, s.Error)
+			} else {
+				fmt.Fprintf(stdout, "primary %s: %s, serial %d\n", label, s.Status, s.Serial)
+			}
+		}
+		if healthy, reason := primary.Healthy(); !healthy {
+			fmt.Fprintf(stderr, "%s: %s\n", name, reason)
+			status = exitMismatch
+		}
+	}
+	return status
+}
+
+// runServe implements the "serve" subcommand, which runs an HTTP server that
+// answers GET /check?name=NAME&type=TYPE&expect=VALUE[,VALUE...] with the
+// JSON result of the check, and serves the outcome of the latest check of
+// each name and type as Prometheus metrics on GET /metrics.
+func runServe(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("addled serve", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	var listen, resolver string
+	var timeout time.Duration
+	var verbose bool
+	flags.StringVar(&listen, "listen", ":8080", "address to listen on")
+	flags.BoolVar(&verbose, "verbose", false, "log every check's steps to stderr, each line with the request's ID")
+	flags.StringVar(&resolver, "resolver", dnscheck.DefaultResolver, "recursive resolver for nameserver discovery")
+	flags.DurationVar(&timeout, "timeout", 10*time.Second, "maximum time for each check; requests may ask for less with a timeout parameter")
+	if err := flags.Parse(args); err != nil {
+		return parseError(err)
+	}
+
+	base := dnscheck.CheckArgs{Resolver: resolver}
+	if verbose {
+		base.Logger = slog.New(slog.NewTextHandler(stderr, nil))
+	}
+	metrics := new(dnscheck.Metrics)
+	mux := http.NewServeMux()
+	mux.Handle("GET /check", checkHandler(base, timeout, metrics))
+	mux.Handle("GET /metrics", metrics)
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	fmt.Fprintf(stderr, "listening on %s\n", listen)
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// checkHandler serves checks built from base and the request's query
+// parameters: name, type, expect (comma-separated or repeated), match, and
+// an optional timeout no longer than maxTimeout. The check is canceled if
+// the client goes away. It responds with the JSON result and status 200 if
+// every server matched or 409 if not, 400 for invalid parameters, and 502 if
+// the check couldn't be run, e.g. because no nameservers were found, with
+// the partial result if there is one. Each result is recorded in metrics.
+// The check's RequestID is taken from the X-Request-ID header, or made up
+// if there is none, and sent back in the same header.
+func checkHandler(base dnscheck.CheckArgs, maxTimeout time.Duration, metrics *dnscheck.Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		args := base
+		args.RequestID = r.Header.Get("X-Request-ID")
+		if args.RequestID == "" {
+			args.RequestID = rand.Text()
+		}
+		w.Header().Set("X-Request-ID", args.RequestID)
+		args.Domain = query.Get("name")
+		if args.Domain == "" || query.Get("type") == "" {
+			http.Error(w, "name and type are required", http.StatusBadRequest)
+			return
+		}
+		rt, err := dnscheck.ParseRecordType(query.Get("type"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		args.RecordType = rt
+		if rt == dnscheck.TypePTR {
+			args.Domain = dnscheck.ReverseName(args.Domain)
+		}
+		for _, value := range query["expect"] {
+			args.Expected = append(args.Expected, splitExpected(value)...)
+		}
+		if value := query.Get("match"); value != "" {
+			if args.MatchMode, err = parseMatchMode(value); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		timeout := maxTimeout
+		if value := query.Get("timeout"); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				http.Error(w, fmt.Sprintf("invalid timeout: %q", value), http.StatusBadRequest)
+				return
+			}
+			timeout = min(d, maxTimeout)
+		}
+		if err := args.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		result, err := dnscheck.Check(ctx, args)
+		if result == nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		result.Observe(metrics)
+		status := http.StatusOK
+		if err != nil {
+			status = http.StatusBadGateway
+		} else if matched, _ := result.Match(); !matched {
+			status = http.StatusConflict
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		writeJSON(w, result)
+	})
+}
+
+// runResolverCheck checks the record against each recursive resolver and
+// prints one line per resolver with its answer, TTL and inferred cache state.
+func runResolverCheck(ctx context.Context, args dnscheck.CheckArgs, resolvers []string, stdout, stderr io.Writer) int {
+	results, err := dnscheck.CheckResolvers(ctx, args, resolvers)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	code := exitOK
+	for _, r := range results {
+		if r.Error != nil {
+			fmt.Fprintf(stdout, "%s: %v\n", r.Resolver, r.Error)
+			if code == exitOK {
+				code = exitError
 			}
+			continue
+		}
+		status := "match"
+		if !r.Match {
+			status = "mismatch"
+			code = exitMismatch
+		}
+		fmt.Fprintf(stdout, "%s: %s, %s (ttl %d of %d): %s\n", r.Resolver, status, r.Cache, r.TTL, r.AuthoritativeTTL, strings.Join(r.Values, ", "))
+	}
+	return code
+}
+
+// useColor decides whether to colorize output written to w based on the
+// --color mode. In auto mode, color is used only when w is a terminal and
+// the NO_COLOR environment variable is unset or empty.
+func useColor(mode string, w io.Writer) (bool, error) {
+	switch strings.ToLower(mode) {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		f, ok := w.(*os.File)
+		if !ok {
+			return false, nil
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return false, nil
 		}
-		os.Exit(1)
+		return info.Mode()&os.ModeCharDevice != 0, nil
+	default:
+		return false, fmt.Errorf("unsupported --color value: %q", mode)
+	}
+}
+
+// lockedWriter serializes writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// parseApexCNAMEPolicy maps an --apex-cname value to a policy.
+func parseApexCNAMEPolicy(value string) (dnscheck.ApexCNAMEPolicy, error) {
+	switch strings.ToLower(value) {
+	case "warn":
+		return dnscheck.ApexCNAMEWarn, nil
+	case "error":
+		return dnscheck.ApexCNAMEError, nil
+	case "follow":
+		return dnscheck.ApexCNAMEFollow, nil
+	default:
+		return 0, fmt.Errorf("unsupported --apex-cname value: %q", value)
+	}
+}
+
+// writeJSON writes result to w as indented JSON, in the schema documented
+// on dnscheck.CheckResult.MarshalJSON.
+func writeJSON(w io.Writer, result *dnscheck.CheckResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// parseFamily parses a --family value.
+func parseFamily(value string) (dnscheck.AddressFamily, error) {
+	switch strings.ToLower(value) {
+	case "ipv4":
+		return dnscheck.FamilyIPv4, nil
+	case "ipv6":
+		return dnscheck.FamilyIPv6, nil
+	case "both":
+		return dnscheck.FamilyBoth, nil
+	default:
+		return 0, fmt.Errorf("unsupported --family value: %q", value)
+	}
+}
+
+// parseMatchMode parses a --match value.
+func parseMatchMode(value string) (dnscheck.MatchMode, error) {
+	switch strings.ToLower(value) {
+	case "exact":
+		return dnscheck.MatchExact, nil
+	case "subset":
+		return dnscheck.MatchSubset, nil
+	case "absent":
+		return dnscheck.MatchAbsent, nil
+	case "regex":
+		return dnscheck.MatchRegex, nil
+	default:
+		return 0, fmt.Errorf("unsupported --match value: %q", value)
+	}
+}
+
+// splitExpected splits a comma-separated --expect value and trims whitespace
+// from each entry.
+func splitExpected(value string) []string {
+	expected := strings.Split(value, ",")
+	for i := range expected {
+		expected[i] = strings.TrimSpace(expected[i])
+	}
+	return expected
+}
+
+// parseExpectedByType groups expected values given as TYPE=VALUE by record
+// type, for checking several --type values at once. Every value must name one
+// of recordTypes, and every type needs at least one value.
+func parseExpectedByType(expected []string, recordTypes []dnscheck.RecordType) (map[dnscheck.RecordType][]string, error) {
+	byType := make(map[dnscheck.RecordType][]string)
+	for _, value := range expected {
+		name, v, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected value %q: want TYPE=VALUE with several record types", value)
+		}
+		rt, err := dnscheck.ParseRecordType(strings.TrimSpace(name))
+		if err != nil {
+			return nil, fmt.Errorf("expected value %q: %w", value, err)
+		}
+		if !slices.Contains(recordTypes, rt) {
+			return nil, fmt.Errorf("expected value %q: %s is not in --type", value, rt)
+		}
+		byType[rt] = append(byType[rt], strings.TrimSpace(v))
+	}
+	for _, rt := range recordTypes {
+		if len(byType[rt]) == 0 {
+			return nil, fmt.Errorf("no expected values for %s, e.g. --expect %s=VALUE", rt, rt)
+		}
+	}
+	return byType, nil
+}
+
+// readLines reads a file listing one value per line, such as an
+// --expect-file. Whitespace around each value is trimmed, and blank lines and
+// lines starting with "#" are ignored.
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var values []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value := strings.TrimSpace(scanner.Text())
+		if value == "" || strings.HasPrefix(value, "#") {
+			continue
+		}
+		values = append(values, value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+// parseExpectedJSON parses an --expect-json value, which must be a JSON array
+// of strings. Values are used verbatim, so they may contain commas and spaces.
+func parseExpectedJSON(value string) ([]string, error) {
+	var expected []string
+	if err := json.Unmarshal([]byte(value), &expected); err != nil {
+		return nil, fmt.Errorf("invalid --expect-json value: %w", err)
 	}
+	return expected, nil
 }
@@ -0,0 +1,576 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacob2161/addled/dnscheck"
+	"github.com/miekg/dns"
+)
+
+func TestParseExpectedJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "single value",
+			input: `["1.1.1.1"]`,
+			want:  []string{"1.1.1.1"},
+		},
+		{
+			name:  "values containing commas",
+			input: `["v=spf1 include:a.example.com,b.example.com ~all", "1.0.0.1"]`,
+			want:  []string{"v=spf1 include:a.example.com,b.example.com ~all", "1.0.0.1"},
+		},
+		{
+			name:  "values containing spaces are not trimmed",
+			input: `[" leading", "trailing ", "0 issue \"letsencrypt.org\""]`,
+			want:  []string{" leading", "trailing ", `0 issue "letsencrypt.org"`},
+		},
+		{
+			name:  "empty array",
+			input: `[]`,
+			want:  []string{},
+		},
+		{
+			name:    "not an array",
+			input:   `"1.1.1.1"`,
+			wantErr: true,
+		},
+		{
+			name:    "non-string element",
+			input:   `[1]`,
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			input:   `["1.1.1.1"`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExpectedJSON(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseExpectedJSON(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("parseExpectedJSON(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitExpected(t *testing.T) {
+	got := splitExpected(" 1.1.1.1 , 1.0.0.1")
+	want := []string{"1.1.1.1", "1.0.0.1"}
+	if !slices.Equal(got, want) {
+		t.Errorf("splitExpected() = %q, want %q", got, want)
+	}
+
+	// SRV values contain spaces but no commas.
+	got = splitExpected("10 5 5060 sip1.example.com, 20 0 5060 sip2.example.com")
+	want = []string{"10 5 5060 sip1.example.com", "20 0 5060 sip2.example.com"}
+	if !slices.Equal(got, want) {
+		t.Errorf("splitExpected() = %q, want %q", got, want)
+	}
+}
+
+func TestParseExpectedByType(t *testing.T) {
+	types := []dnscheck.RecordType{dnscheck.TypeA, dnscheck.TypeTXT}
+	got, err := parseExpectedByType([]string{"A=192.0.2.1", "txt=v=spf1 -all", "A = 192.0.2.2"}, types)
+	if err != nil {
+		t.Fatalf("parseExpectedByType() error: %v", err)
+	}
+	if a := got[dnscheck.TypeA]; !slices.Equal(a, []string{"192.0.2.1", "192.0.2.2"}) {
+		t.Errorf("A values = %q, want both addresses", a)
+	}
+	if txt := got[dnscheck.TypeTXT]; !slices.Equal(txt, []string{"v=spf1 -all"}) {
+		t.Errorf("TXT values = %q, want the value after the first =", txt)
+	}
+
+	for _, tt := range []struct {
+		expected []string
+		wantErr  string
+	}{
+		{[]string{"192.0.2.1", "TXT=x"}, "want TYPE=VALUE"},
+		{[]string{"A=192.0.2.1", "MX=mx.example.com"}, "MX is not in --type"},
+		{[]string{"A=192.0.2.1"}, "no expected values for TXT"},
+	} {
+		if _, err := parseExpectedByType(tt.expected, types); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("parseExpectedByType(%q) error = %v, want %q", tt.expected, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRunSeveralTypesWithJSON(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--type", "A,AAAA", "--name", "example.com", "--expect", "A=192.0.2.1,AAAA=2001:db8::1", "--json"}, &stdout, &stderr)
+	if code != exitUsage || !strings.Contains(stderr.String(), "several record types") {
+		t.Errorf("run() = %d, stderr %q; want %d and a several record types error", code, stderr.String(), exitUsage)
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "expected.txt")
+	content := "# mail servers\n10 mx1.example.com.\n\n  20 mx2.example.com.  \n\t# backup\n30 mx3.example.com.\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readLines(path)
+	if err != nil {
+		t.Fatalf("readLines() error: %v", err)
+	}
+	want := []string{"10 mx1.example.com.", "20 mx2.example.com.", "30 mx3.example.com."}
+	if !slices.Equal(got, want) {
+		t.Errorf("readLines() = %q, want %q", got, want)
+	}
+
+	if _, err := readLines(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("readLines() of a missing file succeeded, want error")
+	}
+}
+
+func TestRunEmptyExpectFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "expected.txt")
+	if err := os.WriteFile(path, []byte("# nothing yet\n\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--type", "A", "--name", "example.com", "--expect-file", path}, &stdout, &stderr)
+	if code != exitUsage {
+		t.Errorf("run() = %d, want %d", code, exitUsage)
+	}
+	if !bytes.Contains(stderr.Bytes(), []byte("has no values")) {
+		t.Errorf("stderr = %q, want empty --expect-file message", stderr.String())
+	}
+}
+
+func TestRunInvalidExpectJSON(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--type", "TXT", "--name", "example.com", "--expect-json", "not json"}, &stdout, &stderr)
+	if code != exitUsage {
+		t.Errorf("run() = %d, want %d", code, exitUsage)
+	}
+	if !bytes.Contains(stderr.Bytes(), []byte("invalid --expect-json value")) {
+		t.Errorf("stderr = %q, want invalid --expect-json message", stderr.String())
+	}
+}
+
+func TestRunInvalidCheck(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--type", "A", "--name", "example.com", "--match", "absent"}, &stdout, &stderr)
+	if code != exitUsage {
+		t.Errorf("run() = %d, want %d", code, exitUsage)
+	}
+	if !strings.HasPrefix(stderr.String(), "invalid check: ") {
+		t.Errorf("stderr = %q, want an invalid check message", stderr.String())
+	}
+}
+
+func TestRunInvalidPort(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--type", "A", "--name", "example.com", "--expect", "192.0.2.1", "--port", "70000"}, &stdout, &stderr)
+	if code != exitUsage {
+		t.Errorf("run() = %d, want %d", code, exitUsage)
+	}
+	if !bytes.Contains(stderr.Bytes(), []byte("invalid --port: 70000")) {
+		t.Errorf("stderr = %q, want invalid --port message", stderr.String())
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	var buf bytes.Buffer
+	tests := []struct {
+		mode    string
+		noColor string
+		want    bool
+		wantErr bool
+	}{
+		{mode: "always", want: true},
+		{mode: "always", noColor: "1", want: true},
+		{mode: "never", want: false},
+		// A bytes.Buffer is never a terminal.
+		{mode: "auto", want: false},
+		{mode: "auto", noColor: "1", want: false},
+		{mode: "sometimes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+tt.noColor, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			got, err := useColor(tt.mode, &buf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("useColor(%q) error = %v, wantErr %v", tt.mode, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("useColor(%q) = %v, want %v", tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunInvalidExpectServer(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--type", "A", "--name", "example.com", "--expect", "192.0.2.1", "--expect-server", "no-equals-sign"}, &stdout, &stderr)
+	if code != exitUsage {
+		t.Errorf("run() = %d, want %d", code, exitUsage)
+	}
+	if !bytes.Contains(stderr.Bytes(), []byte("SERVER=VALUE")) {
+		t.Errorf("stderr = %q, want SERVER=VALUE hint", stderr.String())
+	}
+}
+
+func TestRunBatchInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.txt")
+	if err := os.WriteFile(path, []byte("example.com\n  BOGUS 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"--batch", path}, &stdout, &stderr); code != exitUsage {
+		t.Errorf("run() = %d, want %d", code, exitUsage)
+	}
+	if !strings.Contains(stderr.String(), "line 2") {
+		t.Errorf("stderr = %q, want line number", stderr.String())
+	}
+}
+
+func TestRunBatchConflictingFlags(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--batch", "batch.txt", "--name", "example.com", "--expect", "192.0.2.1", "--names-file", "names.txt"}, &stdout, &stderr)
+	if code != exitUsage {
+		t.Errorf("run() = %d, want %d", code, exitUsage)
+	}
+	if want := "--batch can't be used with --expect, --name, --names-file"; !strings.Contains(stderr.String(), want) {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+}
+
+func TestParsePercentages(t *testing.T) {
+	got, err := parsePercentages("50, 90%,100")
+	if err != nil {
+		t.Fatalf("parsePercentages() error: %v", err)
+	}
+	if want := []float64{0.5, 0.9, 1}; !slices.Equal(got, want) {
+		t.Errorf("parsePercentages() = %v, want %v", got, want)
+	}
+
+	for _, value := range []string{"0", "101", "half"} {
+		if _, err := parsePercentages(value); err == nil {
+			t.Errorf("parsePercentages(%q) succeeded, want error", value)
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	result := &dnscheck.CheckResult{
+		Domain:      "example.com",
+		RecordType:  dnscheck.TypeA,
+		Expected:    []string{"192.0.2.1"},
+		Zone:        "example.com.",
+		Nameservers: []string{"ns1.example.com.", "ns2.example.com."},
+		Servers: []dnscheck.ServerResult{
+			{Nameserver: "ns1.example.com.", Address: "192.0.2.53", Values: []string{"192.0.2.1"}, TTLs: []uint32{300}, Match: true},
+			{Nameserver: "ns2.example.com.", Error: errors.New("could not resolve nameserver")},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := writeJSON(&out, result); err != nil {
+		t.Fatalf("writeJSON() error: %v", err)
+	}
+	want := `{
+  "domain": "example.com",
+  "type": "A",
+  "expected": [
+    "192.0.2.1"
+  ],
+  "match_mode": "exact",
+  "zone": "example.com.",
+  "nameservers": [
+    "ns1.example.com.",
+    "ns2.example.com."
+  ],
+  "match": false,
+  "reason": "example.com: 1 of 2 servers returned unexpected A records",
+  "servers": [
+    {
+      "nameserver": "ns1.example.com.",
+      "address": "192.0.2.53",
+      "family": "IPv4",
+      "values": [
+        "192.0.2.1"
+      ],
+      "ttls": [
+        300
+      ],
+      "match": true
+    },
+    {
+      "nameserver": "ns2.example.com.",
+      "values": [],
+      "ttls": [],
+      "match": false,
+      "error": "could not resolve nameserver"
+    }
+  ]
+}
+`
+	if out.String() != want {
+		t.Errorf("writeJSON() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	result := &dnscheck.CheckResult{
+		Servers: []dnscheck.ServerResult{{Match: true}, {Match: false}, {Match: true}},
+	}
+	if got, want := progress(result), "2 of 3 servers match"; got != want {
+		t.Errorf("progress() = %q, want %q", got, want)
+	}
+}
+
+func TestPrintDiscovery(t *testing.T) {
+	result := &dnscheck.CheckResult{
+		Domain:     "example.com",
+		RecordType: dnscheck.TypeA,
+		Servers: []dnscheck.ServerResult{
+			{Nameserver: "ns1.example.com.", Address: "192.0.2.51", Values: []string{"192.0.2.1"}, Match: true},
+			{Nameserver: "ns2.example.com.", Address: "192.0.2.52", Values: []string{"192.0.2.9"}, Match: true},
+			{Nameserver: "ns3.example.com.", Address: "192.0.2.53", Rcode: dnscheck.RcodeNXDomain, Match: true},
+		},
+	}
+
+	var stdout, stderr bytes.Buffer
+	if status := printDiscovery(result, false, &stdout, &stderr); status != exitMismatch {
+		t.Errorf("printDiscovery() = %d, want %d", status, exitMismatch)
+	}
+	want := strings.Join([]string{
+		"NAMESERVER        ADDRESS     ANSWER",
+		"ns1.example.com.  192.0.2.51  192.0.2.1",
+		"ns2.example.com.  192.0.2.52  192.0.2.9",
+		"ns3.example.com.  192.0.2.53  NXDOMAIN",
+		"",
+	}, "\n")
+	if stdout.String() != want {
+		t.Errorf("printDiscovery() table =\n%s\nwant\n%s", stdout.String(), want)
+	}
+	if got, want := stderr.String(), "example.com: servers disagree, 3 distinct answers\n"; got != want {
+		t.Errorf("printDiscovery() stderr = %q, want %q", got, want)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if status := printDiscovery(result, true, &stdout, &stderr); status != exitMismatch {
+		t.Errorf("quiet printDiscovery() = %d, want %d", status, exitMismatch)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("quiet printDiscovery() table = %q, want none", stdout.String())
+	}
+	if got, want := stderr.String(), "example.com: servers disagree, 3 distinct answers\n"; got != want {
+		t.Errorf("quiet printDiscovery() stderr = %q, want %q", got, want)
+	}
+}
+
+func TestReportBatch(t *testing.T) {
+	failed := &dnscheck.CheckResult{
+		Domain:     "b.example",
+		RecordType: dnscheck.TypeA,
+		Servers:    []dnscheck.ServerResult{{Nameserver: "ns1.b.example.", Address: "192.0.2.1", Values: []string{"192.0.2.9"}}},
+	}
+	results := []dnscheck.BatchResult{
+		{Args: dnscheck.CheckArgs{Domain: "a.example", RecordType: dnscheck.TypeA}, Status: dnscheck.BatchPassed},
+		{Args: dnscheck.CheckArgs{Domain: "b.example", RecordType: dnscheck.TypeA}, Status: dnscheck.BatchFailed, Result: failed},
+		{Args: dnscheck.CheckArgs{Domain: "c.example", RecordType: dnscheck.TypeA}, Status: dnscheck.BatchFailed, Error: errors.New("no nameservers found")},
+	}
+
+	for _, tt := range []struct {
+		quiet bool
+		want  string
+	}{
+		{false, "error: c.example A: no nameservers found\n1 passed, 2 failed, 0 not run\n"},
+		{true, "error: c.example A: no nameservers found\n"},
+	} {
+		var stderr bytes.Buffer
+		var reported []string
+		report := func(result *dnscheck.CheckResult) {
+			reported = append(reported, result.Domain)
+		}
+		if status := reportBatch(results, tt.quiet, report, &stderr); status != exitMismatch {
+			t.Errorf("reportBatch(quiet=%v) = %d, want %d", tt.quiet, status, exitMismatch)
+		}
+		if !slices.Equal(reported, []string{"b.example"}) {
+			t.Errorf("reportBatch(quiet=%v) reported %q, want [b.example]", tt.quiet, reported)
+		}
+		if got := stderr.String(); got != tt.want {
+			t.Errorf("reportBatch(quiet=%v) output = %q, want %q", tt.quiet, got, tt.want)
+		}
+	}
+	if status := reportBatch(results[2:], false, nil, new(bytes.Buffer)); status != exitError {
+		t.Errorf("reportBatch() with only an error = %d, want %d", status, exitError)
+	}
+}
+
+func TestRunSeveralNamesWithJSON(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--type", "A", "--name", "a.example", "--name", "b.example", "--expect", "192.0.2.1", "--json"}, &stdout, &stderr)
+	if code != exitUsage || !strings.Contains(stderr.String(), "several domain names") {
+		t.Errorf("run() = %d, stderr %q; want %d and a several domain names error", code, stderr.String(), exitUsage)
+	}
+}
+
+func TestRunCheckResolversWithRequireCAA(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--type", "CAA", "--name", "example.com", "--require-caa", "issue letsencrypt.org", "--check-resolvers", "192.0.2.1:53"}, &stdout, &stderr)
+	if code != exitUsage || !strings.Contains(stderr.String(), "--check-resolvers can't be used") {
+		t.Errorf("run() = %d, stderr %q; want %d and a --check-resolvers error", code, stderr.String(), exitUsage)
+	}
+}
+
+func TestRunQuietWithJSON(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--type", "A", "--name", "example.com", "--expect", "192.0.2.1", "--quiet", "--json"}, &stdout, &stderr)
+	if code != exitUsage || !strings.Contains(stderr.String(), "--quiet can't be used") {
+		t.Errorf("run() = %d, stderr %q; want %d and a --quiet error", code, stderr.String(), exitUsage)
+	}
+}
+
+func TestRunPlanConflicts(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--type", "A", "--name", "example.com", "--expect", "192.0.2.1", "--plan", "--watch"}, &stdout, &stderr)
+	if code != exitUsage || !strings.Contains(stderr.String(), "--plan can't be used") {
+		t.Errorf("run() = %d, stderr %q; want %d and a --plan error", code, stderr.String(), exitUsage)
+	}
+
+	stderr.Reset()
+	code = run([]string{"--batch", "batch.txt", "--plan"}, &stdout, &stderr)
+	if code != exitUsage || !strings.Contains(stderr.String(), "--batch can't be used with --plan") {
+		t.Errorf("run() = %d, stderr %q; want %d and a --batch error", code, stderr.String(), exitUsage)
+	}
+}
+
+func TestRunTableConflicts(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--type", "A", "--name", "example.com", "--expect", "192.0.2.1", "--table", "--group"}, &stdout, &stderr)
+	if code != exitUsage || !strings.Contains(stderr.String(), "--table can't be used") {
+		t.Errorf("run() = %d, stderr %q; want %d and a --table error", code, stderr.String(), exitUsage)
+	}
+
+	stderr.Reset()
+	code = run([]string{"--batch", "batch.txt", "--table"}, &stdout, &stderr)
+	if code != exitUsage || !strings.Contains(stderr.String(), "--batch can't be used with --table") {
+		t.Errorf("run() = %d, stderr %q; want %d and a --batch error", code, stderr.String(), exitUsage)
+	}
+}
+
+type exchangerFunc func(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error)
+
+func (f exchangerFunc) Exchange(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+	return f(ctx, msg, address)
+}
+
+type hostsFunc func(ctx context.Context, host string) ([]string, error)
+
+func (f hostsFunc) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return f(ctx, host)
+}
+
+func TestCheckHandler(t *testing.T) {
+	// The resolver delegates example.com to ns1.example.com., which answers
+	// with 192.0.2.1.
+	var logs bytes.Buffer
+	base := dnscheck.CheckArgs{
+		Resolver: "resolver:53",
+		Logger:   slog.New(slog.NewTextHandler(&logs, nil)),
+		Exchanger: exchangerFunc(func(ctx context.Context, msg *dns.Msg, address string) (*dns.Msg, error) {
+			response := new(dns.Msg)
+			response.SetReply(msg)
+			response.Authoritative = true
+			record := "example.com. 300 IN A 192.0.2.1"
+			if address == "resolver:53" {
+				record = "example.com. 300 IN NS ns1.example.com."
+			}
+			rr, err := dns.NewRR(record)
+			if err != nil {
+				return nil, err
+			}
+			response.Answer = append(response.Answer, rr)
+			return response, nil
+		}),
+		HostResolver: hostsFunc(func(ctx context.Context, host string) ([]string, error) {
+			return []string{"192.0.2.53"}, nil
+		}),
+	}
+	metrics := new(dnscheck.Metrics)
+	handler := checkHandler(base, time.Second, metrics)
+
+	tests := []struct {
+		query      string
+		wantStatus int
+	}{
+		{"name=example.com&type=A&expect=192.0.2.1", http.StatusOK},
+		{"name=example.com&type=A&expect=192.0.2.2", http.StatusConflict},
+		{"name=example.com&type=A&expect=192.0.2.1&timeout=500ms", http.StatusOK},
+		{"type=A&expect=192.0.2.1", http.StatusBadRequest},
+		{"name=example.com&type=BOGUS", http.StatusBadRequest},
+		{"name=example.com&type=A&match=fuzzy", http.StatusBadRequest},
+		{"name=example.com&type=A&timeout=soon", http.StatusBadRequest},
+		{"name=exa%20mple.com&type=A&expect=192.0.2.1", http.StatusBadRequest},
+		{"name=example.com&type=A&match=absent", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/check?"+tt.query, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("GET /check?%s status = %d, want %d: %s", tt.query, rec.Code, tt.wantStatus, rec.Body)
+			continue
+		}
+		if rec.Header().Get("X-Request-ID") == "" {
+			t.Errorf("GET /check?%s has no X-Request-ID", tt.query)
+		}
+		if rec.Code == http.StatusBadRequest {
+			continue
+		}
+		var body struct {
+			Domain string `json:"domain"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Domain != "example.com" {
+			t.Errorf("GET /check?%s body = %s, want the JSON result", tt.query, rec.Body)
+		}
+	}
+
+	// A request's own ID is logged and sent back.
+	logs.Reset()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/check?name=example.com&type=A&expect=192.0.2.1", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Request-ID"); got != "req-42" || !strings.Contains(logs.String(), "request_id=req-42") {
+		t.Errorf("X-Request-ID = %q, logs %q; want req-42 in both", got, logs.String())
+	}
+
+	// The last check to run was a match.
+	rec = httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if want := `addled_check_success{domain="example.com",type="A"} 1`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("/metrics = %s, want it to contain %s", rec.Body, want)
+	}
+}